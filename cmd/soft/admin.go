@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// runAdmin runs the admin subcommands, which edit the users in config.yaml
+// without going through SSH. The edits are committed to the config repo.
+func runAdmin(args []string) {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+	switch args[0] {
+	case "add-user":
+		fs := newFlagSet("admin add-user", "[flags] NAME [KEY...]")
+		admin := fs.Bool("admin", false, "give the user admin access")
+		loadConfig := serverFlags(fs)
+		fs.Parse(args[1:]) // nolint: errcheck
+		if fs.NArg() < 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		ac := openConfig(loadConfig())
+		defer ac.DB.Close() // nolint: errcheck
+		keys := make([]string, 0)
+		for _, k := range fs.Args()[1:] {
+			keys = append(keys, readKeys(k)...)
+		}
+		err := ac.AddUser(fs.Arg(0), *admin, keys)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Added user %s", fs.Arg(0))
+	case "add-key":
+		fs := newFlagSet("admin add-key", "[flags] NAME KEY")
+		loadConfig := serverFlags(fs)
+		fs.Parse(args[1:]) // nolint: errcheck
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		ac := openConfig(loadConfig())
+		defer ac.DB.Close() // nolint: errcheck
+		for _, k := range readKeys(fs.Arg(1)) {
+			err := ac.AddKey(fs.Arg(0), k)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		log.Printf("Added key to user %s", fs.Arg(0))
+	default:
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  soft admin add-user [flags] NAME [KEY...]   add a user\n")
+		fmt.Fprintf(os.Stderr, "  soft admin add-key [flags] NAME KEY         add a public key to a user\n")
+		fmt.Fprintf(os.Stderr, "\nKEY is a public key in authorized_keys format or the path of a file of keys.\n")
+		if args[0] != "help" {
+			os.Exit(2)
+		}
+	}
+}
+
+// readKeys returns the public keys in k, which is either a public key or the
+// path of a file containing public keys, one per line.
+func readKeys(k string) []string {
+	data, err := os.ReadFile(k)
+	if err != nil {
+		return []string{k}
+	}
+	keys := make([]string, 0)
+	for _, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "#") {
+			keys = append(keys, l)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/charmbracelet/soft-serve/internal/backup"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/git"
+)
+
+func runBackup(args []string) {
+	fs := newFlagSet("backup", "[flags] FILE")
+	loadConfig := serverFlags(fs)
+	fs.Parse(args) // nolint: errcheck
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := loadConfig()
+
+	d, err := db.Open(cfg.DBPath)
+	if errors.Is(err, db.ErrLocked) {
+		log.Fatalf("%s\nThe server seems to be running, back it up over SSH instead:\n  ssh -p %d HOST server backup > %s", err, cfg.Port, fs.Arg(0))
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer d.Close() // nolint: errcheck
+	rs := git.NewRepoSource(cfg.RepoPath)
+	err = rs.LoadRepos()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	path := fs.Arg(0)
+	err = writeBackup(path, rs, d, cfg.KeyPath)
+	if err != nil {
+		d.Close() // nolint: errcheck
+		log.Fatalln(err)
+	}
+	if path != "-" {
+		log.Printf("Backed up %s to %s", cfg.RepoPath, path)
+	}
+}
+
+// writeBackup writes a backup to path, or to stdout if path is "-". The backup
+// is written to a temporary file first, which is removed if it fails, so a
+// failed backup doesn't leave a truncated file behind.
+func writeBackup(path string, rs *git.RepoSource, d *db.DB, keyPath string) error {
+	if path == "-" {
+		return backup.Backup(os.Stdout, rs, d, keyPath)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	err = backup.Backup(f, rs, d, keyPath)
+	if err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func runRestore(args []string) {
+	fs := newFlagSet("restore", "[flags] FILE")
+	force := fs.Bool("force", false, "replace existing repos, database and host key")
+	loadConfig := serverFlags(fs)
+	fs.Parse(args) // nolint: errcheck
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := loadConfig()
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close() // nolint: errcheck
+		r = f
+	}
+	m, err := backup.Restore(r, cfg, backup.Options{Force: *force})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Restored %d repos from the backup taken at %s, all refs verified", len(m.Repos), m.Created.Format("2006-01-02 15:04:05 MST"))
+}
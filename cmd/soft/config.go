@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	appCfg "github.com/charmbracelet/soft-serve/internal/config"
+)
+
+// runConfig runs the config subcommands, which work on config.yaml files
+// outside of the server.
+func runConfig(args []string) {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+	switch args[0] {
+	case "check":
+		fs := newFlagSet("config check", "[flags] FILE")
+		loadConfig := serverFlags(fs)
+		fs.Parse(args[1:]) // nolint: errcheck
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		os.Exit(checkConfig(loadConfig().RepoPath, fs.Arg(0)))
+	case "schema":
+		s, err := appCfg.Schema()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(string(s))
+	default:
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  soft config check [flags] FILE   validate a config.yaml\n")
+		fmt.Fprintf(os.Stderr, "  soft config schema               print the JSON Schema of config.yaml\n")
+		if args[0] != "help" {
+			os.Exit(2)
+		}
+	}
+}
+
+// checkConfig validates a config.yaml with the same rules the server uses and
+// returns the exit code. References to repos are only checked if the repos
+// directory of the server exists on this machine.
+func checkConfig(repoPath string, path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+	// Without a repos directory, repos is nil and references aren't checked.
+	repos, _ := appCfg.RepoNames(repoPath)
+	err = appCfg.ValidateConfig(data, repos)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s is invalid:\n", path)
+		appCfg.WriteValidationErrors(os.Stderr, path, err)
+		return 1
+	}
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
@@ -1,17 +1,14 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"strings"
 
 	"github.com/charmbracelet/soft-serve/config"
-	"github.com/charmbracelet/soft-serve/server"
+	appCfg "github.com/charmbracelet/soft-serve/internal/config"
 )
 
 var (
@@ -22,54 +19,141 @@ var (
 	// CommitSHA contains the SHA of the commit that this application was built
 	// against. It's set via lgflags when building.
 	CommitSHA = ""
-
-	version = flag.Bool("version", false, "display version")
 )
 
-func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Soft Serve, a self-hostable Git server for the command line.\n\n")
-		flag.PrintDefaults()
-	}
+// command is a subcommand of soft.
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(args []string)
+}
 
-	flag.Parse()
+var commands []*command
 
-	if *version {
-		if len(CommitSHA) > 7 {
-			CommitSHA = CommitSHA[:7]
-		}
-		if Version == "" {
-			Version = "(built from source)"
-		}
+func init() {
+	commands = []*command{
+		{"serve", "[flags]", "start the server (default)", runServe},
+		{"init", "[flags]", "create the host key, database and config repo", runInit},
+		{"admin", "add-user|add-key [flags] ...", "edit users in config.yaml", runAdmin},
+		{"repo", "import [flags] SOURCE", "import an existing repo", runRepo},
+		{"backup", "[flags] FILE", "back up repos, database and host key", runBackup},
+		{"restore", "[flags] FILE", "restore a backup", runRestore},
+		{"config", "check|schema ...", "validate config.yaml files", runConfig},
+		{"migrate", "[flags]", "run database migrations", runMigrate},
+		{"hook", "NAME", "run a git hook, used by the installed hooks", runHook},
+		{"version", "", "display version", runVersion},
+	}
+}
 
-		fmt.Printf("Soft Serve %s", Version)
-		if len(CommitSHA) > 0 {
-			fmt.Printf(" (%s)", CommitSHA)
+func main() {
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 {
+		switch {
+		case args[0] == "-version" || args[0] == "--version":
+			name, args = "version", args[1:]
+		case args[0] == "-migrate" || args[0] == "--migrate":
+			name, args = "migrate", args[1:]
+		case args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help":
+			usage()
+			return
+		case !strings.HasPrefix(args[0], "-"):
+			name, args = args[0], args[1:]
+		}
+	}
+	for _, c := range commands {
+		if c.name == name {
+			c.run(args)
+			return
 		}
-
-		fmt.Println()
-		os.Exit(0)
 	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	cfg := config.DefaultConfig()
-	s := server.NewServer(cfg)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Soft Serve, a self-hostable Git server for the command line.\n\n")
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  soft %-36s %s\n", strings.TrimSpace(c.name+" "+c.usage), c.help)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun soft COMMAND -h for the flags of a command. Flags take precedence over\nenvironment variables, which take precedence over the config file.\n")
+}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+// newFlagSet returns a flag set for the named subcommand.
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet("soft "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: soft %s %s\n\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	log.Printf("Starting SSH server on %s:%d", cfg.Host, cfg.Port)
-	go func() {
-		if err := s.Start(); err != nil {
+// serverFlags adds the flags for the server settings to fs. The returned
+// function loads the server configuration once the flags are parsed.
+func serverFlags(fs *flag.FlagSet) func() *config.Config {
+	path := fs.String("config", "", "path to a YAML or TOML config file")
+	flags := &config.Config{}
+	fs.StringVar(&flags.Host, "host", "", "host to listen on (env SOFT_SERVE_HOST)")
+	fs.IntVar(&flags.Port, "port", 0, "port to listen on (env SOFT_SERVE_PORT)")
+	fs.StringVar(&flags.KeyPath, "key-path", "", "path to the server host key (env SOFT_SERVE_KEY_PATH)")
+	fs.StringVar(&flags.RepoPath, "repo-path", "", "path to the repos (env SOFT_SERVE_REPO_PATH)")
+	fs.StringVar(&flags.DBPath, "db-path", "", "path to the database (env SOFT_SERVE_DB_PATH)")
+	fs.IntVar(&flags.HTTPPort, "http-port", 0, "port the HTTP server for Git LFS listens on (env SOFT_SERVE_HTTP_PORT)")
+	fs.StringVar(&flags.HTTPURL, "http-url", "", "URL the HTTP server is reachable at (env SOFT_SERVE_HTTP_URL)")
+	return func() *config.Config {
+		cfg, err := config.LoadConfig(*path, flags)
+		if err != nil {
 			log.Fatalln(err)
 		}
-	}()
-
-	<-done
+		return cfg
+	}
+}
 
-	log.Printf("Stopping SSH server on %s:%d", cfg.Host, cfg.Port)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer func() { cancel() }()
-	if err := s.Shutdown(ctx); err != nil {
+// openConfig opens the configuration of a server that isn't running, creating
+// the database and config repo if they don't exist yet.
+func openConfig(cfg *config.Config) *appCfg.Config {
+	ac, err := appCfg.NewConfig(cfg)
+	if err != nil {
 		log.Fatalln(err)
 	}
+	return ac
+}
+
+func runVersion(args []string) {
+	if len(CommitSHA) > 7 {
+		CommitSHA = CommitSHA[:7]
+	}
+	if Version == "" {
+		Version = "(built from source)"
+	}
+
+	fmt.Printf("Soft Serve %s", Version)
+	if len(CommitSHA) > 0 {
+		fmt.Printf(" (%s)", CommitSHA)
+	}
+
+	fmt.Println()
+}
+
+// runHook runs the named git hook. Hooks are installed in the repos by the
+// server and invoke the soft binary.
+func runHook(args []string) {
+	var err error
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	switch name {
+	case "pre-receive":
+		err = appCfg.PreReceiveHook(os.Stdin, os.Stderr)
+	default:
+		err = fmt.Errorf("unknown hook %q", name)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
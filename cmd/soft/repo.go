@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	appCfg "github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/gitolite"
+)
+
+// runRepo runs the repo subcommands, which manage the repos of a server
+// without going through SSH.
+func runRepo(args []string) {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+	switch args[0] {
+	case "import":
+		fs := newFlagSet("repo import", "[flags] SOURCE")
+		name := fs.String("name", "", "name of the imported repo (default: the name of SOURCE)")
+		move := fs.Bool("move", false, "move bare repos instead of copying them, when importing a directory of repos")
+		gl := fs.String("gitolite", "", "path to a checkout of the gitolite-admin repo to translate into users")
+		loadConfig := serverFlags(fs)
+		fs.Parse(args[1:]) // nolint: errcheck
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		src := fs.Arg(0)
+		ac := openConfig(loadConfig())
+		defer ac.DB.Close() // nolint: errcheck
+		// The imported repos are indexed for search in the background.
+		defer ac.Search.Wait()
+		if !isRepoDir(src) {
+			importRepos(ac, src, *move, *gl)
+			return
+		}
+		if *name == "" {
+			*name = git.RepoNameFromURL(src)
+		}
+		err := ac.ImportRepo(*name, src, "")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Imported %s as %s", src, *name)
+	default:
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  soft repo import [flags] SOURCE   import the repo at a path or URL, or\n")
+		fmt.Fprintf(os.Stderr, "                                    all repos in a directory\n")
+		if args[0] != "help" {
+			os.Exit(2)
+		}
+	}
+}
+
+// isRepoDir reports whether src is a repo rather than a directory of repos.
+// URLs are always repos.
+func isRepoDir(src string) bool {
+	fi, err := os.Stat(src)
+	if err != nil || !fi.IsDir() {
+		return true
+	}
+	return git.IsBareRepo(src) || git.IsBareRepo(filepath.Join(src, ".git"))
+}
+
+// importRepos imports all repos in dir. If gl is set, the users and access
+// rules of the gitolite-admin checkout at gl are translated too.
+func importRepos(ac *appCfg.Config, dir string, move bool, gl string) {
+	opts := appCfg.ImportOptions{Move: move}
+	if gl != "" {
+		gc, err := gitolite.Parse(gl)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, w := range gc.Warnings {
+			log.Printf("Warning: %s", w)
+		}
+		opts.Gitolite = gc
+	}
+	repos, err := git.FindRepos(dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(repos) == 0 {
+		log.Fatalf("No repos found in %s", dir)
+	}
+	err = ac.ImportRepos(repos, opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/server"
+)
+
+func runServe(args []string) {
+	fs := newFlagSet("serve", "[flags]")
+	loadConfig := serverFlags(fs)
+	fs.Parse(args) // nolint: errcheck
+	cfg := loadConfig()
+
+	s := server.NewServer(cfg)
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	log.Printf("Starting SSH server on %s:%d", cfg.Host, cfg.Port)
+	log.Printf("Starting HTTP server on %s:%d", cfg.Host, cfg.HTTPPort)
+	go func() {
+		if err := s.Start(); err != nil {
+			log.Fatalln(err)
+		}
+	}()
+
+	<-done
+
+	log.Printf("Stopping SSH server on %s:%d", cfg.Host, cfg.Port)
+	log.Printf("Stopping HTTP server on %s:%d", cfg.Host, cfg.HTTPPort)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer func() { cancel() }()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func runInit(args []string) {
+	fs := newFlagSet("init", "[flags]")
+	loadConfig := serverFlags(fs)
+	fs.Parse(args) // nolint: errcheck
+	cfg := loadConfig()
+
+	err := server.Init(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Initialized Soft Serve in %s", cfg.RepoPath)
+}
+
+func runMigrate(args []string) {
+	fs := newFlagSet("migrate", "[flags]")
+	loadConfig := serverFlags(fs)
+	fs.Parse(args) // nolint: errcheck
+	cfg := loadConfig()
+
+	d, err := db.Open(cfg.DBPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer d.Close() // nolint: errcheck
+	v, err := d.Version()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("Database %s is at version %d\n", cfg.DBPath, v)
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 
 	"github.com/meowgorithm/babyenv"
 )
@@ -20,8 +22,20 @@ type Config struct {
 	Port            int    `env:"SOFT_SERVE_PORT"`
 	KeyPath         string `env:"SOFT_SERVE_KEY_PATH"`
 	RepoPath        string `env:"SOFT_SERVE_REPO_PATH"`
+	DBPath          string `env:"SOFT_SERVE_DB_PATH"`
 	InitialAdminKey string `env:"SOFT_SERVE_INITIAL_ADMIN_KEY"`
-	Callbacks       Callbacks
+	HTTPPort        int    `env:"SOFT_SERVE_HTTP_PORT"`
+	// HTTPURL is the URL the HTTP server is reachable at, used in the links
+	// handed out to Git LFS clients.
+	HTTPURL   string `env:"SOFT_SERVE_HTTP_URL"`
+	Callbacks Callbacks
+
+	// File is the path of the config file the configuration was read from,
+	// if any.
+	File string
+	// RepoConfig is the contents of config.yaml declared in the config file.
+	// If set, it's committed to the config repo when the server starts.
+	RepoConfig []byte
 }
 
 func (c *Config) applyDefaults() {
@@ -35,18 +49,55 @@ func (c *Config) applyDefaults() {
 	if c.RepoPath == "" {
 		c.RepoPath = ".repos"
 	}
+	if c.DBPath == "" {
+		c.DBPath = "soft-serve.db"
+	}
+	if c.HTTPPort == 0 {
+		c.HTTPPort = 23232
+	}
+	if c.HTTPURL == "" {
+		host := c.Host
+		if host == "" || host == "0.0.0.0" {
+			host = "localhost"
+		}
+		c.HTTPURL = fmt.Sprintf("http://%s:%d", host, c.HTTPPort)
+	}
+	c.HTTPURL = strings.TrimSuffix(c.HTTPURL, "/")
 }
 
 // DefaultConfig returns a Config with the values populated with the defaults
 // or specified environment variables.
 func DefaultConfig() *Config {
-	var scfg Config
-	err := babyenv.Parse(&scfg)
+	scfg, err := LoadConfig("", nil)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	return scfg
+}
+
+// LoadConfig returns a Config read from the config file at path, if path isn't
+// empty, and the environment. The settings set in flags take precedence over
+// the environment, which takes precedence over the config file. Settings that
+// aren't set anywhere get their default values.
+func LoadConfig(path string, flags *Config) (*Config, error) {
+	var scfg Config
+	if path != "" {
+		err := scfg.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var env Config
+	err := babyenv.Parse(&env)
+	if err != nil {
+		return nil, err
+	}
+	scfg.merge(&env)
+	if flags != nil {
+		scfg.merge(flags)
+	}
 	scfg.applyDefaults()
-	return scfg.WithCallbacks(nil)
+	return scfg.WithCallbacks(nil), nil
 }
 
 // WithCallbacks applies the given Callbacks to the configuration.
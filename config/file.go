@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the format of the config file passed to soft with --config.
+// The config section holds the contents of config.yaml in the config repo.
+type fileConfig struct {
+	Host            string                 `yaml:"host" toml:"host"`
+	Port            int                    `yaml:"port" toml:"port"`
+	KeyPath         string                 `yaml:"key-path" toml:"key-path"`
+	RepoPath        string                 `yaml:"repo-path" toml:"repo-path"`
+	DBPath          string                 `yaml:"db-path" toml:"db-path"`
+	InitialAdminKey string                 `yaml:"initial-admin-key" toml:"initial-admin-key"`
+	HTTPPort        int                    `yaml:"http-port" toml:"http-port"`
+	HTTPURL         string                 `yaml:"http-url" toml:"http-url"`
+	Config          map[string]interface{} `yaml:"-" toml:"config"`
+	YAMLConfig      yaml.Node              `yaml:"config" toml:"-"`
+}
+
+// readFile reads the config file at path into cfg. Files ending in .toml are
+// read as TOML, other files as YAML.
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fc fileConfig
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		md, err := toml.Decode(string(data), &fc)
+		if err != nil {
+			return fmt.Errorf("bad toml in %s: %s", path, err)
+		}
+		for _, k := range md.Undecoded() {
+			if k[0] != "config" {
+				return fmt.Errorf("unknown setting %q in %s", k.String(), path)
+			}
+		}
+		if fc.Config != nil {
+			cfg.RepoConfig, err = yaml.Marshal(fc.Config)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&fc)
+		if err != nil {
+			return fmt.Errorf("bad yaml in %s: %s", path, err)
+		}
+		if fc.YAMLConfig.Kind != 0 {
+			cfg.RepoConfig, err = yaml.Marshal(&fc.YAMLConfig)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cfg.Host = fc.Host
+	cfg.Port = fc.Port
+	cfg.KeyPath = fc.KeyPath
+	cfg.RepoPath = fc.RepoPath
+	cfg.DBPath = fc.DBPath
+	cfg.InitialAdminKey = fc.InitialAdminKey
+	cfg.HTTPPort = fc.HTTPPort
+	cfg.HTTPURL = fc.HTTPURL
+	cfg.File = path
+	return nil
+}
+
+// merge sets the settings of cfg that are set in o.
+func (cfg *Config) merge(o *Config) {
+	if o.Host != "" {
+		cfg.Host = o.Host
+	}
+	if o.Port != 0 {
+		cfg.Port = o.Port
+	}
+	if o.KeyPath != "" {
+		cfg.KeyPath = o.KeyPath
+	}
+	if o.RepoPath != "" {
+		cfg.RepoPath = o.RepoPath
+	}
+	if o.DBPath != "" {
+		cfg.DBPath = o.DBPath
+	}
+	if o.InitialAdminKey != "" {
+		cfg.InitialAdminKey = o.InitialAdminKey
+	}
+	if o.HTTPPort != 0 {
+		cfg.HTTPPort = o.HTTPPort
+	}
+	if o.HTTPURL != "" {
+		cfg.HTTPURL = o.HTTPURL
+	}
+}
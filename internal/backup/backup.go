@@ -0,0 +1,483 @@
+// Package backup writes and restores snapshots of a whole Soft Serve server:
+// its repos, database and host key.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/config"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/lfs"
+)
+
+// Version is the version of the backup format.
+const Version = 1
+
+const (
+	manifestFile = "manifest.json"
+	dbFile       = "soft-serve.db"
+	reposDir     = "repos"
+	lfsDir       = "lfs"
+	hostKeyDir   = "host-key"
+)
+
+// Manifest describes the contents of a backup.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Repos   []Repo    `json:"repos"`
+	// HostKey lists the names of the host key files.
+	HostKey []string `json:"host-key"`
+}
+
+// Repo describes a repo in a backup.
+type Repo struct {
+	Name string `json:"name"`
+	// Head is the ref HEAD points to.
+	Head string `json:"head"`
+	// Refs maps the refs of the repo to the objects they point to. Repos
+	// without refs don't have a bundle.
+	Refs map[string]string `json:"refs"`
+}
+
+// Backup writes a gzipped tar archive of every repo in rs, the database, the
+// Git LFS objects and the host key at keyPath to w. Each repo is written as a git bundle, which is
+// taken from a snapshot of its refs, and the database is copied in a read
+// transaction, so the server can keep running while the backup is taken. The
+// manifest lists the ref tips of every repo.
+func Backup(w io.Writer, rs *git.RepoSource, d *db.DB, keyPath string) error {
+	tmp, err := os.MkdirTemp("", "soft-serve-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp) // nolint: errcheck
+
+	m := &Manifest{
+		Version: Version,
+		Created: time.Now().UTC(),
+		Repos:   make([]Repo, 0),
+		HostKey: make([]string, 0),
+	}
+	for _, r := range rs.AllRepos() {
+		br, err := bundleRepo(rs, r.Name, tmp)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		m.Repos = append(m.Repos, *br)
+	}
+	sort.Slice(m.Repos, func(i, j int) bool {
+		return m.Repos[i].Name < m.Repos[j].Name
+	})
+	f, err := os.Create(filepath.Join(tmp, dbFile))
+	if err != nil {
+		return err
+	}
+	err = d.Snapshot(f)
+	if err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	for _, kp := range []string{keyPath, keyPath + ".pub"} {
+		if _, err := os.Stat(kp); err == nil {
+			m.HostKey = append(m.HostKey, filepath.Base(kp))
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	mj, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeEntry(tw, manifestFile, 0600, mj)
+	if err != nil {
+		return err
+	}
+	for _, r := range m.Repos {
+		if len(r.Refs) == 0 {
+			continue
+		}
+		err = copyEntry(tw, path.Join(reposDir, r.Name+".bundle"), filepath.Join(tmp, r.Name+".bundle"))
+		if err != nil {
+			return err
+		}
+	}
+	err = copyEntry(tw, dbFile, filepath.Join(tmp, dbFile))
+	if err != nil {
+		return err
+	}
+	for _, n := range m.HostKey {
+		err = copyEntry(tw, path.Join(hostKeyDir, n), filepath.Join(filepath.Dir(keyPath), n))
+		if err != nil {
+			return err
+		}
+	}
+	// LFS objects are never modified once stored, so they can be copied as
+	// they are.
+	st := lfs.NewStore(rs.Path)
+	oids, err := st.Objects()
+	if err != nil {
+		return err
+	}
+	for _, oid := range oids {
+		f, err := st.Open(oid)
+		if err != nil {
+			return err
+		}
+		err = copyEntry(tw, path.Join(lfsDir, oid), f.Name())
+		f.Close() // nolint: errcheck
+		if err != nil {
+			return err
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// bundleRepo bundles a repo into dir and returns its description.
+func bundleRepo(rs *git.RepoSource, name string, dir string) (*Repo, error) {
+	_, head, err := rs.Refs(name)
+	if err != nil {
+		return nil, err
+	}
+	r := &Repo{Name: name, Head: head, Refs: make(map[string]string)}
+	bp := filepath.Join(dir, name+".bundle")
+	f, err := os.Create(bp)
+	if err != nil {
+		return nil, err
+	}
+	err = rs.CreateBundle(name, f)
+	f.Close() // nolint: errcheck
+	if errors.Is(err, git.ErrEmptyRepo) {
+		return r, os.Remove(bp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The refs are read from the bundle, so they match its contents even if
+	// the repo was pushed to in the meantime.
+	r.Refs, err = git.BundleHeads(bp)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Options are the options of Restore.
+type Options struct {
+	// Force replaces existing repos, the database and the host key.
+	// Otherwise restoring fails if any of them exist.
+	Force bool
+}
+
+// Restore restores a backup written by Backup into the repo path, database
+// path and host key path of cfg, and verifies that the refs of the restored
+// repos match the manifest. The server must not be running.
+//
+// The repos are restored next to the existing ones and only moved into place
+// once all of them, the LFS objects and the database were restored, so that
+// a failed restore leaves the existing repos as they were.
+func Restore(r io.Reader, cfg *config.Config, opts Options) (*Manifest, error) {
+	tmp, err := os.MkdirTemp("", "soft-serve-restore")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp) // nolint: errcheck
+	err = extract(r, tmp)
+	if err != nil {
+		return nil, err
+	}
+	mj, err := os.ReadFile(filepath.Join(tmp, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("not a Soft Serve backup: %w", err)
+	}
+	var m Manifest
+	err = json.Unmarshal(mj, &m)
+	if err != nil {
+		return nil, fmt.Errorf("bad manifest: %w", err)
+	}
+	if m.Version > Version {
+		return nil, fmt.Errorf("backup version %d is newer than the supported version %d", m.Version, Version)
+	}
+
+	// The database is locked if a server is running.
+	if _, err := os.Stat(cfg.DBPath); err == nil {
+		if !opts.Force {
+			return nil, fmt.Errorf("database %s already exists", cfg.DBPath)
+		}
+		err = db.CheckUnlocked(cfg.DBPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range m.HostKey {
+		kp := filepath.Join(filepath.Dir(cfg.KeyPath), n)
+		if _, err := os.Stat(kp); err == nil && !opts.Force {
+			return nil, fmt.Errorf("host key %s already exists", kp)
+		}
+	}
+	for _, br := range m.Repos {
+		if !git.ValidRepoName(br.Name) {
+			return nil, fmt.Errorf("invalid repo name %q in manifest", br.Name)
+		}
+		rp := filepath.Join(cfg.RepoPath, br.Name)
+		if _, err := os.Stat(rp); err == nil && !opts.Force {
+			return nil, fmt.Errorf("repo %s already exists", rp)
+		}
+	}
+
+	// The repos are staged in a hidden directory of the repo path, which the
+	// server skips, so that they can be renamed into place.
+	err = os.MkdirAll(cfg.RepoPath, os.ModeDir|os.FileMode(0700))
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(cfg.RepoPath, ".restore")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging) // nolint: errcheck
+	rs := git.NewRepoSource(staging)
+	for _, br := range m.Repos {
+		err = restoreRepo(rs, br, filepath.Join(tmp, reposDir, br.Name+".bundle"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", br.Name, err)
+		}
+		log.Printf("Restored %s (%d refs)", br.Name, len(br.Refs))
+	}
+	err = restoreLFS(lfs.NewStore(cfg.RepoPath), filepath.Join(tmp, lfsDir))
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(cfg.DBPath), os.ModeDir|os.FileMode(0700))
+	if err != nil {
+		return nil, err
+	}
+	err = replaceFile(cfg.DBPath, filepath.Join(tmp, dbFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(m.HostKey) > 0 {
+		err = os.MkdirAll(filepath.Dir(cfg.KeyPath), os.ModeDir|os.FileMode(0700))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range m.HostKey {
+		err = replaceFile(filepath.Join(filepath.Dir(cfg.KeyPath), n), filepath.Join(tmp, hostKeyDir, n))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Existing repos are moved out of the way into the staging directory,
+	// which is removed along with them.
+	old := filepath.Join(staging, ".old")
+	err = os.Mkdir(old, 0700)
+	if err != nil {
+		return nil, err
+	}
+	for _, br := range m.Repos {
+		rp := filepath.Join(cfg.RepoPath, br.Name)
+		if _, err := os.Stat(rp); err == nil {
+			err = os.Rename(rp, filepath.Join(old, br.Name))
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = os.Rename(filepath.Join(staging, br.Name), rp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &m, nil
+}
+
+// replaceFile replaces dst with a copy of src. The copy is written next to
+// dst and renamed over it, so dst is never left half written.
+func replaceFile(dst string, src string) error {
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = copyFile(f.Name(), src, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+// restoreRepo restores a repo from its bundle and verifies its refs.
+func restoreRepo(rs *git.RepoSource, br Repo, bundle string) error {
+	if len(br.Refs) == 0 {
+		return rs.InitBareRepo(br.Name, br.Head)
+	}
+	err := rs.FetchBundle(br.Name, bundle, br.Head)
+	if err != nil {
+		return err
+	}
+	refs, _, err := rs.Refs(br.Name)
+	if err != nil {
+		return err
+	}
+	for ref, h := range br.Refs {
+		if refs[ref] != h {
+			return fmt.Errorf("ref %s is at %q, expected %s", ref, refs[ref], h)
+		}
+	}
+	for ref := range refs {
+		if _, ok := br.Refs[ref]; !ok {
+			return fmt.Errorf("unexpected ref %s", ref)
+		}
+	}
+	return nil
+}
+
+// restoreLFS stores the LFS objects in dir, checking their content against
+// their IDs.
+func restoreLFS(st *lfs.Store, dir string) error {
+	des, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, de := range des {
+		if !lfs.ValidOID(de.Name()) {
+			return fmt.Errorf("invalid LFS object %q in backup", de.Name())
+		}
+		f, err := os.Open(filepath.Join(dir, de.Name()))
+		if err != nil {
+			return err
+		}
+		_, err = st.Put(de.Name(), f)
+		f.Close() // nolint: errcheck
+		if err != nil {
+			return err
+		}
+	}
+	if len(des) > 0 {
+		log.Printf("Restored %d LFS objects", len(des))
+	}
+	return nil
+}
+
+// extract extracts a gzipped tar archive into dir.
+func extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		n := path.Clean(h.Name)
+		if path.IsAbs(n) || n == ".." || strings.HasPrefix(n, "../") {
+			return fmt.Errorf("invalid path %q in backup", h.Name)
+		}
+		fp := filepath.Join(dir, filepath.FromSlash(n))
+		err = os.MkdirAll(filepath.Dir(fp), os.ModeDir|os.FileMode(0700))
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr) // nolint: gosec
+		f.Close()               // nolint: errcheck
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeEntry(tw *tar.Writer, name string, mode int64, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+func copyEntry(tw *tar.Writer, name string, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func copyFile(dst string, src string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() // nolint: errcheck
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close() // nolint: errcheck
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/limit"
+	"github.com/charmbracelet/soft-serve/internal/maintenance"
+	"github.com/charmbracelet/wish"
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/gliderlabs/ssh"
+)
+
+// command is a command that can be run over SSH, for example
+// `ssh soft config log`.
+type command struct {
+	// name is the command name, made of a group and a verb, or of a single
+	// word for commands taking arguments, such as search.
+	name string
+	args string
+	help string
+	// access is the access to the config repo needed to run the command.
+	// Commands working on other repos check the access to those themselves.
+	access gm.AccessLevel
+	run    func(ctx *context, args []string) error
+}
+
+// context is passed to running commands.
+type context struct {
+	cfg         *config.Config
+	maintenance *maintenance.Scheduler
+	limiter     *limit.Limiter
+	session     ssh.Session
+	// user is the name of the user running the command, or config.Anonymous.
+	user string
+}
+
+func (ctx *context) Write(p []byte) (int, error) {
+	return ctx.session.Write(p)
+}
+
+// Stderr returns the writer for errors and diagnostics.
+func (ctx *context) Stderr() io.Writer {
+	return ctx.session.Stderr()
+}
+
+// authRepo checks that the user has at least the given access to a repo.
+func (ctx *context) authRepo(repo string, access gm.AccessLevel) error {
+	if ctx.cfg.AuthRepo(repo, ctx.session.PublicKey()) < access {
+		return gm.ErrNotAuthed
+	}
+	return nil
+}
+
+var commands = make(map[string]*command)
+
+func register(c *command) {
+	commands[c.name] = c
+}
+
+// Middleware handles the Soft Serve commands that can be run over SSH. Sessions
+// that don't run one of these commands are passed on to the next handler. ms
+// maintains the repos and lim enforces the limits on clients.
+func Middleware(cfg *config.Config, ms *maintenance.Scheduler, lim *limit.Limiter) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			args := s.Command()
+			if len(args) < 2 {
+				sh(s)
+				return
+			}
+			c, args := lookup(args)
+			if c == nil {
+				if args[1] == "help" && hasGroup(args[0]) {
+					usage(s, args[0])
+					return
+				}
+				sh(s)
+				return
+			}
+			ctx := &context{
+				cfg:         cfg,
+				maintenance: ms,
+				limiter:     lim,
+				session:     s,
+				user:        cfg.UserName(s.PublicKey()),
+			}
+			if cfg.AuthRepo("config", s.PublicKey()) < c.access {
+				fatal(s, gm.ErrNotAuthed)
+				return
+			}
+			err := c.run(ctx, args)
+			if err != nil {
+				fatal(s, err)
+				return
+			}
+			_ = s.Exit(0)
+		}
+	}
+}
+
+// lookup returns the command run by args, and its arguments. Single-word
+// commands are only looked up with arguments, so that `ssh soft NAME` still
+// opens the repo NAME in the TUI.
+func lookup(args []string) (*command, []string) {
+	if c, ok := commands[args[0]+" "+args[1]]; ok {
+		return c, args[2:]
+	}
+	if c, ok := commands[args[0]]; ok {
+		return c, args[1:]
+	}
+	return nil, args
+}
+
+func hasGroup(group string) bool {
+	for n := range commands {
+		if strings.HasPrefix(n, group+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func usage(s ssh.Session, group string) {
+	names := make([]string, 0)
+	for n := range commands {
+		if strings.HasPrefix(n, group+" ") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintln(s, "Commands:")
+	for _, n := range names {
+		c := commands[n]
+		fmt.Fprintf(s, "  %-32s %s\n", strings.TrimSpace(n+" "+c.args), c.help)
+	}
+	_ = s.Exit(0)
+}
+
+func fatal(s ssh.Session, err error) {
+	fmt.Fprintf(s.Stderr(), "error: %s\n", err)
+	_ = s.Exit(1)
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
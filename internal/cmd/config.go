@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	register(&command{
+		name:   "config log",
+		args:   "[limit]",
+		help:   "Show the history of config.yaml",
+		access: gm.ReadWriteAccess,
+		run:    configLog,
+	})
+	register(&command{
+		name:   "config rollback",
+		args:   "<commit>",
+		help:   "Restore config.yaml as of a previous commit",
+		access: gm.ReadWriteAccess,
+		run:    configRollback,
+	})
+}
+
+func configLog(ctx *context, args []string) error {
+	limit := 20
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid limit %q", args[0])
+		}
+		limit = n
+	}
+	cs, err := ctx.cfg.History(limit)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		cur := " "
+		if c.Current {
+			cur = "*"
+		}
+		fmt.Fprintf(ctx, "%s %s %-16s %-14s %s\n", cur, c.Hash[:7], c.Author, humanize.Time(c.When), firstLine(c.Message))
+	}
+	return nil
+}
+
+func configRollback(ctx *context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: config rollback <commit>")
+	}
+	h, err := ctx.cfg.Rollback(args[0], ctx.user)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx, "Rolled back config.yaml to %s\n", h[:7])
+	return nil
+}
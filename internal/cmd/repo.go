@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	register(&command{
+		name:   "repo bundle",
+		args:   "<repo> [refs...]",
+		help:   "Write a git bundle of a repo to stdout",
+		access: gm.NoAccess,
+		run:    repoBundle,
+	})
+	register(&command{
+		name:   "repo unbundle",
+		args:   "<repo>",
+		help:   "Fetch a git bundle from stdin into a new or existing repo",
+		access: gm.NoAccess,
+		run:    repoUnbundle,
+	})
+	register(&command{
+		name:   "repo lfs",
+		args:   "<repo>",
+		help:   "Show the Git LFS storage and file locks of a repo",
+		access: gm.NoAccess,
+		run:    repoLFS,
+	})
+	register(&command{
+		name:   "repo usage",
+		help:   "Show the storage used by every repo and user",
+		access: gm.AdminAccess,
+		run:    repoUsage,
+	})
+	register(&command{
+		name:   "repo maintenance",
+		args:   "[repo]",
+		help:   "Show the last maintenance run and storage stats of the repos",
+		access: gm.AdminAccess,
+		run:    repoMaintenance,
+	})
+	register(&command{
+		name:   "repo maintain",
+		args:   "<repo>",
+		help:   "Maintain a repo now",
+		access: gm.AdminAccess,
+		run:    repoMaintain,
+	})
+}
+
+func repoBundle(ctx *context, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: repo bundle <repo> [refs...] > FILE")
+	}
+	repo := args[0]
+	err := ctx.authRepo(repo, gm.ReadOnlyAccess)
+	if err != nil {
+		return err
+	}
+	if _, err := ctx.cfg.Source.GetRepo(repo); err != nil {
+		return fmt.Errorf("%w: %s", err, repo)
+	}
+	refs := args[1:]
+	for _, r := range refs {
+		if strings.HasPrefix(r, "-") {
+			return fmt.Errorf("invalid ref %q", r)
+		}
+	}
+	err = ctx.cfg.Source.CreateBundle(repo, ctx, refs...)
+	if err != nil {
+		return err
+	}
+	ctx.cfg.Fetch(repo, ctx.session.PublicKey())
+	return nil
+}
+
+func repoUnbundle(ctx *context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: repo unbundle <repo> < FILE")
+	}
+	repo := args[0]
+	if repo == "config" {
+		return fmt.Errorf("the config repo can only be updated with git push")
+	}
+	if !git.ValidRepoName(repo) {
+		return fmt.Errorf("invalid repo name %q", repo)
+	}
+	err := ctx.authRepo(repo, gm.ReadWriteAccess)
+	if err != nil {
+		return err
+	}
+	l, err := ctx.cfg.QuotaLimits(repo, ctx.cfg.UserName(ctx.session.PublicKey()))
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "soft-serve-unbundle")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	// A bundle bigger than what's left of the quotas can't fit, so it isn't
+	// read any further.
+	var r io.Reader = ctx.session
+	room := l.Room()
+	if room >= 0 {
+		r = io.LimitReader(r, room+1)
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close() // nolint: errcheck
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	if room >= 0 && n > room {
+		return l.Check(n)
+	}
+	refs, err := git.BundleHeads(f.Name())
+	if err != nil {
+		return fmt.Errorf("stdin isn't a valid git bundle")
+	}
+	// The bundle is received like a push, so the pre-receive hook checks it
+	// against the quotas.
+	us, err := ctx.cfg.Source.PushBundle(repo, f.Name(), l.Env())
+	if err != nil {
+		return err
+	}
+	ctx.cfg.Pushed(repo, ctx.session.PublicKey(), us)
+	ctx.maintenance.Pushed(repo)
+	fmt.Fprintf(ctx.Stderr(), "Fetched %d refs into %s\n", len(refs), repo)
+	return nil
+}
+
+func repoLFS(ctx *context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: repo lfs <repo>")
+	}
+	repo := args[0]
+	err := ctx.authRepo(repo, gm.ReadOnlyAccess)
+	if err != nil {
+		return err
+	}
+	u, err := ctx.cfg.DB.LFSUsage(repo)
+	if err != nil {
+		return err
+	}
+	ls, err := ctx.cfg.DB.LFSLocks(repo)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx, "Objects: %d (%s)\n", u.Objects, size(u.Size))
+	fmt.Fprintf(ctx, "Locks: %d\n", len(ls))
+	for _, l := range ls {
+		fmt.Fprintf(ctx, "  %-6s %-40s %s, %s\n", l.ID, l.Path, l.Owner, humanize.Time(l.LockedAt))
+	}
+	return nil
+}
+
+func repoUsage(ctx *context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: repo usage")
+	}
+	q, err := ctx.cfg.QuotaSizes()
+	if err != nil {
+		return err
+	}
+	us, err := ctx.cfg.RepoUsage()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx, "%-32s %-16s %10s %10s %10s %10s\n", "REPO", "CREATED BY", "GIT", "LFS", "TOTAL", "QUOTA")
+	users := make(map[string]int64)
+	names := make([]string, 0)
+	for _, u := range us {
+		fmt.Fprintf(ctx, "%-32s %-16s %10s %10s %10s %10s\n", u.Name, u.CreatedBy, size(u.GitSize), size(u.LFSSize), size(u.Size()), quota(q.MaxRepoSize))
+		if u.CreatedBy == "" || u.CreatedBy == config.Anonymous {
+			continue
+		}
+		if _, ok := users[u.CreatedBy]; !ok {
+			names = append(names, u.CreatedBy)
+		}
+		users[u.CreatedBy] += u.Size()
+	}
+	sort.Strings(names)
+	fmt.Fprintf(ctx, "\n%-32s %10s %10s\n", "USER", "TOTAL", "QUOTA")
+	for _, n := range names {
+		fmt.Fprintf(ctx, "%-32s %10s %10s\n", n, size(users[n]), quota(q.MaxUserSize))
+	}
+	if q.MaxObjectSize > 0 {
+		fmt.Fprintf(ctx, "\nMaximum object size: %s\n", size(q.MaxObjectSize))
+	}
+	return nil
+}
+
+func repoMaintenance(ctx *context, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: repo maintenance [repo]")
+	}
+	runs, err := ctx.cfg.DB.LastMaintenanceRuns()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return repoMaintenanceDetails(ctx, args[0], runs[args[0]])
+	}
+	rs := ctx.cfg.Source.AllRepos()
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+	fmt.Fprintf(ctx, "%-32s %8s %6s %10s %7s  %s\n", "REPO", "LOOSE", "PACKS", "SIZE", "PUSHES", "LAST RUN")
+	for _, r := range rs {
+		st, err := ctx.cfg.Source.Stats(r.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctx, "%-32s %8d %6d %10s %7d  %s\n", r.Name, st.LooseObjects, st.Packs, size(r.Size), ctx.maintenance.Pushes(r.Name), lastRun(runs[r.Name]))
+	}
+	return nil
+}
+
+func repoMaintenanceDetails(ctx *context, repo string, r *db.MaintenanceRun) error {
+	if _, err := ctx.cfg.Source.GetRepo(repo); err != nil {
+		return fmt.Errorf("%w: %s", err, repo)
+	}
+	st, err := ctx.cfg.Source.Stats(repo)
+	if err != nil {
+		return err
+	}
+	ms := ctx.cfg.MaintenanceSettings()
+	fmt.Fprintf(ctx, "Loose objects:  %d (%s), maintained from %d\n", st.LooseObjects, size(st.LooseSize), ms.LooseObjects)
+	fmt.Fprintf(ctx, "Packed objects: %d in %d packs (%s)\n", st.PackedObjects, st.Packs, size(st.PackSize))
+	fmt.Fprintf(ctx, "Garbage files:  %d\n", st.Garbage)
+	fmt.Fprintf(ctx, "Commit-graph:   %t\n", st.CommitGraph)
+	fmt.Fprintf(ctx, "Pushes:         %d, maintained from %d\n", ctx.maintenance.Pushes(repo), ms.Pushes)
+	if ms.Disabled {
+		fmt.Fprintf(ctx, "Maintenance:    disabled\n")
+	} else if ctx.maintenance.Scheduled(repo) {
+		fmt.Fprintf(ctx, "Maintenance:    scheduled\n")
+	}
+	fmt.Fprintf(ctx, "Last run:       %s\n", lastRun(r))
+	if r != nil {
+		fmt.Fprintf(ctx, "Duration:       %s\n", r.Duration.Round(time.Millisecond))
+		fmt.Fprintf(ctx, "Size:           %s before, %s after\n", size(r.SizeBefore), size(r.SizeAfter))
+		if r.Error != "" {
+			fmt.Fprintf(ctx, "Error:          %s\n", r.Error)
+		}
+	}
+	return nil
+}
+
+func repoMaintain(ctx *context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: repo maintain <repo>")
+	}
+	repo := args[0]
+	if _, err := ctx.cfg.Source.GetRepo(repo); err != nil {
+		return fmt.Errorf("%w: %s", err, repo)
+	}
+	r, err := ctx.maintenance.Run(repo)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx, "Maintained %s in %s, %s before, %s after\n", repo, r.Duration.Round(time.Millisecond), size(r.SizeBefore), size(r.SizeAfter))
+	return nil
+}
+
+// lastRun describes the last maintenance run of a repo.
+func lastRun(r *db.MaintenanceRun) string {
+	if r == nil {
+		return "never"
+	}
+	s := fmt.Sprintf("%s (%s)", humanize.Time(r.StartedAt), r.Trigger)
+	if r.Error != "" {
+		s += ", failed"
+	}
+	return s
+}
+
+func size(n int64) string {
+	return humanize.Bytes(uint64(n))
+}
+
+// quota formats a quota, where 0 is unlimited.
+func quota(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return size(n)
+}
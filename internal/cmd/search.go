@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/soft-serve/internal/search"
+	gm "github.com/charmbracelet/wish/git"
+)
+
+func init() {
+	register(&command{
+		name:   "search",
+		args:   "<query> [--repo REPO] [--regex]",
+		help:   "Search the files of the default branch of the repos",
+		access: gm.NoAccess,
+		run:    searchRepos,
+	})
+}
+
+const searchUsage = "usage: search <query> [--repo REPO] [--regex]"
+
+func searchRepos(ctx *context, args []string) error {
+	q := search.Query{}
+	words := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--regex":
+			q.Regex = true
+		case a == "--repo":
+			if i+1 == len(args) {
+				return fmt.Errorf(searchUsage)
+			}
+			i++
+			q.Repo = args[i]
+		case strings.HasPrefix(a, "--repo="):
+			q.Repo = strings.TrimPrefix(a, "--repo=")
+		default:
+			// The words of the query are joined, as ssh doesn't keep
+			// quotes.
+			words = append(words, a)
+		}
+	}
+	q.Pattern = strings.Join(words, " ")
+	if q.Pattern == "" {
+		return fmt.Errorf(searchUsage)
+	}
+	if q.Repo != "" {
+		err := ctx.authRepo(q.Repo, gm.ReadOnlyAccess)
+		if err != nil {
+			return err
+		}
+		if _, err := ctx.cfg.Source.GetRepo(q.Repo); err != nil {
+			return fmt.Errorf("%w: %s", err, q.Repo)
+		}
+	}
+	res, err := ctx.cfg.SearchRepos(q, ctx.session.PublicKey())
+	if err != nil {
+		return err
+	}
+	for _, m := range res.Matches {
+		fmt.Fprintf(ctx, "%s:%s:%d: %s\n", m.Repo, printable(m.Path), m.Line, printable(m.Text))
+	}
+	if res.More {
+		fmt.Fprintf(ctx.Stderr(), "Only the first %d matches are shown.\n", len(res.Matches))
+	} else if len(res.Matches) == 0 {
+		fmt.Fprintln(ctx.Stderr(), "No matches.")
+	}
+	return nil
+}
+
+// printable replaces the control characters of s but tabs, so that the files
+// searched can't send escape sequences to the terminal of the client.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return '�'
+		}
+		return r
+	}, strings.ToValidUTF8(s, "�"))
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/charmbracelet/soft-serve/internal/backup"
+	"github.com/charmbracelet/soft-serve/internal/limit"
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	register(&command{
+		name:   "server backup",
+		help:   "Write a backup of the whole server to stdout",
+		access: gm.AdminAccess,
+		run:    serverBackup,
+	})
+	register(&command{
+		name:   "server limits",
+		help:   "Show the limits on clients, the throttled requests and the locked out addresses",
+		access: gm.AdminAccess,
+		run:    serverLimits,
+	})
+	register(&command{
+		name:   "server unlock",
+		args:   "<ip>",
+		help:   "Lift the lockout of an IP address",
+		access: gm.AdminAccess,
+		run:    serverUnlock,
+	})
+}
+
+func serverBackup(ctx *context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: server backup > FILE")
+	}
+	return backup.Backup(ctx, ctx.cfg.Source, ctx.cfg.DB, ctx.cfg.Cfg.KeyPath)
+}
+
+func serverLimits(ctx *context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: server limits")
+	}
+	ls := ctx.cfg.LimitSettings()
+	fmt.Fprintf(ctx, "%-20s %s\n", "max sessions", limitValue(ls.MaxSessions))
+	fmt.Fprintf(ctx, "%-20s %s\n", "git per minute", limitValue(ls.GitPerMinute))
+	fmt.Fprintf(ctx, "%-20s %s\n", "auth failures", limitValue(ls.AuthFailures))
+	fmt.Fprintf(ctx, "%-20s %s\n", "lockout", ls.Lockout)
+
+	m := limit.Metrics()
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(ctx, "\n%-24s %10s\n", "THROTTLED", "COUNT")
+	for _, n := range names {
+		fmt.Fprintf(ctx, "%-24s %10d\n", n, m[n])
+	}
+
+	cs := ctx.limiter.Clients()
+	if len(cs) > 0 {
+		fmt.Fprintf(ctx, "\n%-72s %8s %9s\n", "CLIENT", "SESSIONS", "GIT LEFT")
+		for _, c := range cs {
+			left := "unlimited"
+			if c.GitLeft >= 0 {
+				left = fmt.Sprint(c.GitLeft)
+			}
+			fmt.Fprintf(ctx, "%-72s %8d %9s\n", c.Name, c.Sessions, left)
+		}
+	}
+	lo := ctx.limiter.Lockouts()
+	if len(lo) > 0 {
+		fmt.Fprintf(ctx, "\n%-40s %8s  %s\n", "LOCKED OUT", "LOCKOUTS", "UNTIL")
+		for _, l := range lo {
+			fmt.Fprintf(ctx, "%-40s %8d  %s\n", l.IP, l.Lockouts, humanize.Time(l.Until))
+		}
+	}
+	return nil
+}
+
+// limitValue formats a limit, which is unlimited if it isn't positive.
+func limitValue(n int) string {
+	if n <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(n)
+}
+
+func serverUnlock(ctx *context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: server unlock <ip>")
+	}
+	if !ctx.limiter.Unlock(args[0]) {
+		return fmt.Errorf("%s isn't locked out", args[0])
+	}
+	fmt.Fprintf(ctx, "Unlocked %s\n", args[0])
+	return nil
+}
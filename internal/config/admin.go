@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/events"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUserExists indicates that a user with the same name is already declared
+// in config.yaml.
+var ErrUserExists = errors.New("user already exists")
+
+// ErrUnknownUser indicates that a user isn't declared in config.yaml.
+var ErrUnknownUser = errors.New("unknown user")
+
+// AddUser declares a new user in config.yaml and commits it to the config
+// repo. Comments and formatting of config.yaml are kept.
+func (cfg *Config) AddUser(name string, admin bool, keys []string) error {
+	return cfg.editConfig(fmt.Sprintf("Add user %s", name), func(doc *yaml.Node) error {
+		users := sequenceValue(doc, "users")
+		if userNode(users, name) != nil {
+			return fmt.Errorf("%w: %s", ErrUserExists, name)
+		}
+		un := &yaml.Node{Kind: yaml.MappingNode}
+		setMappingValue(un, "name", stringNode(name))
+		if admin {
+			setMappingValue(un, "admin", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+		}
+		if len(keys) > 0 {
+			kn := sequenceValue(un, "public-keys")
+			for _, k := range keys {
+				appendString(kn, strings.TrimSpace(k))
+			}
+		}
+		users.Content = append(users.Content, un)
+		return nil
+	})
+}
+
+// AddKey adds a public key to a user declared in config.yaml and commits it to
+// the config repo.
+func (cfg *Config) AddKey(name string, key string) error {
+	return cfg.editConfig(fmt.Sprintf("Add public key of user %s", name), func(doc *yaml.Node) error {
+		un := userNode(mappingValue(doc, "users"), name)
+		if un == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownUser, name)
+		}
+		if !appendString(sequenceValue(un, "public-keys"), strings.TrimSpace(key)) {
+			return fmt.Errorf("user %s already has this key", name)
+		}
+		return nil
+	})
+}
+
+// ImportRepo imports the repo at url, which can be a local path or any URL
+// git can clone from, into the repos directory and records it in the
+// database. All refs are copied from local bare repos.
+func (cfg *Config) ImportRepo(name string, url string, user string) error {
+	err := cfg.Source.ImportRepo(name, url, git.IsBareRepo(url))
+	if err != nil {
+		return err
+	}
+	_, err = cfg.DB.AddRepo(&db.Repo{Name: name, CreatedBy: user})
+	if err != nil {
+		return err
+	}
+	cfg.updateSearch(name)
+	cfg.Events.Publish(events.Event{Type: events.Create, Repo: name})
+	return nil
+}
+
+// editConfig applies edit to the document of config.yaml at the head of the
+// config repo, validates the result and commits it with the given message.
+func (cfg *Config) editConfig(msg string, edit func(doc *yaml.Node) error) error {
+	cs, err := cfg.editedConfig(edit, nil)
+	if err != nil {
+		return err
+	}
+	err = cfg.commitFile("config.yaml", cs, msg)
+	if err != nil {
+		return err
+	}
+	err = cfg.Source.UpdateRepo("config")
+	if err != nil {
+		return err
+	}
+	cfg.updateSearch("config")
+	return cfg.readConfig()
+}
+
+// editedConfig applies edit to the document of config.yaml at the head of the
+// config repo and returns the validated result. References to repos are
+// checked against the repos on disk and extraRepos.
+func (cfg *Config) editedConfig(edit func(doc *yaml.Node) error, extraRepos []string) (string, error) {
+	cr, err := cfg.Source.GetRepo("config")
+	if err != nil {
+		return "", err
+	}
+	cs, err := cr.LatestFile("config.yaml")
+	if err != nil {
+		return "", err
+	}
+	var root yaml.Node
+	err = yaml.Unmarshal([]byte(cs), &root)
+	if err != nil {
+		return "", fmt.Errorf("bad yaml in config.yaml: %s", err)
+	}
+	if len(root.Content) == 0 {
+		root.Kind = yaml.DocumentNode
+		root.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("config.yaml isn't a mapping")
+	}
+	err = edit(doc)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err = enc.Encode(&root)
+	if err != nil {
+		return "", err
+	}
+	err = enc.Close()
+	if err != nil {
+		return "", err
+	}
+	repos := append([]string{}, extraRepos...)
+	for _, r := range cfg.Source.AllRepos() {
+		repos = append(repos, r.Name)
+	}
+	err = ValidateConfig(buf.Bytes(), repos)
+	if err != nil {
+		return "", fmt.Errorf("the edited config.yaml is invalid:\n%w", err)
+	}
+	return buf.String(), nil
+}
+
+// userNode returns the node of the user with the given name in the users of
+// config.yaml, or nil.
+func userNode(users *yaml.Node, name string) *yaml.Node {
+	for _, un := range sequenceItems(users) {
+		if n := mappingValue(un, "name"); n != nil && n.Value == name {
+			return un
+		}
+	}
+	return nil
+}
+
+// sequenceValue returns the sequence node of key in mapping node n, adding an
+// empty one if it isn't set.
+func sequenceValue(n *yaml.Node, key string) *yaml.Node {
+	v := mappingValue(n, key)
+	if v == nil || v.Kind != yaml.SequenceNode {
+		v = &yaml.Node{Kind: yaml.SequenceNode}
+		setMappingValue(n, key, v)
+	}
+	return v
+}
+
+// appendString appends s to sequence node n, unless it's already in it. It
+// reports whether s was appended.
+func appendString(n *yaml.Node, s string) bool {
+	for _, v := range n.Content {
+		if strings.TrimSpace(v.Value) == s {
+			return false
+		}
+	}
+	n.Content = append(n.Content, stringNode(s))
+	return true
+}
+
+// setMappingValue sets the value of key in mapping node n, appending the key
+// if it isn't set yet.
+func setMappingValue(n *yaml.Node, key string, v *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = v
+			return
+		}
+	}
+	n.Content = append(n.Content, stringNode(key), v)
+}
+
+func stringNode(s string) *yaml.Node {
+	n := &yaml.Node{}
+	n.SetString(s)
+	return n
+}
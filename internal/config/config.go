@@ -1,34 +1,61 @@
 package config
 
 import (
-	"github.com/charmbracelet/soft-serve/pkg/webhooks"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
-	"gopkg.in/yaml.v2"
-
-	"fmt"
-	"os"
+	"github.com/charmbracelet/soft-serve/pkg/webhooks"
+	"gopkg.in/yaml.v3"
 
 	"github.com/charmbracelet/soft-serve/config"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/events"
 	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/search"
 	gg "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 // Config is the Soft Serve configuration.
 type Config struct {
-	Name         string   `yaml:"name"`
-	Host         string   `yaml:"host"`
-	Port         int      `yaml:"port"`
-	AnonAccess   string   `yaml:"anon-access"`
-	AllowKeyless bool     `yaml:"allow-keyless"`
-	Users        []User   `yaml:"users"`
-	Repos        []Repo   `yaml:"repos"`
-	Webhooks     Webhooks `yaml:"webhooks"`
-	Source       *git.RepoSource
-	Cfg          *config.Config
+	YAMLConfig `yaml:",inline"`
+	Source     *git.RepoSource `yaml:"-"`
+	Cfg        *config.Config  `yaml:"-"`
+	DB         *db.DB          `yaml:"-"`
+	// Events is told about pushes, new repos and reloads.
+	Events *events.Bus `yaml:"-"`
+	// Search is the index of the files of the default branch of the repos.
+	Search *search.Index `yaml:"-"`
+
+	// mtx guards YAMLConfig and commit, which are swapped as a whole when
+	// the configuration is reloaded.
+	mtx    sync.RWMutex
+	commit string
+}
+
+// YAMLConfig is the configuration stored in config.yaml in the config repo.
+type YAMLConfig struct {
+	Name         string      `yaml:"name"`
+	Host         string      `yaml:"host"`
+	Port         int         `yaml:"port"`
+	AnonAccess   string      `yaml:"anon-access"`
+	AllowKeyless bool        `yaml:"allow-keyless"`
+	Users        []User      `yaml:"users"`
+	Repos        []Repo      `yaml:"repos"`
+	Quotas       Quotas      `yaml:"quotas"`
+	Maintenance  Maintenance `yaml:"maintenance"`
+	Limits       Limits      `yaml:"limits"`
+	Webhooks     Webhooks    `yaml:"webhooks"`
+	Theme        Theme       `yaml:"theme"`
 }
 
 // User contains user-level configuration for a repository.
@@ -58,7 +85,7 @@ type Webhooks struct {
 	TLSKeyPath string `yaml:"tls-key-path"`
 
 	PluginPath string               `yaml:"plugin-path"`
-	Routes     webhooks.RouteSpec[] `yaml:"routes"`
+	Routes     []webhooks.RouteSpec `yaml:"routes"`
 
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
@@ -73,8 +100,14 @@ func NewConfig(cfg *config.Config) (*Config, error) {
 	port := cfg.Port
 	pk := cfg.InitialAdminKey
 	rs := git.NewRepoSource(cfg.RepoPath)
+	d, err := db.Open(cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
 	c := &Config{
-		Cfg: cfg,
+		Cfg:    cfg,
+		DB:     d,
+		Events: events.NewBus(),
 	}
 	c.Host = cfg.Host
 	c.Port = port
@@ -100,34 +133,251 @@ func NewConfig(cfg *config.Config) (*Config, error) {
 		yamlUsers = defaultUserConfig
 	}
 	yaml := fmt.Sprintf("%s%s%s", yamlConfig, yamlUsers, exampleUserConfig)
-	err := c.createDefaultConfigRepo(yaml)
+	if cfg.RepoConfig != nil {
+		err = c.validateRepoConfig()
+		if err != nil {
+			return nil, err
+		}
+		yaml = string(cfg.RepoConfig)
+	}
+	err = c.createDefaultConfigRepo(yaml)
+	if err != nil {
+		return nil, err
+	}
+	err = c.installHooks()
+	if err != nil {
+		return nil, err
+	}
+	err = c.applyRepoConfig()
+	if err != nil {
+		return nil, err
+	}
+	c.Search, err = search.NewIndex(rs)
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// validateRepoConfig validates the config.yaml declared in the server config
+// file. Line numbers don't match the config file, so only the problems are
+// reported.
+func (cfg *Config) validateRepoConfig() error {
+	repos, err := RepoNames(cfg.Cfg.RepoPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = ValidateConfig(cfg.Cfg.RepoConfig, repos)
+	if err == nil {
+		return nil
+	}
+	msgs := make([]string, 0)
+	if es, ok := err.(ValidationErrors); ok {
+		for _, e := range es {
+			msgs = append(msgs, "  "+e.Message)
+		}
+	} else {
+		msgs = append(msgs, "  "+err.Error())
+	}
+	return fmt.Errorf("invalid config section in %s:\n%s", cfg.Cfg.File, strings.Join(msgs, "\n"))
+}
+
+// applyRepoConfig commits the config.yaml declared in the server config file
+// to the config repo, unless the config repo already has it, and loads it.
+//
+// Changes pushed to the config repo win over the file: the file is only
+// applied if it changed since it was last applied and the config repo still
+// holds what was applied then. If both changed, the conflict is logged and
+// the config repo is kept. The first time the file declares a config.yaml,
+// it's applied.
+func (cfg *Config) applyRepoConfig() error {
+	if cfg.Cfg.RepoConfig == nil {
+		return nil
+	}
+	cr, err := cfg.Source.GetRepo("config")
+	if err != nil {
+		return err
+	}
+	head, err := cr.Repository.Head()
+	if err != nil {
+		return err
+	}
+	c, err := cr.Repository.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	var cs string
+	f, err := c.File("config.yaml")
+	if err == nil {
+		cs, err = f.Contents()
+		if err != nil {
+			return err
+		}
+	}
+	applied, err := cfg.DB.Setting(fileConfigKey)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	fs := sha256Hex(cfg.Cfg.RepoConfig)
+	switch {
+	case cs == string(cfg.Cfg.RepoConfig):
+		return cfg.DB.SetSetting(fileConfigKey, fs)
+	case fs == applied:
+		return nil
+	case applied != "" && sha256Hex([]byte(cs)) != applied:
+		log.Printf("Not updating config.yaml from %s: it was changed in the config repo since it was last applied from the file", cfg.Cfg.File)
+		return nil
+	}
+	err = cfg.validateRepoConfig()
+	if err != nil {
+		return err
+	}
+	log.Printf("Updating config.yaml in the config repo from %s", cfg.Cfg.File)
+	msg := fmt.Sprintf("Update config.yaml from %s", filepath.Base(cfg.Cfg.File))
+	err = cfg.commitFile("config.yaml", string(cfg.Cfg.RepoConfig), msg)
+	if err != nil {
+		return err
+	}
+	err = cfg.DB.SetSetting(fileConfigKey, fs)
+	if err != nil {
+		return err
+	}
+	err = cfg.Source.UpdateRepo("config")
+	if err != nil {
+		return err
+	}
+	return cfg.readConfig()
+}
+
+// sha256Hex returns the SHA-256 of data in hex.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // Reload reloads the configuration.
 func (cfg *Config) Reload() error {
 	err := cfg.Source.LoadRepos()
 	if err != nil {
 		return err
 	}
+	return cfg.readConfig()
+}
+
+// readConfig reads config.yaml from the config repo. The new config is
+// validated before it replaces the current one, so an invalid config.yaml
+// never takes effect. When the server starts with an invalid config.yaml, the
+// last known good config is loaded instead.
+func (cfg *Config) readConfig() error {
 	cr, err := cfg.Source.GetRepo("config")
 	if err != nil {
 		return err
 	}
-	cs, err := cr.LatestFile("config.yaml")
+	head, err := cr.Repository.Head()
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal([]byte(cs), cfg)
-	if err != nil {
-		return fmt.Errorf("bad yaml in config.yaml: %s", err)
+	err = cfg.loadCommit(cr, head.Hash())
+	if err == nil {
+		return nil
+	}
+	if cfg.Commit() != "" {
+		return fmt.Errorf("keeping the current config: %w", err)
 	}
+	lg, lerr := cfg.DB.Setting(lastGoodConfigKey)
+	if lerr != nil {
+		return err
+	}
+	lerr = cfg.loadCommit(cr, plumbing.NewHash(lg))
+	if lerr != nil {
+		return err
+	}
+	log.Printf("error loading config.yaml at %s, using the last known good config from %s: %s", head.Hash(), lg, err)
 	return nil
 }
 
+// loadCommit loads and applies config.yaml from the given commit of the
+// config repo.
+func (cfg *Config) loadCommit(cr *git.Repo, h plumbing.Hash) error {
+	c, err := cr.Repository.CommitObject(h)
+	if err != nil {
+		return err
+	}
+	f, err := c.File("config.yaml")
+	if err != nil {
+		return err
+	}
+	cs, err := f.Contents()
+	if err != nil {
+		return err
+	}
+	yc, err := cfg.parseConfig([]byte(cs))
+	if err != nil {
+		return err
+	}
+	return cfg.apply(yc, h.String())
+}
+
+// parseConfig validates and parses config.yaml into a new YAMLConfig. Host and
+// port default to the server settings.
+func (cfg *Config) parseConfig(data []byte) (*YAMLConfig, error) {
+	// References to repos are only checked when the config is pushed, so
+	// that deleting a repo from disk doesn't invalidate the config.
+	err := ValidateConfig(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config.yaml:\n%w", err)
+	}
+	yc := &YAMLConfig{
+		Host: cfg.Cfg.Host,
+		Port: cfg.Cfg.Port,
+	}
+	err = yaml.Unmarshal(data, yc)
+	if err != nil {
+		return nil, fmt.Errorf("bad yaml in config.yaml: %s", err)
+	}
+	return yc, nil
+}
+
+// apply atomically replaces the current config with yc, which was loaded
+// from the given commit of the config repo, and records it as the last known
+// good config.
+func (cfg *Config) apply(yc *YAMLConfig, commit string) error {
+	cfg.mtx.Lock()
+	cfg.YAMLConfig = *yc
+	cfg.commit = commit
+	cfg.mtx.Unlock()
+	defer cfg.Events.Publish(events.Event{Type: events.Reload})
+	err := cfg.DB.SetSetting(lastGoodConfigKey, commit)
+	if err != nil {
+		return err
+	}
+	return cfg.syncDB(yc)
+}
+
+// Commit returns the commit of the config repo the current config was loaded
+// from.
+func (cfg *Config) Commit() string {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
+	return cfg.commit
+}
+
+// Snapshot returns a copy of the configuration that doesn't change when the
+// configuration is reloaded.
+func (cfg *Config) Snapshot() *Config {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
+	return &Config{
+		YAMLConfig: cfg.YAMLConfig,
+		Source:     cfg.Source,
+		Cfg:        cfg.Cfg,
+		DB:         cfg.DB,
+		Events:     cfg.Events,
+		Search:     cfg.Search,
+		commit:     cfg.commit,
+	}
+}
+
 func createFile(path string, content string) error {
 	f, err := os.Create(path)
 	if err != nil {
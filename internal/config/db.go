@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strconv"
+
+	"github.com/charmbracelet/soft-serve/internal/db"
+)
+
+// lastGoodConfigKey is the database setting holding the commit of the config
+// repo the last valid config was loaded from.
+const lastGoodConfigKey = "config-commit"
+
+// fileConfigKey is the database setting holding the SHA-256 of the
+// config.yaml last applied from the server config file.
+const fileConfigKey = "config-file-sha256"
+
+// syncDB applies the users, repos and settings declared in config.yaml to the
+// database, and records repos that were created outside of the config.
+func (cfg *Config) syncDB(yc *YAMLConfig) error {
+	users := make([]*db.User, 0, len(yc.Users))
+	for _, u := range yc.Users {
+		users = append(users, &db.User{
+			Name:        u.Name,
+			Admin:       u.Admin,
+			PublicKeys:  u.PublicKeys,
+			CollabRepos: u.CollabRepos,
+		})
+	}
+	repos := make([]*db.Repo, 0, len(yc.Repos))
+	for _, r := range yc.Repos {
+		repos = append(repos, &db.Repo{
+			Name:        r.Repo,
+			DisplayName: r.Name,
+			Note:        r.Note,
+			Private:     r.Private,
+		})
+	}
+	settings := map[string]string{
+		"name":          yc.Name,
+		"anon-access":   yc.AnonAccess,
+		"allow-keyless": strconv.FormatBool(yc.AllowKeyless),
+	}
+	err := cfg.DB.Sync(users, repos, settings)
+	if err != nil {
+		return err
+	}
+	for _, r := range cfg.Source.AllRepos() {
+		_, err = cfg.DB.AddRepo(&db.Repo{Name: r.Name})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
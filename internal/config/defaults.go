@@ -19,6 +19,42 @@ anon-access: %s
 # will be accepted.
 allow-keyless: false
 
+# Storage quotas. Sizes take a unit, such as 500MB or 2GiB. Quotas that aren't
+# set are unlimited.
+# quotas:
+#   max-repo-size: 1GB
+#   max-object-size: 100MB
+#   max-user-size: 5GB
+
+# Repos are maintained in the background after a number of pushes or once
+# they have too many loose objects.
+# maintenance:
+#   pushes: 100
+#   loose-objects: 1000
+#   concurrency: 1
+#   interval: 1h
+
+# Limits on SSH clients, counted per public key, or per IP address for clients
+# without a key. IP addresses failing to connect too often are locked out, for
+# twice as long every time. Limits that aren't set are unlimited.
+# limits:
+#   max-sessions: 10
+#   git-per-minute: 60
+#   auth-failures: 10
+#   lockout: 1m
+
+# The look of the TUI. The mode is auto to follow the background of the
+# terminal, dark or light. Colors for dark and light terminals can be changed
+# separately, as color numbers from 0 to 255 or hex colors.
+# theme:
+#   mode: auto
+#   border: rounded
+#   light:
+#     accent: "62"
+#     selected: "#af00af"
+#     markdown: light
+#     syntax: github
+
 # Customize repo display in the menu. Only repos in this list will appear in
 # the TUI.
 repos:
@@ -4,21 +4,104 @@ import (
 	"log"
 	"strings"
 
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/events"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/search"
 	gm "github.com/charmbracelet/wish/git"
 	"github.com/gliderlabs/ssh"
 )
 
-// Push registers Git push functionality for the given repo and key.
+// Push registers Git push functionality for the given repo and key. It's the
+// hook of the wish git middleware, which doesn't tell which refs changed, so
+// nothing is logged.
 func (cfg *Config) Push(repo string, pk ssh.PublicKey) {
-	err := cfg.Reload()
+	cfg.Pushed(repo, pk, nil)
+}
+
+// Pushed updates a repo after a push with the given key. The refs changed by
+// the push, us, are logged as pushes of the user of the key, and a Push event,
+// or a Create event for the first push, is published.
+func (cfg *Config) Pushed(repo string, pk ssh.PublicKey, us []git.RefUpdate) {
+	err := cfg.Source.UpdateRepo(repo)
+	if err != nil {
+		log.Printf("error updating %s after push: %s", repo, err)
+	}
+	var createdBy string
+	cfg.mtx.RLock()
+	if u := cfg.userForKey(pk); u != nil {
+		createdBy = u.Name
+	}
+	cfg.mtx.RUnlock()
+	created, err := cfg.DB.AddRepo(&db.Repo{Name: repo, CreatedBy: createdBy})
 	if err != nil {
-		log.Printf("error reloading after push: %s", err)
+		log.Printf("error adding %s to the database: %s", repo, err)
+	}
+	pusher := cfg.UserName(pk)
+	for _, u := range us {
+		err = cfg.DB.AddPush(newPush(repo, pusher, u))
+		if err != nil {
+			log.Printf("error logging push to %s: %s", repo, err)
+		}
 	}
+	if repo == "config" {
+		err = cfg.readConfig()
+		if err != nil {
+			log.Printf("error reloading after push: %s", err)
+		}
+	}
+	cfg.updateSearch(repo)
+	e := events.Event{Type: events.Push, Repo: repo}
+	if created {
+		e.Type = events.Create
+	}
+	cfg.Events.Publish(e)
 	if cfg.Cfg.Callbacks != nil {
 		cfg.Cfg.Callbacks.Push(repo)
 	}
 }
 
+// newPush returns the log entry of a ref changed by a push.
+func newPush(repo string, pusher string, u git.RefUpdate) *db.Push {
+	p := &db.Push{
+		Repo:   repo,
+		Ref:    u.Ref,
+		Pusher: pusher,
+		Old:    u.Old,
+		New:    u.New,
+		Total:  u.Total,
+	}
+	for _, c := range u.Commits {
+		p.Commits = append(p.Commits, db.PushCommit{
+			Hash:    c.Hash.String(),
+			Subject: strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+			Author:  c.Author.Name,
+		})
+	}
+	return p
+}
+
+// Pushes returns up to limit of the latest pushes to the repos the given key
+// can read, newest first.
+func (cfg *Config) Pushes(limit int, pk ssh.PublicKey) ([]*db.Push, error) {
+	return cfg.DB.Pushes(limit, func(p *db.Push) bool {
+		return cfg.AuthRepo(p.Repo, pk) >= gm.ReadOnlyAccess
+	})
+}
+
+// SearchRepos searches the files of the repos the given key can read.
+func (cfg *Config) SearchRepos(q search.Query, pk ssh.PublicKey) (*search.Results, error) {
+	return cfg.Search.Search(q, func(repo string) bool {
+		return cfg.AuthRepo(repo, pk) >= gm.ReadOnlyAccess
+	})
+}
+
+// updateSearch updates the search index of a repo in the background. Failures
+// are logged, since the repo itself was updated fine.
+func (cfg *Config) updateSearch(repo string) {
+	cfg.Search.Schedule(repo)
+}
+
 // Fetch registers Git fetch functionality for the given repo and key.
 func (cfg *Config) Fetch(repo string, pk ssh.PublicKey) {
 	if cfg.Cfg.Callbacks != nil {
@@ -28,26 +111,83 @@ func (cfg *Config) Fetch(repo string, pk ssh.PublicKey) {
 
 // AuthRepo grants repo authorization to the given key.
 func (cfg *Config) AuthRepo(repo string, pk ssh.PublicKey) gm.AccessLevel {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
 	return cfg.accessForKey(repo, pk)
 }
 
 // PasswordHandler returns whether or not password access is allowed.
 func (cfg *Config) PasswordHandler(ctx ssh.Context, password string) bool {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
 	return (cfg.AnonAccess != "no-access") && cfg.AllowKeyless
 }
 
 // PublicKeyHandler returns whether or not the given public key may access the
 // repo.
 func (cfg *Config) PublicKeyHandler(ctx ssh.Context, pk ssh.PublicKey) bool {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
 	return cfg.accessForKey("", pk) != gm.NoAccess
 }
 
-func (cfg *Config) accessForKey(repo string, pk ssh.PublicKey) gm.AccessLevel {
-	private := cfg.isPrivate(repo)
-	if repo == "config" {
-		private = true
+// Anonymous is the name of users without a key of the config. No user of the
+// config can have it.
+const Anonymous = "anonymous"
+
+// UserName returns the name of the user the given public key belongs to, or
+// Anonymous.
+func (cfg *Config) UserName(pk ssh.PublicKey) string {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
+	if u := cfg.userForKey(pk); u != nil {
+		return u.Name
 	}
-	for _, u := range cfg.Users {
+	return Anonymous
+}
+
+// IsUser reports whether the given public key belongs to a user of the config.
+func (cfg *Config) IsUser(pk ssh.PublicKey) bool {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
+	return cfg.userForKey(pk) != nil
+}
+
+// userForKey returns the user the given public key belongs to, if any. The
+// caller must hold cfg.mtx.
+func (cfg *Config) userForKey(pk ssh.PublicKey) *User {
+	if pk == nil {
+		return nil
+	}
+	for i, u := range cfg.Users {
+		for _, k := range u.PublicKeys {
+			apk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(k)))
+			if err != nil {
+				continue
+			}
+			if ssh.KeysEqual(pk, apk) {
+				return &cfg.Users[i]
+			}
+		}
+	}
+	return nil
+}
+
+// AuthRepoUser returns the access level of the named user to the given repo.
+// An empty or unknown name, such as Anonymous, is treated as an anonymous user.
+func (cfg *Config) AuthRepoUser(repo string, user string) gm.AccessLevel {
+	cfg.mtx.RLock()
+	defer cfg.mtx.RUnlock()
+	for i, u := range cfg.Users {
+		if u.Name == user {
+			return cfg.accessForUser(repo, &cfg.Users[i])
+		}
+	}
+	return cfg.accessForUser(repo, nil)
+}
+
+func (cfg *Config) accessForKey(repo string, pk ssh.PublicKey) gm.AccessLevel {
+	for i, u := range cfg.Users {
 		for _, k := range u.PublicKeys {
 			apk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(k)))
 			if err != nil {
@@ -55,19 +195,32 @@ func (cfg *Config) accessForKey(repo string, pk ssh.PublicKey) gm.AccessLevel {
 				return gm.NoAccess
 			}
 			if ssh.KeysEqual(pk, apk) {
-				if u.Admin {
-					return gm.AdminAccess
-				}
-				for _, r := range u.CollabRepos {
-					if repo == r {
-						return gm.ReadWriteAccess
-					}
-				}
-				if !private {
-					return gm.ReadOnlyAccess
-				}
+				return cfg.accessForUser(repo, &cfg.Users[i])
+			}
+		}
+	}
+	return cfg.accessForUser(repo, nil)
+}
+
+// accessForUser returns the access level of a user to repo. A nil user is
+// anonymous. The caller must hold cfg.mtx.
+func (cfg *Config) accessForUser(repo string, u *User) gm.AccessLevel {
+	private := cfg.isPrivate(repo)
+	if repo == "config" {
+		private = true
+	}
+	if u != nil {
+		if u.Admin {
+			return gm.AdminAccess
+		}
+		for _, r := range u.CollabRepos {
+			if repo == r {
+				return gm.ReadWriteAccess
 			}
 		}
+		if !private {
+			return gm.ReadOnlyAccess
+		}
 	}
 	if private && (cfg.AnonAccess != "read-write") {
 		return gm.NoAccess
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/go-git/go-billy/v5/memfs"
+	gg "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// ErrUnknownCommit indicates that a commit couldn't be found in the history of
+// config.yaml.
+var ErrUnknownCommit = errors.New("unknown commit")
+
+// ConfigCommit is a commit of the config repo that changed config.yaml.
+type ConfigCommit struct {
+	Hash    string
+	Message string
+	Author  string
+	When    time.Time
+	// Current is set for the commit the running config was loaded from.
+	Current bool
+}
+
+// History returns up to limit commits of the config repo that changed
+// config.yaml, newest first.
+func (cfg *Config) History(limit int) ([]ConfigCommit, error) {
+	cr, err := cfg.Source.GetRepo("config")
+	if err != nil {
+		return nil, err
+	}
+	fn := "config.yaml"
+	l, err := cr.Repository.Log(&gg.LogOptions{FileName: &fn})
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	current := cfg.Commit()
+	cs := make([]ConfigCommit, 0)
+	for len(cs) < limit {
+		c, err := l.Next()
+		if err != nil {
+			break
+		}
+		cs = append(cs, ConfigCommit{
+			Hash:    c.Hash.String(),
+			Message: strings.TrimSpace(c.Message),
+			Author:  c.Author.Name,
+			When:    c.Author.When,
+			Current: c.Hash.String() == current,
+		})
+	}
+	return cs, nil
+}
+
+// Rollback restores config.yaml as of the given commit, which can be
+// abbreviated, by committing it on top of the config repo on behalf of user.
+// The config is validated before it's committed, and loaded once committed.
+// It returns the full hash of the commit that was rolled back to.
+func (cfg *Config) Rollback(rev string, user string) (string, error) {
+	cr, err := cfg.Source.GetRepo("config")
+	if err != nil {
+		return "", err
+	}
+	c, err := resolveConfigCommit(cr, rev)
+	if err != nil {
+		return "", err
+	}
+	f, err := c.File("config.yaml")
+	if err != nil {
+		return "", err
+	}
+	cs, err := f.Contents()
+	if err != nil {
+		return "", err
+	}
+	repos := make([]string, 0)
+	for _, r := range cfg.Source.AllRepos() {
+		repos = append(repos, r.Name)
+	}
+	err = ValidateConfig([]byte(cs), repos)
+	if err != nil {
+		return "", fmt.Errorf("config.yaml at %s is invalid:\n%w", c.Hash, err)
+	}
+	msg := fmt.Sprintf("Roll back config.yaml to %s\n\nRequested by %s.", c.Hash, user)
+	err = cfg.commitFile("config.yaml", cs, msg)
+	if err != nil {
+		return "", err
+	}
+	err = cfg.Source.UpdateRepo("config")
+	if err != nil {
+		return "", err
+	}
+	cfg.updateSearch("config")
+	return c.Hash.String(), cfg.readConfig()
+}
+
+// resolveConfigCommit finds a commit of the config repo by its, possibly
+// abbreviated, hash.
+func resolveConfigCommit(cr *git.Repo, rev string) (*object.Commit, error) {
+	rev = strings.ToLower(strings.TrimSpace(rev))
+	if len(rev) < 4 {
+		return nil, fmt.Errorf("%w %q: use at least 4 characters of the hash", ErrUnknownCommit, rev)
+	}
+	l, err := cr.Repository.Log(&gg.LogOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	var found *object.Commit
+	for {
+		c, err := l.Next()
+		if err != nil {
+			break
+		}
+		if !strings.HasPrefix(c.Hash.String(), rev) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%w %q: the hash is ambiguous", ErrUnknownCommit, rev)
+		}
+		found = c
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCommit, rev)
+	}
+	return found, nil
+}
+
+// commitFile commits a file to the default branch of the config repo and
+// pushes it, which runs the hooks of the config repo just like a push over
+// SSH would. Like a push, it holds the write lock of the config repo.
+func (cfg *Config) commitFile(path string, content string, msg string) error {
+	unlock := cfg.Source.Locks.Lock("config", git.WriteLock)
+	defer unlock()
+	cr, err := cfg.Source.GetRepo("config")
+	if err != nil {
+		return err
+	}
+	rp := cr.Repository
+	head, err := rp.Head()
+	if err != nil {
+		return err
+	}
+	r, err := gg.Clone(memory.NewStorage(), memfs.New(), &gg.CloneOptions{
+		URL:           filepath.Join(cfg.Source.Path, "config"),
+		ReferenceName: head.Name(),
+		SingleBranch:  true,
+	})
+	if err != nil {
+		return err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	f, err := wt.Filesystem.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(content))
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Add(path)
+	if err != nil {
+		return err
+	}
+	_, err = wt.Commit(msg, &gg.CommitOptions{
+		Author: &object.Signature{
+			Name:  "Soft Serve Server",
+			Email: "vt100@charm.sh",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return r.Push(&gg.PushOptions{})
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const preReceiveHook = `#!/bin/sh
+# Installed by Soft Serve. Do not edit, changes will be overwritten.
+exec %q hook pre-receive
+`
+
+// installHooks installs the git hooks, pointing them at the running soft
+// binary. The hooks of the config repo are installed in the repo itself, so
+// they also run for local pushes. The hooks run for pushes over SSH are
+// installed in a shared directory under the repo path. Hooks are rewritten on
+// every start in case the binary moved.
+func (cfg *Config) installHooks() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+	cfg.Source.HooksPath, err = filepath.Abs(filepath.Join(cfg.Source.Path, ".hooks"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{filepath.Join(cfg.Source.Path, "config", "hooks"), cfg.Source.HooksPath} {
+		hp := filepath.Join(dir, "pre-receive")
+		err = os.MkdirAll(dir, os.ModeDir|os.FileMode(0700))
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(hp, []byte(fmt.Sprintf(preReceiveHook, exe)), 0700) // nolint: gosec
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PreReceiveHook implements the git pre-receive hook. It's run by git
+// receive-pack in the repo directory after the pushed objects have been
+// received but before any refs are updated, with the updated refs on stdin.
+// Pushes over SSH are rejected if they would go over the storage quotas. For
+// the config repo, pushes are also rejected if they would leave the default
+// branch with an invalid config.yaml. Problems are written to stderr, which
+// git forwards to the pushing client, and an error is returned to reject the
+// push.
+func PreReceiveHook(stdin io.Reader, stderr io.Writer) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	wd, err = filepath.Abs(wd)
+	if err != nil {
+		return err
+	}
+	if l := quotaLimitsFromEnv(); l != nil {
+		err = checkPushQuotas(l, stderr)
+		if err != nil {
+			return err
+		}
+	}
+	if filepath.Base(wd) != "config" {
+		return nil
+	}
+	head, err := gitOutput(wd, "symbolic-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	head = strings.TrimSpace(head)
+	s := bufio.NewScanner(stdin)
+	for s.Scan() {
+		fs := strings.Fields(s.Text())
+		if len(fs) != 3 || fs[2] != head {
+			continue
+		}
+		if plumbing.NewHash(fs[1]).IsZero() {
+			fmt.Fprintf(stderr, "error: the %s branch of the config repo can't be deleted\n", plumbing.ReferenceName(head).Short())
+			return fmt.Errorf("config branch deleted")
+		}
+		cy, err := gitOutput(wd, "cat-file", "blob", fs[1]+":config.yaml")
+		if err != nil {
+			fmt.Fprintf(stderr, "error: config.yaml is missing from the config repo\n")
+			return fmt.Errorf("missing config.yaml")
+		}
+		repos, err := RepoNames(filepath.Dir(wd))
+		if err != nil {
+			return err
+		}
+		err = ValidateConfig([]byte(cy), repos)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: config.yaml is invalid, push rejected:\n")
+			WriteValidationErrors(stderr, "config.yaml", err)
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// checkPushQuotas checks the objects received by a push against the quotas.
+// Until the pre-receive hook accepts a push, its objects are kept in a
+// quarantine directory, whose size is what the push adds to the repo.
+func checkPushQuotas(l *QuotaLimits, stderr io.Writer) error {
+	qp := os.Getenv("GIT_QUARANTINE_PATH")
+	if qp == "" {
+		return nil
+	}
+	if l.MaxObjectSize > 0 {
+		// Without the alternates, which point at the objects of the repo,
+		// only the objects in quarantine are listed.
+		cmd := exec.Command("git", "cat-file", "--batch-all-objects", "--batch-check=%(objectname) %(objectsize)")
+		cmd.Env = make([]string, 0)
+		for _, e := range os.Environ() {
+			if !strings.HasPrefix(e, "GIT_ALTERNATE_OBJECT_DIRECTORIES=") {
+				cmd.Env = append(cmd.Env, e)
+			}
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			fs := strings.Fields(line)
+			if len(fs) != 2 {
+				continue
+			}
+			size, err := strconv.ParseInt(fs[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			err = l.CheckObject(size)
+			if err != nil {
+				fmt.Fprintf(stderr, "error: push rejected: %s (%s)\n", err, fs[0])
+				return err
+			}
+		}
+	}
+	size, err := git.DirSize(qp)
+	if err != nil {
+		return err
+	}
+	err = l.Check(size)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: push rejected: %s\n", err)
+		return err
+	}
+	return nil
+}
+
+// RepoNames returns the names of the repos in the given directory. Hidden
+// directories, such as the LFS object store, aren't repos.
+func RepoNames(dir string) ([]string, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(des))
+	for _, de := range des {
+		if de.IsDir() && !strings.HasPrefix(de.Name(), ".") {
+			names = append(names, de.Name())
+		}
+	}
+	return names, nil
+}
+
+// gitOutput runs git in dir and returns its output. The environment
+// is inherited, so objects in the quarantine directory of a push that's being
+// received are visible.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/events"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/gitolite"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportOptions are the options of ImportRepos.
+type ImportOptions struct {
+	// Move moves bare repos instead of copying them.
+	Move bool
+	// Gitolite is the configuration of the gitolite server the repos are
+	// migrated from, if any. Its users and access rules are translated into
+	// users and collab-repos.
+	Gitolite *gitolite.Config
+	// User is the user the repos are recorded as created by.
+	User string
+}
+
+// ImportRepos imports repos found by git.FindRepos into the repos directory
+// and declares them in config.yaml, with their description as the note. Repos
+// are private unless they're marked as exported or gitolite gives everyone
+// read access. Repos that already exist are skipped.
+//
+// The edited config.yaml is validated before any repo is imported, and
+// committed once the repos are imported.
+func (cfg *Config) ImportRepos(repos []*git.FoundRepo, opts ImportOptions) error {
+	todo := make([]*git.FoundRepo, 0, len(repos))
+	names := make([]string, 0, len(repos))
+	for _, r := range repos {
+		if opts.Gitolite != nil && r.RelPath == "gitolite-admin" {
+			continue
+		}
+		if !git.ValidRepoName(r.Name) {
+			log.Printf("Skipping %s: invalid repo name %q", r.Path, r.Name)
+			continue
+		}
+		if _, err := cfg.Source.GetRepo(r.Name); err == nil {
+			log.Printf("Skipping %s: repo %s already exists", r.Path, r.Name)
+			continue
+		}
+		todo = append(todo, r)
+		names = append(names, r.Name)
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+	_, err := cfg.editedConfig(importEdit(todo, opts.Gitolite), names)
+	if err != nil {
+		return err
+	}
+
+	done := make([]*git.FoundRepo, 0, len(todo))
+	for _, r := range todo {
+		if r.Bare && opts.Move {
+			err = cfg.Source.MoveRepo(r.Name, r.Path)
+		} else {
+			err = cfg.Source.ImportRepo(r.Name, r.Path, r.Bare)
+		}
+		if err != nil {
+			log.Printf("Error importing %s: %s", r.Path, err)
+			continue
+		}
+		_, err = cfg.DB.AddRepo(&db.Repo{Name: r.Name, Note: r.Description, CreatedBy: opts.User})
+		if err != nil {
+			return err
+		}
+		log.Printf("Imported %s as %s", r.Path, r.Name)
+		cfg.updateSearch(r.Name)
+		cfg.Events.Publish(events.Event{Type: events.Create, Repo: r.Name})
+		done = append(done, r)
+	}
+	if len(done) == 0 {
+		return fmt.Errorf("no repos were imported")
+	}
+	return cfg.editConfig(fmt.Sprintf("Import %d repos", len(done)), importEdit(done, opts.Gitolite))
+}
+
+// importEdit returns the edit of config.yaml declaring the imported repos and
+// the users of gl.
+func importEdit(repos []*git.FoundRepo, gl *gitolite.Config) func(doc *yaml.Node) error {
+	return func(doc *yaml.Node) error {
+		rns := sequenceValue(doc, "repos")
+		declared := make(map[string]struct{})
+		for _, rn := range rns.Content {
+			if v := mappingValue(rn, "repo"); v != nil {
+				declared[v.Value] = struct{}{}
+			}
+		}
+		for _, r := range repos {
+			if _, ok := declared[r.Name]; ok {
+				continue
+			}
+			private := !r.Exported
+			if gl != nil && (gl.CanRead(r.RelPath, gitolite.Everyone) ||
+				gl.CanRead(r.RelPath, "daemon") || gl.CanRead(r.RelPath, "gitweb")) {
+				private = false
+			}
+			rn := &yaml.Node{Kind: yaml.MappingNode}
+			setMappingValue(rn, "name", stringNode(r.Name))
+			setMappingValue(rn, "repo", stringNode(r.Name))
+			if r.Description != "" {
+				setMappingValue(rn, "note", stringNode(r.Description))
+			}
+			if private {
+				setMappingValue(rn, "private", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+			}
+			rns.Content = append(rns.Content, rn)
+		}
+		if gl == nil {
+			return nil
+		}
+
+		users := sequenceValue(doc, "users")
+		for _, u := range gl.Users() {
+			un := userNode(users, u)
+			if un == nil {
+				un = &yaml.Node{Kind: yaml.MappingNode}
+				setMappingValue(un, "name", stringNode(u))
+				users.Content = append(users.Content, un)
+			}
+			if gl.CanWrite("gitolite-admin", u) {
+				setMappingValue(un, "admin", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+			}
+			kn := sequenceValue(un, "public-keys")
+			for _, k := range gl.Keys[u] {
+				appendString(kn, k)
+			}
+			var cn *yaml.Node
+			for _, r := range repos {
+				if !gl.CanWrite(r.RelPath, u) {
+					continue
+				}
+				if cn == nil {
+					cn = sequenceValue(un, "collab-repos")
+				}
+				appendString(cn, r.Name)
+			}
+		}
+		return nil
+	}
+}
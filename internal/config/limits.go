@@ -0,0 +1,58 @@
+package config
+
+import (
+	"time"
+)
+
+// Limits protects the SSH server from clients opening too many sessions or
+// failing to authenticate over and over. Limits that aren't set are
+// unlimited.
+type Limits struct {
+	// MaxSessions is the maximum number of sessions open at once by a
+	// public key, or by an IP address for clients without a key.
+	MaxSessions int `yaml:"max-sessions"`
+	// GitPerMinute is the maximum number of git fetches and pushes per
+	// minute by a public key, or by an IP address for clients without a key.
+	GitPerMinute int `yaml:"git-per-minute"`
+	// AuthFailures is the number of failed connections from an IP address
+	// after which it's locked out.
+	AuthFailures int `yaml:"auth-failures"`
+	// Lockout is how long an IP address is first locked out for, such as
+	// 1m. It doubles every time the address is locked out again, up to
+	// MaxLockout.
+	Lockout string `yaml:"lockout"`
+}
+
+// defaultLockout is how long an IP address is first locked out for if the
+// lockout isn't set.
+const defaultLockout = time.Minute
+
+// MaxLockout is the longest an IP address is locked out for.
+const MaxLockout = time.Hour
+
+// LimitSettings are the limits with their defaults applied. Limits of 0 are
+// unlimited.
+type LimitSettings struct {
+	MaxSessions  int
+	GitPerMinute int
+	AuthFailures int
+	Lockout      time.Duration
+}
+
+// LimitSettings returns the current limits.
+func (cfg *Config) LimitSettings() *LimitSettings {
+	cfg.mtx.RLock()
+	l := cfg.Limits
+	cfg.mtx.RUnlock()
+	ls := &LimitSettings{
+		MaxSessions:  l.MaxSessions,
+		GitPerMinute: l.GitPerMinute,
+		AuthFailures: l.AuthFailures,
+	}
+	// The config is validated before it's applied, so the lockout parses.
+	ls.Lockout, _ = parseInterval(l.Lockout)
+	if ls.Lockout == 0 {
+		ls.Lockout = defaultLockout
+	}
+	return ls
+}
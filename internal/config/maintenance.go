@@ -0,0 +1,82 @@
+package config
+
+import (
+	"time"
+)
+
+// Maintenance configures the background maintenance of the repos, which packs
+// their refs and objects, prunes old unreachable objects and writes their
+// commit-graphs. Settings that aren't set get their default values.
+type Maintenance struct {
+	// Disabled turns off the maintenance.
+	Disabled bool `yaml:"disabled"`
+	// Pushes is the number of pushes to a repo after which it's maintained.
+	Pushes int `yaml:"pushes"`
+	// LooseObjects is the number of loose objects after which a repo is
+	// maintained.
+	LooseObjects int `yaml:"loose-objects"`
+	// Concurrency is the maximum number of repos maintained at once.
+	Concurrency int `yaml:"concurrency"`
+	// Interval is how often the repos are checked for loose objects, such
+	// as 30m or 2h.
+	Interval string `yaml:"interval"`
+}
+
+// Default maintenance settings.
+const (
+	defaultMaintenancePushes       = 100
+	defaultMaintenanceLooseObjects = 1000
+	defaultMaintenanceConcurrency  = 1
+	defaultMaintenanceInterval     = time.Hour
+)
+
+// minMaintenanceInterval is the shortest interval between checks of the
+// loose objects, as counting them reads every repo.
+const minMaintenanceInterval = time.Minute
+
+// MaintenanceSettings are the maintenance settings with their defaults
+// applied.
+type MaintenanceSettings struct {
+	Disabled     bool
+	Pushes       int
+	LooseObjects int
+	Concurrency  int
+	Interval     time.Duration
+}
+
+// parseInterval parses the interval of the maintenance. An empty interval is
+// parsed as 0.
+func parseInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// MaintenanceSettings returns the current maintenance settings.
+func (cfg *Config) MaintenanceSettings() *MaintenanceSettings {
+	cfg.mtx.RLock()
+	m := cfg.Maintenance
+	cfg.mtx.RUnlock()
+	ms := &MaintenanceSettings{
+		Disabled:     m.Disabled,
+		Pushes:       m.Pushes,
+		LooseObjects: m.LooseObjects,
+		Concurrency:  m.Concurrency,
+	}
+	// The config is validated before it's applied, so the interval parses.
+	ms.Interval, _ = parseInterval(m.Interval)
+	if ms.Pushes == 0 {
+		ms.Pushes = defaultMaintenancePushes
+	}
+	if ms.LooseObjects == 0 {
+		ms.LooseObjects = defaultMaintenanceLooseObjects
+	}
+	if ms.Concurrency == 0 {
+		ms.Concurrency = defaultMaintenanceConcurrency
+	}
+	if ms.Interval == 0 {
+		ms.Interval = defaultMaintenanceInterval
+	}
+	return ms
+}
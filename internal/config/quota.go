@@ -0,0 +1,243 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Quotas are the storage limits of the server. Sizes are given with a unit,
+// such as 500MB or 2GiB. Limits that aren't set are unlimited.
+type Quotas struct {
+	// MaxRepoSize is the maximum size of a repo, including its LFS objects.
+	MaxRepoSize string `yaml:"max-repo-size"`
+	// MaxObjectSize is the maximum size of a single git or LFS object.
+	MaxObjectSize string `yaml:"max-object-size"`
+	// MaxUserSize is the maximum total size of the repos a user created.
+	MaxUserSize string `yaml:"max-user-size"`
+}
+
+// parseSize parses a size of the quotas. An empty size is unlimited and
+// parsed as 0.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// RepoUsage is the storage used by a repo.
+type RepoUsage struct {
+	Name      string
+	CreatedBy string
+	GitSize   int64
+	LFSSize   int64
+}
+
+// Size returns the total storage used by the repo.
+func (u RepoUsage) Size() int64 {
+	return u.GitSize + u.LFSSize
+}
+
+// RepoUsage returns the storage used by every repo, sorted by name. Git sizes
+// are the ones RepoSource recorded when the repos were last updated.
+func (cfg *Config) RepoUsage() ([]RepoUsage, error) {
+	dbRepos, err := cfg.DB.Repos()
+	if err != nil {
+		return nil, err
+	}
+	createdBy := make(map[string]string, len(dbRepos))
+	for _, r := range dbRepos {
+		createdBy[r.Name] = r.CreatedBy
+	}
+	us := make([]RepoUsage, 0)
+	for _, r := range cfg.Source.AllRepos() {
+		lu, err := cfg.DB.LFSUsage(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		us = append(us, RepoUsage{
+			Name:      r.Name,
+			CreatedBy: createdBy[r.Name],
+			GitSize:   r.Size,
+			LFSSize:   lu.Size,
+		})
+	}
+	sort.Slice(us, func(i, j int) bool {
+		return us[i].Name < us[j].Name
+	})
+	return us, nil
+}
+
+// QuotaLimits are the quotas that apply to a push to a repo, along with the
+// storage already used. Limits of 0 are unlimited.
+type QuotaLimits struct {
+	Repo          string
+	RepoSize      int64
+	MaxRepoSize   int64
+	User          string
+	UserSize      int64
+	MaxUserSize   int64
+	MaxObjectSize int64
+}
+
+// Environment variables passing QuotaLimits to the pre-receive hook.
+const (
+	quotaRepoEnv          = "SOFT_SERVE_REPO"
+	quotaRepoSizeEnv      = "SOFT_SERVE_REPO_SIZE"
+	quotaMaxRepoSizeEnv   = "SOFT_SERVE_MAX_REPO_SIZE"
+	quotaUserEnv          = "SOFT_SERVE_QUOTA_USER"
+	quotaUserSizeEnv      = "SOFT_SERVE_USER_SIZE"
+	quotaMaxUserSizeEnv   = "SOFT_SERVE_MAX_USER_SIZE"
+	quotaMaxObjectSizeEnv = "SOFT_SERVE_MAX_OBJECT_SIZE"
+)
+
+// QuotaSizes returns the quotas of the server in bytes. Limits of 0 are
+// unlimited.
+func (cfg *Config) QuotaSizes() (*QuotaLimits, error) {
+	cfg.mtx.RLock()
+	q := cfg.Quotas
+	cfg.mtx.RUnlock()
+	l := &QuotaLimits{}
+	var err error
+	l.MaxRepoSize, err = parseSize(q.MaxRepoSize)
+	if err != nil {
+		return nil, err
+	}
+	l.MaxObjectSize, err = parseSize(q.MaxObjectSize)
+	if err != nil {
+		return nil, err
+	}
+	l.MaxUserSize, err = parseSize(q.MaxUserSize)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// QuotaLimits returns the quotas that apply when user pushes to repo. Repos
+// count towards the quota of the user who created them, so pushing to a new
+// repo counts towards the quota of the pusher. Anonymous users have no user
+// quota.
+func (cfg *Config) QuotaLimits(repo string, user string) (*QuotaLimits, error) {
+	l, err := cfg.QuotaSizes()
+	if err != nil {
+		return nil, err
+	}
+	l.Repo = repo
+	if l.MaxRepoSize == 0 && l.MaxUserSize == 0 {
+		return l, nil
+	}
+	us, err := cfg.RepoUsage()
+	if err != nil {
+		return nil, err
+	}
+	owner := user
+	for _, u := range us {
+		if u.Name == repo {
+			l.RepoSize = u.Size()
+			owner = u.CreatedBy
+		}
+	}
+	if owner == "" || owner == Anonymous {
+		l.MaxUserSize = 0
+		return l, nil
+	}
+	l.User = owner
+	for _, u := range us {
+		if u.CreatedBy == owner {
+			l.UserSize += u.Size()
+		}
+	}
+	return l, nil
+}
+
+// CheckObject returns an error if an object of the given size is over the
+// maximum object size.
+func (l *QuotaLimits) CheckObject(size int64) error {
+	if l.MaxObjectSize > 0 && size > l.MaxObjectSize {
+		return fmt.Errorf("object of %s is over the maximum object size of %s", humanize.Bytes(uint64(size)), humanize.Bytes(uint64(l.MaxObjectSize)))
+	}
+	return nil
+}
+
+// Check returns an error if adding size bytes to the repo would put it or the
+// user who created it over quota. Adding nothing is always allowed, so refs
+// can still be deleted once over quota.
+func (l *QuotaLimits) Check(size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	if l.MaxRepoSize > 0 && l.RepoSize+size > l.MaxRepoSize {
+		return fmt.Errorf("repo %s would use %s, over its quota of %s", l.Repo, humanize.Bytes(uint64(l.RepoSize+size)), humanize.Bytes(uint64(l.MaxRepoSize)))
+	}
+	if l.MaxUserSize > 0 && l.UserSize+size > l.MaxUserSize {
+		return fmt.Errorf("repos of %s would use %s, over their quota of %s", l.User, humanize.Bytes(uint64(l.UserSize+size)), humanize.Bytes(uint64(l.MaxUserSize)))
+	}
+	return nil
+}
+
+// Room returns the number of bytes that can be added to the repo before it or
+// the user who created it goes over quota, or -1 if there's no limit.
+func (l *QuotaLimits) Room() int64 {
+	room := int64(-1)
+	if l.MaxRepoSize > 0 {
+		room = left(l.MaxRepoSize, l.RepoSize)
+	}
+	if l.MaxUserSize > 0 {
+		if r := left(l.MaxUserSize, l.UserSize); room < 0 || r < room {
+			room = r
+		}
+	}
+	return room
+}
+
+// left returns what's left of max once used, 0 if used is over max.
+func left(max, used int64) int64 {
+	if used > max {
+		return 0
+	}
+	return max - used
+}
+
+// Env returns the environment variables passing the limits to the
+// pre-receive hook.
+func (l *QuotaLimits) Env() []string {
+	return []string{
+		quotaRepoEnv + "=" + l.Repo,
+		quotaRepoSizeEnv + "=" + strconv.FormatInt(l.RepoSize, 10),
+		quotaMaxRepoSizeEnv + "=" + strconv.FormatInt(l.MaxRepoSize, 10),
+		quotaUserEnv + "=" + l.User,
+		quotaUserSizeEnv + "=" + strconv.FormatInt(l.UserSize, 10),
+		quotaMaxUserSizeEnv + "=" + strconv.FormatInt(l.MaxUserSize, 10),
+		quotaMaxObjectSizeEnv + "=" + strconv.FormatInt(l.MaxObjectSize, 10),
+	}
+}
+
+// quotaLimitsFromEnv returns the limits passed to the pre-receive hook, or nil
+// if the push didn't come through the server.
+func quotaLimitsFromEnv() *QuotaLimits {
+	if _, ok := os.LookupEnv(quotaRepoEnv); !ok {
+		return nil
+	}
+	n := func(k string) int64 {
+		v, _ := strconv.ParseInt(os.Getenv(k), 10, 64)
+		return v
+	}
+	return &QuotaLimits{
+		Repo:          os.Getenv(quotaRepoEnv),
+		RepoSize:      n(quotaRepoSizeEnv),
+		MaxRepoSize:   n(quotaMaxRepoSizeEnv),
+		User:          os.Getenv(quotaUserEnv),
+		UserSize:      n(quotaUserSizeEnv),
+		MaxUserSize:   n(quotaMaxUserSizeEnv),
+		MaxObjectSize: n(quotaMaxObjectSizeEnv),
+	}
+}
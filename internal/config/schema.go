@@ -0,0 +1,179 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// schemaDescriptions describes the config.yaml settings, keyed by their path.
+var schemaDescriptions = map[string]string{
+	"name":                          "Name of the server, shown in the TUI.",
+	"host":                          "Host the server is reachable at, shown in the clone commands.",
+	"port":                          "Port the server is reachable at, shown in the clone commands.",
+	"anon-access":                   "Access level of users without a known public key.",
+	"allow-keyless":                 "Allow access with keyboard-interactive and password authentication.",
+	"users":                         "Users and their public keys.",
+	"users.name":                    "Name of the user.",
+	"users.admin":                   "Give the user write access to every repo, including config.",
+	"users.public-keys":             "Public keys of the user, in authorized_keys format.",
+	"users.collab-repos":            "Repos the user can push to.",
+	"repos":                         "Repos shown in the TUI.",
+	"repos.name":                    "Display name of the repo.",
+	"repos.repo":                    "Name of the repo on disk.",
+	"repos.note":                    "Short description of the repo.",
+	"repos.private":                 "Hide the repo from users without access.",
+	"quotas":                        "Storage quotas. Quotas that aren't set are unlimited.",
+	"quotas.max-repo-size":          "Maximum size of a repo, including its LFS objects, such as 1GB.",
+	"quotas.max-object-size":        "Maximum size of a single git or LFS object, such as 100MB.",
+	"quotas.max-user-size":          "Maximum total size of the repos a user created, such as 5GB.",
+	"maintenance":                   "Background maintenance of the repos.",
+	"maintenance.disabled":          "Turn off the maintenance.",
+	"maintenance.pushes":            "Number of pushes to a repo after which it's maintained, 100 by default.",
+	"maintenance.loose-objects":     "Number of loose objects after which a repo is maintained, 1000 by default.",
+	"maintenance.concurrency":       "Maximum number of repos maintained at once, 1 by default.",
+	"maintenance.interval":          "How often the repos are checked for loose objects, such as 30m, 1h by default.",
+	"limits":                        "Limits on SSH clients. Limits that aren't set are unlimited.",
+	"limits.max-sessions":           "Maximum number of sessions open at once by a public key, or by an IP address without a key.",
+	"limits.git-per-minute":         "Maximum number of git fetches and pushes per minute by a public key, or by an IP address without a key.",
+	"limits.auth-failures":          "Number of failed connections from an IP address after which it's locked out.",
+	"limits.lockout":                "How long an IP address is first locked out for, doubling every time up to 1h, such as 5m, 1m by default.",
+	"webhooks":                      "Incoming webhooks served over HTTP.",
+	"webhooks.tls-certificate-path": "Path to the TLS certificate used to serve the webhooks.",
+	"webhooks.tls-key-path":         "Path to the TLS key used to serve the webhooks.",
+	"webhooks.plugin-path":          "Path to the Go plugin containing the webhook handlers.",
+	"webhooks.routes":               "Routes of the webhooks.",
+	"webhooks.routes.path":          "Path of the route.",
+	"webhooks.routes.method":        "HTTP method of the route.",
+	"webhooks.routes.handler-name":  "Name of the handler in the plugin.",
+	"webhooks.host":                 "Host to serve the webhooks on.",
+	"webhooks.port":                 "Port to serve the webhooks on.",
+	"theme":                         "Look of the TUI.",
+	"theme.mode":                    "Colors to use: dark, light, or auto to follow the terminal background, auto by default.",
+	"theme.border":                  "Style of the borders: rounded, normal, thick or double, rounded by default.",
+	"theme.dark":                    "Colors for terminals with a dark background.",
+	"theme.light":                   "Colors for terminals with a light background.",
+}
+
+// colorDescriptions describes the settings of the colors of a theme, keyed by
+// their name in theme.dark and theme.light.
+var colorDescriptions = map[string]string{
+	"accent":    "Color of the header and of the active box.",
+	"border":    "Color of the borders of the other boxes.",
+	"cursor":    "Color of the cursor.",
+	"selected":  "Color of the item under the cursor, the active tab and the prompts.",
+	"text":      "Color of text that stands out, such as the breadcrumbs.",
+	"muted":     "Color of secondary text, such as notes and sizes.",
+	"faint":     "Color of line numbers and help.",
+	"divider":   "Color of the dividers between tabs and help.",
+	"note":      "Color of the clone command and refs.",
+	"directory": "Color of directories and repo names.",
+	"hash":      "Color of commit hashes.",
+	"author":    "Color of commit authors.",
+	"hunk":      "Color of the hunk headers of diffs.",
+	"added":     "Color of added lines and the default branch.",
+	"deleted":   "Color of deleted lines.",
+	"error":     "Background color of errors.",
+	"markdown":  "Glamour style READMEs are rendered with: dark, light, notty or ascii.",
+	"syntax":    "Chroma style files are highlighted with, such as monokai or github.",
+}
+
+func init() {
+	for _, m := range []string{"dark", "light"} {
+		for k, d := range colorDescriptions {
+			p := "theme." + m + "." + k
+			schemaDescriptions[p] = d
+			switch k {
+			case "markdown":
+				schemaConstraints[p] = map[string]interface{}{"enum": markdownStyles}
+			case "syntax":
+			default:
+				schemaConstraints[p] = map[string]interface{}{"pattern": colorPattern}
+			}
+		}
+	}
+}
+
+// schemaConstraints adds constraints to the config.yaml settings that can't be
+// expressed by their types, keyed by their path. They mirror the checks done
+// by ValidateConfig.
+var schemaConstraints = map[string]map[string]interface{}{
+	"anon-access":               {"enum": []string{"no-access", "read-only", "read-write"}},
+	"port":                      {"minimum": 0, "maximum": 65535},
+	"webhooks.port":             {"minimum": 0, "maximum": 65535},
+	"users":                     {"items": map[string]interface{}{"required": []string{"name"}}},
+	"repos":                     {"items": map[string]interface{}{"required": []string{"repo"}}},
+	"quotas.max-repo-size":      {"pattern": sizePattern},
+	"quotas.max-object-size":    {"pattern": sizePattern},
+	"quotas.max-user-size":      {"pattern": sizePattern},
+	"maintenance.pushes":        {"minimum": 0},
+	"maintenance.loose-objects": {"minimum": 0},
+	"maintenance.concurrency":   {"minimum": 0},
+	"limits.max-sessions":       {"minimum": 0},
+	"limits.git-per-minute":     {"minimum": 0},
+	"limits.auth-failures":      {"minimum": 0},
+	"theme.mode":                {"enum": themeModes},
+	"theme.border":              {"enum": themeBorders},
+}
+
+// sizePattern matches the sizes accepted by the quotas.
+const sizePattern = `^\s*[0-9]+(\.[0-9]+)?\s*[A-Za-z]*\s*$`
+
+// Schema returns the JSON Schema of config.yaml, which editors can use to
+// validate and complete the config.
+func Schema() ([]byte, error) {
+	s := schemaFor(reflect.TypeOf(YAMLConfig{}), "")
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = "Soft Serve config.yaml"
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// schemaFor returns the schema of type t, which is found at path in the
+// config.
+func schemaFor(t reflect.Type, path string) map[string]interface{} {
+	s := make(map[string]interface{})
+	switch t.Kind() {
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Bool:
+		s["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s["type"] = "integer"
+	case reflect.Slice:
+		s["type"] = "array"
+		s["items"] = schemaFor(t.Elem(), path+"[]")
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fp := name
+			if path != "" {
+				fp = strings.TrimSuffix(path, "[]") + "." + name
+			}
+			props[name] = schemaFor(f.Type, fp)
+		}
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+	}
+	if d, ok := schemaDescriptions[path]; ok {
+		s["description"] = d
+	}
+	for k, v := range schemaConstraints[path] {
+		if m, ok := v.(map[string]interface{}); ok {
+			if sm, ok := s[k].(map[string]interface{}); ok {
+				for mk, mv := range m {
+					sm[mk] = mv
+				}
+				continue
+			}
+		}
+		s[k] = v
+	}
+	return s
+}
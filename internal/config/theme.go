@@ -0,0 +1,107 @@
+package config
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Theme is the look of the TUI. Dark and light terminals get their own colors,
+// picked by Mode.
+type Theme struct {
+	// Mode is dark, light, or auto to follow the background of the terminal
+	// of the client, which is the default.
+	Mode string `yaml:"mode"`
+	// Border is the style of the borders of the boxes: rounded, normal, thick
+	// or double. Rounded by default.
+	Border string `yaml:"border"`
+	Dark   Colors `yaml:"dark"`
+	Light  Colors `yaml:"light"`
+}
+
+// Colors are the colors of a theme, overriding those of the default theme for
+// dark or light terminals. Colors are ANSI 256 color numbers, such as 62, or
+// hex colors, such as #5f5fd7. Colors that aren't set keep their default.
+type Colors struct {
+	Accent    string `yaml:"accent"`
+	Border    string `yaml:"border"`
+	Cursor    string `yaml:"cursor"`
+	Selected  string `yaml:"selected"`
+	Text      string `yaml:"text"`
+	Muted     string `yaml:"muted"`
+	Faint     string `yaml:"faint"`
+	Divider   string `yaml:"divider"`
+	Note      string `yaml:"note"`
+	Directory string `yaml:"directory"`
+	Hash      string `yaml:"hash"`
+	Author    string `yaml:"author"`
+	Hunk      string `yaml:"hunk"`
+	Added     string `yaml:"added"`
+	Deleted   string `yaml:"deleted"`
+	Error     string `yaml:"error"`
+	// Markdown is the Glamour style READMEs are rendered with: dark, light,
+	// notty or ascii.
+	Markdown string `yaml:"markdown"`
+	// Syntax is the Chroma style files are highlighted with, such as monokai
+	// or github.
+	Syntax string `yaml:"syntax"`
+}
+
+// Theme modes.
+const (
+	ThemeAuto  = "auto"
+	ThemeDark  = "dark"
+	ThemeLight = "light"
+)
+
+var (
+	themeModes     = []string{ThemeAuto, ThemeDark, ThemeLight}
+	themeBorders   = []string{"rounded", "normal", "thick", "double"}
+	markdownStyles = []string{"dark", "light", "notty", "ascii"}
+)
+
+// colorPattern matches the colors of a theme.
+const colorPattern = `^([0-9]{1,3}|#[0-9A-Fa-f]{3}|#[0-9A-Fa-f]{6})$`
+
+var colorRe = regexp.MustCompile(colorPattern)
+
+// validColor reports whether c is an ANSI 256 color number or a hex color.
+func validColor(c string) bool {
+	if !colorRe.MatchString(c) {
+		return false
+	}
+	if n, err := strconv.Atoi(c); err == nil && n > 255 {
+		return false
+	}
+	return true
+}
+
+// colors returns the colors with their keys, in the order of Colors.
+func (c Colors) colors() []struct{ key, color string } {
+	return []struct{ key, color string }{
+		{"accent", c.Accent},
+		{"border", c.Border},
+		{"cursor", c.Cursor},
+		{"selected", c.Selected},
+		{"text", c.Text},
+		{"muted", c.Muted},
+		{"faint", c.Faint},
+		{"divider", c.Divider},
+		{"note", c.Note},
+		{"directory", c.Directory},
+		{"hash", c.Hash},
+		{"author", c.Author},
+		{"hunk", c.Hunk},
+		{"added", c.Added},
+		{"deleted", c.Deleted},
+		{"error", c.Error},
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gliderlabs/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem found in a config.yaml.
+type ValidationError struct {
+	// Line is the line of config.yaml the problem was found on, or 0 if the
+	// problem isn't tied to a specific line.
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ValidationErrors is a list of problems found in a config.yaml, sorted by
+// line.
+type ValidationErrors []ValidationError
+
+func (es ValidationErrors) Error() string {
+	s := make([]string, 0, len(es))
+	for _, e := range es {
+		s = append(s, e.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+var (
+	yamlLineRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// yamlParserErrorRe matches the errors of the YAML parser, as opposed to
+	// its scanner. The parser reports the line before the one of the error.
+	yamlParserErrorRe = regexp.MustCompile(`^(?:did not find expected (?:',' or '[\]}]'|'-' indicator|key|node content|<document start>)|found undefined tag handle)$`)
+)
+
+// ValidateConfig parses and validates the contents of a config.yaml. It checks
+// that the config matches the schema of YAMLConfig, that user names are unique
+// and not Anonymous, that public keys are well-formed and that users only
+// collaborate on known repos. A repo is known if it's declared in the config
+// or if it's in repos, which should list the repos that exist on disk. If
+// repos is nil, references to repos aren't checked.
+//
+// If the config is invalid, the returned error is a ValidationErrors.
+func ValidateConfig(data []byte, repos []string) error {
+	var es ValidationErrors
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return append(es, yamlError(err)...)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var c YAMLConfig
+	err = dec.Decode(&c)
+	if err != nil && err != io.EOF {
+		// Type errors don't stop decoding, so we can still check the rest.
+		es = append(es, yamlError(err)...)
+		if _, ok := err.(*yaml.TypeError); !ok {
+			return es
+		}
+	}
+	if len(root.Content) == 0 {
+		return append(es, ValidationError{Message: "config is empty"})
+	}
+	doc := root.Content[0]
+
+	switch c.AnonAccess {
+	case "", "no-access", "read-only", "read-write":
+	default:
+		es = append(es, ValidationError{
+			Line:    valueLine(doc, "anon-access"),
+			Message: fmt.Sprintf("invalid anon-access %q, must be one of no-access, read-only or read-write", c.AnonAccess),
+		})
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		es = append(es, ValidationError{
+			Line:    valueLine(doc, "port"),
+			Message: fmt.Sprintf("invalid port %d", c.Port),
+		})
+	}
+	qn := mappingValue(doc, "quotas")
+	for _, q := range []struct{ key, size string }{
+		{"max-repo-size", c.Quotas.MaxRepoSize},
+		{"max-object-size", c.Quotas.MaxObjectSize},
+		{"max-user-size", c.Quotas.MaxUserSize},
+	} {
+		if _, err := parseSize(q.size); err != nil {
+			es = append(es, ValidationError{
+				Line:    valueLine(qn, q.key),
+				Message: fmt.Sprintf("invalid %s %q, must be a size such as 500MB or 2GiB", q.key, q.size),
+			})
+		}
+	}
+	mn := mappingValue(doc, "maintenance")
+	for _, m := range []struct {
+		key string
+		n   int
+	}{
+		{"pushes", c.Maintenance.Pushes},
+		{"loose-objects", c.Maintenance.LooseObjects},
+		{"concurrency", c.Maintenance.Concurrency},
+	} {
+		if m.n < 0 {
+			es = append(es, ValidationError{
+				Line:    valueLine(mn, m.key),
+				Message: fmt.Sprintf("invalid %s %d, must not be negative", m.key, m.n),
+			})
+		}
+	}
+	if d, err := parseInterval(c.Maintenance.Interval); err != nil || (d != 0 && d < minMaintenanceInterval) {
+		es = append(es, ValidationError{
+			Line:    valueLine(mn, "interval"),
+			Message: fmt.Sprintf("invalid interval %q, must be a duration of at least 1m such as 30m or 2h", c.Maintenance.Interval),
+		})
+	}
+	ln := mappingValue(doc, "limits")
+	for _, l := range []struct {
+		key string
+		n   int
+	}{
+		{"max-sessions", c.Limits.MaxSessions},
+		{"git-per-minute", c.Limits.GitPerMinute},
+		{"auth-failures", c.Limits.AuthFailures},
+	} {
+		if l.n < 0 {
+			es = append(es, ValidationError{
+				Line:    valueLine(ln, l.key),
+				Message: fmt.Sprintf("invalid %s %d, must not be negative", l.key, l.n),
+			})
+		}
+	}
+	if d, err := parseInterval(c.Limits.Lockout); err != nil || d < 0 || d > MaxLockout {
+		es = append(es, ValidationError{
+			Line:    valueLine(ln, "lockout"),
+			Message: fmt.Sprintf("invalid lockout %q, must be a duration of at most 1h such as 30s or 5m", c.Limits.Lockout),
+		})
+	}
+	tn := mappingValue(doc, "theme")
+	if c.Theme.Mode != "" && !contains(themeModes, c.Theme.Mode) {
+		es = append(es, ValidationError{
+			Line:    valueLine(tn, "mode"),
+			Message: fmt.Sprintf("invalid theme mode %q, must be one of auto, dark or light", c.Theme.Mode),
+		})
+	}
+	if c.Theme.Border != "" && !contains(themeBorders, c.Theme.Border) {
+		es = append(es, ValidationError{
+			Line:    valueLine(tn, "border"),
+			Message: fmt.Sprintf("invalid theme border %q, must be one of rounded, normal, thick or double", c.Theme.Border),
+		})
+	}
+	for _, m := range []struct {
+		key    string
+		colors Colors
+	}{
+		{"dark", c.Theme.Dark},
+		{"light", c.Theme.Light},
+	} {
+		cn := mappingValue(tn, m.key)
+		for _, cc := range m.colors.colors() {
+			if cc.color != "" && !validColor(cc.color) {
+				es = append(es, ValidationError{
+					Line:    valueLine(cn, cc.key),
+					Message: fmt.Sprintf("invalid %s color %q, must be a color number from 0 to 255 or a hex color such as #5f5fd7", cc.key, cc.color),
+				})
+			}
+		}
+		if m.colors.Markdown != "" && !contains(markdownStyles, m.colors.Markdown) {
+			es = append(es, ValidationError{
+				Line:    valueLine(cn, "markdown"),
+				Message: fmt.Sprintf("invalid markdown style %q, must be one of dark, light, notty or ascii", m.colors.Markdown),
+			})
+		}
+	}
+
+	known := make(map[string]struct{})
+	for _, r := range repos {
+		known[r] = struct{}{}
+	}
+	rns := sequenceItems(mappingValue(doc, "repos"))
+	declared := make(map[string]int)
+	for i, r := range c.Repos {
+		line := valueLine(nodeAt(rns, i), "repo")
+		if r.Repo == "" {
+			es = append(es, ValidationError{Line: nodeAt(rns, i).Line, Message: "repo is missing"})
+			continue
+		}
+		if l, ok := declared[r.Repo]; ok {
+			es = append(es, ValidationError{
+				Line:    line,
+				Message: fmt.Sprintf("repo %q is already declared on line %d", r.Repo, l),
+			})
+			continue
+		}
+		declared[r.Repo] = line
+		known[r.Repo] = struct{}{}
+	}
+
+	uns := sequenceItems(mappingValue(doc, "users"))
+	names := make(map[string]int)
+	keys := make(map[string]string)
+	for i, u := range c.Users {
+		un := nodeAt(uns, i)
+		line := valueLine(un, "name")
+		if u.Name == "" {
+			es = append(es, ValidationError{Line: un.Line, Message: "user name is missing"})
+		} else if u.Name == Anonymous {
+			es = append(es, ValidationError{
+				Line:    line,
+				Message: fmt.Sprintf("user name %q is reserved for users without a key", u.Name),
+			})
+		} else if l, ok := names[u.Name]; ok {
+			es = append(es, ValidationError{
+				Line:    line,
+				Message: fmt.Sprintf("user %q is already declared on line %d", u.Name, l),
+			})
+		} else {
+			names[u.Name] = line
+		}
+		kns := sequenceItems(mappingValue(un, "public-keys"))
+		for j, k := range u.PublicKeys {
+			pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(k)))
+			if err != nil {
+				es = append(es, ValidationError{
+					Line:    nodeAt(kns, j).Line,
+					Message: fmt.Sprintf("malformed public key for user %q: %s", u.Name, err),
+				})
+				continue
+			}
+			fp := string(pk.Marshal())
+			if o, ok := keys[fp]; ok && o != u.Name {
+				es = append(es, ValidationError{
+					Line:    nodeAt(kns, j).Line,
+					Message: fmt.Sprintf("public key of user %q is already used by user %q", u.Name, o),
+				})
+				continue
+			}
+			keys[fp] = u.Name
+		}
+		if repos == nil {
+			continue
+		}
+		cns := sequenceItems(mappingValue(un, "collab-repos"))
+		for j, r := range u.CollabRepos {
+			if _, ok := known[r]; !ok {
+				es = append(es, ValidationError{
+					Line:    nodeAt(cns, j).Line,
+					Message: fmt.Sprintf("user %q collaborates on unknown repo %q", u.Name, r),
+				})
+			}
+		}
+	}
+
+	if len(es) == 0 {
+		return nil
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		return es[i].Line < es[j].Line
+	})
+	return es
+}
+
+// WriteValidationErrors writes the problems reported by ValidateConfig for the
+// given file to w, one per line, prefixed with the file name and line.
+func WriteValidationErrors(w io.Writer, file string, err error) {
+	es, ok := err.(ValidationErrors)
+	if !ok {
+		es = ValidationErrors{{Message: err.Error()}}
+	}
+	for _, e := range es {
+		if e.Line == 0 {
+			fmt.Fprintf(w, "  %s: %s\n", file, e.Message)
+		} else {
+			fmt.Fprintf(w, "  %s:%d: %s\n", file, e.Line, e.Message)
+		}
+	}
+}
+
+// yamlError converts an error returned by the YAML parser into validation
+// errors, extracting the line numbers the parser reports.
+func yamlError(err error) ValidationErrors {
+	msgs := []string{err.Error()}
+	if te, ok := err.(*yaml.TypeError); ok {
+		msgs = te.Errors
+	}
+	es := make(ValidationErrors, 0, len(msgs))
+	for _, m := range msgs {
+		e := ValidationError{Message: m}
+		if sm := yamlLineRe.FindStringSubmatch(m); sm != nil {
+			e.Line, _ = strconv.Atoi(sm[1])
+			e.Message = sm[2]
+			if yamlParserErrorRe.MatchString(e.Message) {
+				e.Line++
+			}
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+// mappingValue returns the value node of key in mapping node n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	n = resolveAlias(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// valueLine returns the line of the value of key in mapping node n, falling
+// back to the line of n itself.
+func valueLine(n *yaml.Node, key string) int {
+	if v := mappingValue(n, key); v != nil {
+		return v.Line
+	}
+	if n == nil {
+		return 0
+	}
+	return n.Line
+}
+
+// sequenceItems returns the items of sequence node n.
+func sequenceItems(n *yaml.Node) []*yaml.Node {
+	n = resolveAlias(n)
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// nodeAt returns the i-th node of ns. The nodes are indexed in parallel with
+// the decoded values, so an empty node is returned if they don't line up.
+func nodeAt(ns []*yaml.Node, i int) *yaml.Node {
+	if i < len(ns) {
+		return resolveAlias(ns[i])
+	}
+	return &yaml.Node{}
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
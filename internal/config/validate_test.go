@@ -0,0 +1,130 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const testKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFdU1EBPr9369lMgGzCjDE4iVJ8QJIdrmm+VtkybYzMr"
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		repos  []string
+		// want maps the lines of the expected errors to a part of their
+		// message.
+		want map[int]string
+	}{
+		{
+			name: "valid",
+			config: `name: Soft Serve
+anon-access: read-only
+repos:
+  - name: Home
+    repo: config
+users:
+  - name: alice
+    public-keys:
+      - ` + testKey + `
+    collab-repos:
+      - config
+      - soft
+`,
+			repos: []string{"soft"},
+		},
+		{
+			name:   "syntax",
+			config: "name: Soft Serve\nusers:\n  - name: [alice\n",
+			want:   map[int]string{3: "did not find expected ',' or ']'"},
+		},
+		{
+			name:   "scanner",
+			config: "name: Soft Serve\nport: 23231\n host: localhost\n",
+			want:   map[int]string{3: "mapping values are not allowed"},
+		},
+		{
+			name:   "block mapping",
+			config: "name: Soft Serve\nusers:\n  name: alice\n - name: bob\n",
+			want:   map[int]string{4: "did not find expected key"},
+		},
+		{
+			name:   "type",
+			config: "name: Soft Serve\nport: high\n",
+			want:   map[int]string{2: "cannot unmarshal"},
+		},
+		{
+			name:   "unknown field",
+			config: "name: Soft Serve\n\nanon-acess: read-only\n",
+			want:   map[int]string{3: "field anon-acess not found"},
+		},
+		{
+			name: "values",
+			config: `anon-access: everyone
+port: 70000
+limits:
+  lockout: 2h
+theme:
+  dark:
+    accent: "#zzz"
+`,
+			want: map[int]string{
+				1: "invalid anon-access",
+				2: "invalid port",
+				4: "invalid lockout",
+				7: "invalid accent color",
+			},
+		},
+		{
+			name: "users",
+			config: `repos:
+  - repo: soft
+  - repo: soft
+users:
+  - name: alice
+    public-keys:
+      - ` + testKey + `
+  - name: bob
+    public-keys:
+      - ` + testKey + `
+      - not a key
+    collab-repos:
+      - missing
+  - name: alice
+  - name: anonymous
+`,
+			repos: []string{},
+			want: map[int]string{
+				3:  `repo "soft" is already declared on line 2`,
+				10: `already used by user "alice"`,
+				11: "malformed public key",
+				13: `unknown repo "missing"`,
+				14: `user "alice" is already declared on line 5`,
+				15: "reserved",
+			},
+		},
+	}
+	for _, c := range cases {
+		err := ValidateConfig([]byte(c.config), c.repos)
+		if len(c.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", c.name, err)
+			}
+			continue
+		}
+		es, ok := err.(ValidationErrors)
+		if !ok {
+			t.Errorf("%s: got %v, want ValidationErrors", c.name, err)
+			continue
+		}
+		if len(es) != len(c.want) {
+			t.Errorf("%s: got errors\n%s", c.name, es)
+			continue
+		}
+		for _, e := range es {
+			if !strings.Contains(e.Message, c.want[e.Line]) || c.want[e.Line] == "" {
+				t.Errorf("%s: unexpected error %q", c.name, e)
+			}
+		}
+	}
+}
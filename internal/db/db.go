@@ -0,0 +1,120 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound indicates that the requested record could not be found.
+var ErrNotFound = errors.New("not found")
+
+// ErrLocked indicates that the database is in use by another process, such as
+// a running server.
+var ErrLocked = errors.New("database is locked by another process")
+
+var (
+	metaBucket        = []byte("meta")
+	reposBucket       = []byte("repos")
+	usersBucket       = []byte("users")
+	settingsBucket    = []byte("settings")
+	starsBucket       = []byte("stars")
+	tokensBucket      = []byte("tokens")
+	deliveriesBucket  = []byte("deliveries")
+	lfsObjectsBucket  = []byte("lfs-objects")
+	lfsLocksBucket    = []byte("lfs-locks")
+	maintenanceBucket = []byte("maintenance")
+	pushesBucket      = []byte("pushes")
+
+	versionKey = []byte("version")
+)
+
+// DB is an embedded database holding the durable state of a Soft Serve
+// server, such as repository metadata, users and access tokens.
+type DB struct {
+	bolt *bolt.DB
+}
+
+// Open opens the database at path, creating it if it doesn't exist, and runs
+// any pending migrations.
+func Open(path string) (*DB, error) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.FileMode(0700))
+	if err != nil {
+		return nil, err
+	}
+	bdb, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &DB{bolt: bdb}
+	err = d.Migrate()
+	if err != nil {
+		bdb.Close() // nolint: errcheck
+		return nil, err
+	}
+	return d, nil
+}
+
+// CheckUnlocked returns ErrLocked if the database at path is open in another
+// process, such as a running server. Unlike Open, it doesn't migrate the
+// database.
+func CheckUnlocked(path string) error {
+	bdb, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err == bolt.ErrTimeout {
+		return fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+	if err != nil {
+		return err
+	}
+	return bdb.Close()
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.bolt.Close()
+}
+
+// Snapshot writes a consistent copy of the database to w. The database can be
+// written to while the snapshot is taken.
+func (d *DB) Snapshot(w io.Writer) error {
+	return d.bolt.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+// get decodes the JSON value stored at key in bucket b into v.
+func get(tx *bolt.Tx, b []byte, key string, v interface{}) error {
+	data := tx.Bucket(b).Get([]byte(key))
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+// put stores the JSON encoding of v at key in bucket b.
+func put(tx *bolt.Tx, b []byte, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(b).Put([]byte(key), data)
+}
+
+// del deletes key from bucket b, returning ErrNotFound if it doesn't exist.
+func del(tx *bolt.Tx, b []byte, key string) error {
+	bk := tx.Bucket(b)
+	if bk.Get([]byte(key)) == nil {
+		return ErrNotFound
+	}
+	return bk.Delete([]byte(key))
+}
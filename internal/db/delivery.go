@@ -0,0 +1,61 @@
+package db
+
+import (
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Delivery is the log entry of a webhook delivery.
+type Delivery struct {
+	ID         uint64        `json:"id"`
+	Route      string        `json:"route"`
+	Event      string        `json:"event"`
+	Repo       string        `json:"repo"`
+	StatusCode int           `json:"status_code"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// AddDelivery logs a webhook delivery, assigning it a new ID.
+func (d *DB) AddDelivery(dl *Delivery) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(deliveriesBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		dl.ID = id
+		if dl.CreatedAt.IsZero() {
+			dl.CreatedAt = time.Now()
+		}
+		return put(tx, deliveriesBucket, string(deliveryKey(id)), dl)
+	})
+}
+
+// Deliveries returns up to limit webhook deliveries, newest first.
+func (d *DB) Deliveries(limit int) ([]*Delivery, error) {
+	dls := make([]*Delivery, 0)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deliveriesBucket).Cursor()
+		for k, _ := c.Last(); k != nil && len(dls) < limit; k, _ = c.Prev() {
+			dl := &Delivery{}
+			err := get(tx, deliveriesBucket, string(k), dl)
+			if err != nil {
+				return err
+			}
+			dls = append(dls, dl)
+		}
+		return nil
+	})
+	return dls, err
+}
+
+// deliveryKey returns the key of a delivery. Keys are big-endian so that
+// deliveries are sorted by ID.
+func deliveryKey(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
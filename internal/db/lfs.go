@@ -0,0 +1,165 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrLockExists indicates that a path is already locked.
+var ErrLockExists = errors.New("lock exists")
+
+// LFSObject is an LFS object stored for a repository. An object stored for
+// several repositories has a record for each of them.
+type LFSObject struct {
+	Repo      string    `json:"repo"`
+	OID       string    `json:"oid"`
+	Size      int64     `json:"size"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LFSUsage is the LFS storage used by a repository.
+type LFSUsage struct {
+	Objects int   `json:"objects"`
+	Size    int64 `json:"size"`
+}
+
+// LFSLock is a lock on a file of a repository.
+type LFSLock struct {
+	ID       string    `json:"id"`
+	Repo     string    `json:"repo"`
+	Path     string    `json:"path"`
+	Owner    string    `json:"owner"`
+	LockedAt time.Time `json:"locked_at"`
+}
+
+// LFSObject returns the record of an LFS object of a repository.
+func (d *DB) LFSObject(repo, oid string) (*LFSObject, error) {
+	o := &LFSObject{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, lfsObjectsBucket, string(lfsKey(repo, oid)), o)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// AddLFSObject records an LFS object of a repository. It returns false if the
+// object was already recorded.
+func (d *DB) AddLFSObject(o *LFSObject) (bool, error) {
+	var added bool
+	err := d.bolt.Update(func(tx *bolt.Tx) error {
+		k := lfsKey(o.Repo, o.OID)
+		if tx.Bucket(lfsObjectsBucket).Get(k) != nil {
+			return nil
+		}
+		added = true
+		if o.CreatedAt.IsZero() {
+			o.CreatedAt = time.Now()
+		}
+		return put(tx, lfsObjectsBucket, string(k), o)
+	})
+	return added, err
+}
+
+// LFSUsage returns the LFS storage used by a repository.
+func (d *DB) LFSUsage(repo string) (*LFSUsage, error) {
+	u := &LFSUsage{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(lfsObjectsBucket).Cursor()
+		p := lfsKey(repo, "")
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			o := &LFSObject{}
+			err := json.Unmarshal(v, o)
+			if err != nil {
+				return err
+			}
+			u.Objects++
+			u.Size += o.Size
+		}
+		return nil
+	})
+	return u, err
+}
+
+// CreateLFSLock locks a path of a repository, assigning the lock a new ID. If
+// the path is already locked, it returns the existing lock and ErrLockExists.
+func (d *DB) CreateLFSLock(l *LFSLock) (*LFSLock, error) {
+	var existing *LFSLock
+	err := d.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(lfsLocksBucket)
+		c := b.Cursor()
+		p := lfsKey(l.Repo, "")
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			el := &LFSLock{}
+			err := json.Unmarshal(v, el)
+			if err != nil {
+				return err
+			}
+			if el.Path == l.Path {
+				existing = el
+				return ErrLockExists
+			}
+		}
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		l.ID = strconv.FormatUint(id, 10)
+		if l.LockedAt.IsZero() {
+			l.LockedAt = time.Now()
+		}
+		return put(tx, lfsLocksBucket, string(lfsKey(l.Repo, l.ID)), l)
+	})
+	return existing, err
+}
+
+// LFSLock returns a lock of a repository by ID.
+func (d *DB) LFSLock(repo, id string) (*LFSLock, error) {
+	l := &LFSLock{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, lfsLocksBucket, string(lfsKey(repo, id)), l)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LFSLocks returns the locks of a repository.
+func (d *DB) LFSLocks(repo string) ([]*LFSLock, error) {
+	ls := make([]*LFSLock, 0)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(lfsLocksBucket).Cursor()
+		p := lfsKey(repo, "")
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			l := &LFSLock{}
+			err := json.Unmarshal(v, l)
+			if err != nil {
+				return err
+			}
+			ls = append(ls, l)
+		}
+		return nil
+	})
+	return ls, err
+}
+
+// DeleteLFSLock deletes a lock of a repository by ID.
+func (d *DB) DeleteLFSLock(repo, id string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return del(tx, lfsLocksBucket, string(lfsKey(repo, id)))
+	})
+}
+
+// lfsKey returns the key of an LFS object or lock. Like star keys, all keys
+// of a repo share the same prefix.
+func lfsKey(repo, id string) []byte {
+	return []byte(repo + "\x00" + id)
+}
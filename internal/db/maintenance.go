@@ -0,0 +1,60 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MaintenanceRun records a maintenance run of a repository.
+type MaintenanceRun struct {
+	Repo string `json:"repo"`
+	// Trigger is why the repository was maintained, such as the number of
+	// pushes or loose objects.
+	Trigger    string        `json:"trigger"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   time.Duration `json:"duration"`
+	SizeBefore int64         `json:"size_before"`
+	SizeAfter  int64         `json:"size_after"`
+	// Error is set if the run failed.
+	Error string `json:"error,omitempty"`
+}
+
+// LastMaintenanceRun returns the last maintenance run of a repository.
+func (d *DB) LastMaintenanceRun(repo string) (*MaintenanceRun, error) {
+	r := &MaintenanceRun{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, maintenanceBucket, repo, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LastMaintenanceRuns returns the last maintenance run of every repository
+// that was maintained, keyed by repository.
+func (d *DB) LastMaintenanceRuns() (map[string]*MaintenanceRun, error) {
+	rs := make(map[string]*MaintenanceRun)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(maintenanceBucket).ForEach(func(k, v []byte) error {
+			r := &MaintenanceRun{}
+			err := json.Unmarshal(v, r)
+			if err != nil {
+				return err
+			}
+			rs[string(k)] = r
+			return nil
+		})
+	})
+	return rs, err
+}
+
+// PutMaintenanceRun records a maintenance run, replacing the last run of the
+// repository.
+func (d *DB) PutMaintenanceRun(r *MaintenanceRun) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return put(tx, maintenanceBucket, r.Repo, r)
+	})
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// migration upgrades the database schema by one version.
+type migration struct {
+	name string
+	run  func(tx *bolt.Tx) error
+}
+
+// migrations are applied in order. Never edit or reorder a released
+// migration, add a new one instead.
+var migrations = []migration{
+	{
+		name: "create buckets",
+		run: func(tx *bolt.Tx) error {
+			for _, b := range [][]byte{
+				reposBucket,
+				usersBucket,
+				settingsBucket,
+				starsBucket,
+				tokensBucket,
+				deliveriesBucket,
+			} {
+				_, err := tx.CreateBucketIfNotExists(b)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "create lfs buckets",
+		run: func(tx *bolt.Tx) error {
+			for _, b := range [][]byte{
+				lfsObjectsBucket,
+				lfsLocksBucket,
+			} {
+				_, err := tx.CreateBucketIfNotExists(b)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "create maintenance bucket",
+		run: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(maintenanceBucket)
+			return err
+		},
+	},
+	{
+		name: "create pushes bucket",
+		run: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(pushesBucket)
+			return err
+		},
+	},
+}
+
+// LatestVersion is the schema version of a fully migrated database.
+var LatestVersion = len(migrations)
+
+// Version returns the current schema version of the database.
+func (d *DB) Version() (int, error) {
+	var v int
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		v = version(tx)
+		return nil
+	})
+	return v, err
+}
+
+// Migrate applies all pending migrations. Each migration runs in its own
+// transaction, so a failed migration leaves the database at the last
+// successfully applied version.
+func (d *DB) Migrate() error {
+	for {
+		var done bool
+		err := d.bolt.Update(func(tx *bolt.Tx) error {
+			mb, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			v := version(tx)
+			if v > LatestVersion {
+				return fmt.Errorf("database version %d is newer than supported version %d", v, LatestVersion)
+			}
+			if v == LatestVersion {
+				done = true
+				return nil
+			}
+			m := migrations[v]
+			err = m.run(tx)
+			if err != nil {
+				return fmt.Errorf("migration %d (%s): %w", v+1, m.name, err)
+			}
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, uint64(v+1))
+			return mb.Put(versionKey, buf)
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+func version(tx *bolt.Tx) int {
+	mb := tx.Bucket(metaBucket)
+	if mb == nil {
+		return 0
+	}
+	v := mb.Get(versionKey)
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
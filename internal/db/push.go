@@ -0,0 +1,101 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxPushes is the number of pushes kept in the log. Older ones are dropped
+// as new ones are added.
+const maxPushes = 1000
+
+// Push is the log entry of a ref changed by a push.
+type Push struct {
+	ID   uint64 `json:"id"`
+	Repo string `json:"repo"`
+	// Ref is the full name of the ref, such as refs/heads/main.
+	Ref    string `json:"ref"`
+	Pusher string `json:"pusher"`
+	// Old is the commit the ref pointed to before the push, empty if the push
+	// created it, and New the one after, empty if the push deleted it.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// Commits are the newest commits the push added, newest first, and Total
+	// the number of commits it added.
+	Commits   []PushCommit `json:"commits,omitempty"`
+	Total     int          `json:"total"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// PushCommit is a commit added by a push.
+type PushCommit struct {
+	Hash    string `json:"hash"`
+	Subject string `json:"subject"`
+	Author  string `json:"author"`
+}
+
+// AddPush logs a push, assigning it a new ID, and drops the pushes older than
+// the last maxPushes.
+func (d *DB) AddPush(p *Push) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pushesBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		p.ID = id
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = time.Now()
+		}
+		err = put(tx, pushesBucket, string(pushKey(id)), p)
+		if err != nil {
+			return err
+		}
+		if id <= maxPushes {
+			return nil
+		}
+		var old [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= id-maxPushes; k, _ = c.Next() {
+			old = append(old, append([]byte(nil), k...))
+		}
+		for _, k := range old {
+			err = b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Pushes returns up to limit pushes for which keep returns true, newest first.
+func (d *DB) Pushes(limit int, keep func(*Push) bool) ([]*Push, error) {
+	ps := make([]*Push, 0)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(pushesBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(ps) < limit; k, v = c.Prev() {
+			p := &Push{}
+			err := json.Unmarshal(v, p)
+			if err != nil {
+				return err
+			}
+			if keep(p) {
+				ps = append(ps, p)
+			}
+		}
+		return nil
+	})
+	return ps, err
+}
+
+// pushKey returns the key of a push. Keys are big-endian so that pushes are
+// sorted by ID.
+func pushKey(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Repo contains the metadata of a repository.
+type Repo struct {
+	// Name is the name of the repository on disk.
+	Name string `json:"name"`
+	// DisplayName is the name shown in the TUI menu.
+	DisplayName string    `json:"display_name"`
+	Note        string    `json:"note"`
+	Private     bool      `json:"private"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Declared is set for repos declared in config.yaml. The declared fields
+	// are overwritten whenever the config is synced.
+	Declared bool `json:"declared"`
+}
+
+// Repo returns the metadata of the named repository.
+func (d *DB) Repo(name string) (*Repo, error) {
+	r := &Repo{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, reposBucket, name, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Repos returns the metadata of all repositories.
+func (d *DB) Repos() ([]*Repo, error) {
+	rs := make([]*Repo, 0)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(reposBucket).ForEach(func(k, v []byte) error {
+			r := &Repo{}
+			err := json.Unmarshal(v, r)
+			if err != nil {
+				return err
+			}
+			rs = append(rs, r)
+			return nil
+		})
+	})
+	return rs, err
+}
+
+// PutRepo creates or updates the metadata of a repository.
+func (d *DB) PutRepo(r *Repo) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return put(tx, reposBucket, r.Name, r)
+	})
+}
+
+// AddRepo creates the metadata of a repository if it doesn't exist yet. It
+// returns true if the repository was added.
+func (d *DB) AddRepo(r *Repo) (bool, error) {
+	var added bool
+	err := d.bolt.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(reposBucket).Get([]byte(r.Name)) != nil {
+			return nil
+		}
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = time.Now()
+		}
+		added = true
+		return put(tx, reposBucket, r.Name, r)
+	})
+	return added, err
+}
+
+// DeleteRepo deletes the metadata, the stars, the last maintenance run and
+// the pushes of a repository.
+func (d *DB) DeleteRepo(name string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		err := del(tx, reposBucket, name)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(maintenanceBucket).Delete([]byte(name))
+		if err != nil {
+			return err
+		}
+		c := tx.Bucket(starsBucket).Cursor()
+		p := starKey(name, "")
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			err = c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+		pb := tx.Bucket(pushesBucket)
+		var pushes [][]byte
+		err = pb.ForEach(func(k, v []byte) error {
+			ps := &Push{}
+			err := json.Unmarshal(v, ps)
+			if err != nil {
+				return err
+			}
+			if ps.Repo == name {
+				pushes = append(pushes, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range pushes {
+			err = pb.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Star stars a repository on behalf of a user.
+func (d *DB) Star(repo, user string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return put(tx, starsBucket, string(starKey(repo, user)), time.Now())
+	})
+}
+
+// Unstar removes the star of a user from a repository.
+func (d *DB) Unstar(repo, user string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return del(tx, starsBucket, string(starKey(repo, user)))
+	})
+}
+
+// Starred returns whether the user starred the repository.
+func (d *DB) Starred(repo, user string) (bool, error) {
+	var starred bool
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		starred = tx.Bucket(starsBucket).Get(starKey(repo, user)) != nil
+		return nil
+	})
+	return starred, err
+}
+
+// Stars returns the number of stars of a repository.
+func (d *DB) Stars(repo string) (int, error) {
+	var n int
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(starsBucket).Cursor()
+		p := starKey(repo, "")
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// starKey returns the key of a star. Repo names can't contain a NUL byte, so
+// all stars of a repo share the same prefix.
+func starKey(repo, user string) []byte {
+	return []byte(repo + "\x00" + user)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Setting returns the value of a server setting.
+func (d *DB) Setting(key string) (string, error) {
+	var v string
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, settingsBucket, key, &v)
+	})
+	return v, err
+}
+
+// SetSetting sets the value of a server setting.
+func (d *DB) SetSetting(key string, value string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return put(tx, settingsBucket, key, value)
+	})
+}
+
+// Settings returns all server settings.
+func (d *DB) Settings() (map[string]string, error) {
+	s := make(map[string]string)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(settingsBucket).ForEach(func(k, v []byte) error {
+			var sv string
+			err := json.Unmarshal(v, &sv)
+			if err != nil {
+				return err
+			}
+			s[string(k)] = sv
+			return nil
+		})
+	})
+	return s, err
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Sync applies the users, repos and settings declared in config.yaml to the
+// database in a single transaction. Declared users that are no longer in the
+// config are removed, while repos keep their metadata and are only marked as
+// undeclared, since they still exist on disk. State that isn't part of the
+// config, such as stars, tokens and who created a repo, is left untouched.
+func (d *DB) Sync(users []*User, repos []*Repo, settings map[string]string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		du := make(map[string]struct{}, len(users))
+		for _, u := range users {
+			du[u.Name] = struct{}{}
+			eu := &User{}
+			err := get(tx, usersBucket, u.Name, eu)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			nu := *u
+			nu.Declared = true
+			nu.CreatedAt = eu.CreatedAt
+			if nu.CreatedAt.IsZero() {
+				nu.CreatedAt = now
+			}
+			err = put(tx, usersBucket, nu.Name, &nu)
+			if err != nil {
+				return err
+			}
+		}
+		stale := make([]string, 0)
+		err := tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			u := &User{}
+			err := json.Unmarshal(v, u)
+			if err != nil {
+				return err
+			}
+			if _, ok := du[u.Name]; u.Declared && !ok {
+				stale = append(stale, u.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range stale {
+			err = del(tx, usersBucket, name)
+			if err != nil {
+				return err
+			}
+			err = deleteUserTokens(tx, name)
+			if err != nil {
+				return err
+			}
+		}
+
+		dr := make(map[string]struct{}, len(repos))
+		for _, r := range repos {
+			dr[r.Name] = struct{}{}
+			er := &Repo{}
+			err := get(tx, reposBucket, r.Name, er)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			if err == ErrNotFound {
+				er.Name = r.Name
+				er.CreatedAt = now
+			}
+			er.DisplayName = r.DisplayName
+			er.Note = r.Note
+			er.Private = r.Private
+			er.Declared = true
+			err = put(tx, reposBucket, er.Name, er)
+			if err != nil {
+				return err
+			}
+		}
+		undeclared := make([]*Repo, 0)
+		err = tx.Bucket(reposBucket).ForEach(func(k, v []byte) error {
+			r := &Repo{}
+			err := json.Unmarshal(v, r)
+			if err != nil {
+				return err
+			}
+			if _, ok := dr[r.Name]; r.Declared && !ok {
+				undeclared = append(undeclared, r)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range undeclared {
+			r.Declared = false
+			err = put(tx, reposBucket, r.Name, r)
+			if err != nil {
+				return err
+			}
+		}
+
+		for k, v := range settings {
+			err = put(tx, settingsBucket, k, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// User is a Soft Serve user.
+type User struct {
+	Name        string    `json:"name"`
+	Admin       bool      `json:"admin"`
+	PublicKeys  []string  `json:"public_keys"`
+	CollabRepos []string  `json:"collab_repos"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Declared is set for users declared in config.yaml. Declared users are
+	// removed when they're removed from the config.
+	Declared bool `json:"declared"`
+}
+
+// Token is an access token. The token itself is never stored, only its
+// SHA-256 hash, which is used as the token ID.
+type Token struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is the zero time for tokens that never expire.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired returns whether the token has expired.
+func (t *Token) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+// User returns the named user.
+func (d *DB) User(name string) (*User, error) {
+	u := &User{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, usersBucket, name, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Users returns all users.
+func (d *DB) Users() ([]*User, error) {
+	us := make([]*User, 0)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			u := &User{}
+			err := json.Unmarshal(v, u)
+			if err != nil {
+				return err
+			}
+			us = append(us, u)
+			return nil
+		})
+	})
+	return us, err
+}
+
+// PutUser creates or updates a user.
+func (d *DB) PutUser(u *User) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		if u.CreatedAt.IsZero() {
+			u.CreatedAt = time.Now()
+		}
+		return put(tx, usersBucket, u.Name, u)
+	})
+}
+
+// DeleteUser deletes a user along with their tokens.
+func (d *DB) DeleteUser(name string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		err := del(tx, usersBucket, name)
+		if err != nil {
+			return err
+		}
+		return deleteUserTokens(tx, name)
+	})
+}
+
+// CreateToken creates a new access token for a user. The returned string is
+// the token itself, which can't be retrieved later on.
+func (d *DB) CreateToken(user string, note string, expiresAt time.Time) (string, *Token, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := hex.EncodeToString(b)
+	t := &Token{
+		ID:        tokenID(raw),
+		User:      user,
+		Note:      note,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	err = d.bolt.Update(func(tx *bolt.Tx) error {
+		return put(tx, tokensBucket, t.ID, t)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, t, nil
+}
+
+// Token looks up an access token. It returns ErrNotFound if the token doesn't
+// exist or has expired.
+func (d *DB) Token(raw string) (*Token, error) {
+	t := &Token{}
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx, tokensBucket, tokenID(raw), t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.Expired() {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+// UserTokens returns all access tokens of a user.
+func (d *DB) UserTokens(user string) ([]*Token, error) {
+	ts := make([]*Token, 0)
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).ForEach(func(k, v []byte) error {
+			t := &Token{}
+			err := json.Unmarshal(v, t)
+			if err != nil {
+				return err
+			}
+			if t.User == user {
+				ts = append(ts, t)
+			}
+			return nil
+		})
+	})
+	return ts, err
+}
+
+// DeleteToken deletes an access token by ID.
+func (d *DB) DeleteToken(id string) error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return del(tx, tokensBucket, id)
+	})
+}
+
+// DeleteExpiredTokens deletes all access tokens that have expired.
+func (d *DB) DeleteExpiredTokens() error {
+	return d.bolt.Update(func(tx *bolt.Tx) error {
+		return deleteTokens(tx, func(t *Token) bool {
+			return t.Expired()
+		})
+	})
+}
+
+func deleteUserTokens(tx *bolt.Tx, user string) error {
+	return deleteTokens(tx, func(t *Token) bool {
+		return t.User == user
+	})
+}
+
+// deleteTokens deletes the access tokens matching f.
+func deleteTokens(tx *bolt.Tx, f func(t *Token) bool) error {
+	b := tx.Bucket(tokensBucket)
+	ids := make([][]byte, 0)
+	err := b.ForEach(func(k, v []byte) error {
+		t := &Token{}
+		err := json.Unmarshal(v, t)
+		if err != nil {
+			return err
+		}
+		if f(t) {
+			ids = append(ids, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err = b.Delete(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tokenID(raw string) string {
+	h := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(h[:])
+}
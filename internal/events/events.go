@@ -0,0 +1,122 @@
+// Package events tells the parts of the server that show the repos, such as
+// the TUI, when the repos or the configuration change.
+package events
+
+import "sync"
+
+// Type is the kind of change an event is about.
+type Type int
+
+const (
+	// Push is published when refs of a repo are pushed.
+	Push Type = iota
+	// Create is published when a repo is created, by its first push or by an
+	// import.
+	Create
+	// Reload is published when the configuration is reloaded.
+	Reload
+)
+
+// Event is a change of a repo or of the configuration.
+type Event struct {
+	Type Type
+	// Repo is the repo that was pushed or created, empty for Reload.
+	Repo string
+}
+
+// Bus delivers the events published to every subscriber. A nil Bus drops the
+// events.
+type Bus struct {
+	mtx  sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives the events published to a Bus until it's closed. C
+// receives a value whenever events are pending, which Events returns.
+//
+// Events are never dropped, however far behind the subscriber is. Instead,
+// pending events are coalesced: an event published again while it's pending
+// is only returned once, and a Reload replaces the other pending events, as
+// it covers every repo.
+type Subscription struct {
+	C    <-chan struct{}
+	c    chan struct{}
+	bus  *Bus
+	once sync.Once
+	// mtx guards pending.
+	mtx     sync.Mutex
+	pending []Event
+}
+
+// NewBus returns a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a Subscription to the events published from now on.
+func (b *Bus) Subscribe() *Subscription {
+	c := make(chan struct{}, 1)
+	s := &Subscription{C: c, c: c, bus: b}
+	if b == nil {
+		return s
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish sends an event to the subscribers without waiting for them.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for s := range b.subs {
+		s.add(e)
+		select {
+		case s.c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add adds an event to the pending events, coalescing it with them.
+func (s *Subscription) add(e Event) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if e.Type == Reload {
+		s.pending = []Event{e}
+		return
+	}
+	for _, p := range s.pending {
+		if p == e || p.Type == Reload {
+			return
+		}
+	}
+	s.pending = append(s.pending, e)
+}
+
+// Events returns the pending events, oldest first, and forgets them.
+func (s *Subscription) Events() []Event {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	es := s.pending
+	s.pending = nil
+	return es
+}
+
+// Close unsubscribes from the Bus and closes C.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		if s.bus != nil {
+			s.bus.mtx.Lock()
+			defer s.bus.mtx.Unlock()
+			delete(s.bus.subs, s)
+		}
+		close(s.c)
+	})
+}
@@ -0,0 +1,333 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// ErrEmptyRepo indicates that a repository has no refs, so it can't be
+// bundled.
+var ErrEmptyRepo = errors.New("repo has no refs")
+
+// Refs returns the refs of a repository, mapped to the objects they point to,
+// and the ref HEAD points to.
+func (rs *RepoSource) Refs(name string) (map[string]string, string, error) {
+	rp := filepath.Join(rs.Path, name)
+	out, err := gitOutput(rp, "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return nil, "", err
+	}
+	refs := parseRefs(out)
+	head, err := gitOutput(rp, "symbolic-ref", "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+	return refs, strings.TrimSpace(head), nil
+}
+
+// CreateBundle writes a git bundle of the given refs of a repository to w. If
+// no refs are given, all refs are bundled. Like a fetch, it holds the read
+// lock of the repository.
+func (rs *RepoSource) CreateBundle(name string, w io.Writer, refs ...string) error {
+	unlock := rs.Locks.Lock(name, ReadLock)
+	defer unlock()
+	rp := filepath.Join(rs.Path, name)
+	if len(refs) == 0 {
+		out, err := gitOutput(rp, "for-each-ref", "--count=1")
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(out) == "" {
+			return fmt.Errorf("%w: %s", ErrEmptyRepo, name)
+		}
+		refs = []string{"--all"}
+	}
+	cmd := exec.Command("git", append([]string{"bundle", "create", "--quiet", "-"}, refs...)...)
+	cmd.Dir = rp
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("git bundle: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// BundleHeads returns the refs contained in the bundle at path, mapped to the
+// objects they point to.
+func BundleHeads(path string) (map[string]string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := gitOutput("", "bundle", "list-heads", path)
+	if err != nil {
+		return nil, err
+	}
+	refs := parseRefs(out)
+	delete(refs, "HEAD")
+	return refs, nil
+}
+
+// FetchBundle fetches all refs of the bundle at path into a repository,
+// creating it if it doesn't exist. Refs are only updated if they fast-forward.
+// If the repository is created, HEAD is pointed at head, or at the branch the
+// HEAD of the bundle points to if head isn't set. Like a push, the fetch holds
+// the write lock of the repository.
+func (rs *RepoSource) FetchBundle(name string, path string, head string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	unlock := rs.Locks.Lock(name, WriteLock)
+	defer unlock()
+	rp := filepath.Join(rs.Path, name)
+	_, err = os.Stat(rp)
+	if os.IsNotExist(err) {
+		if head == "" {
+			head, err = bundleHead(path)
+			if err != nil {
+				return err
+			}
+		}
+		err = rs.initBareRepo(name, head)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	err = runGit(rp, "fetch", "--quiet", path, "refs/*:refs/*")
+	if err != nil {
+		return err
+	}
+	err = runGit(rp, "update-server-info")
+	if err != nil {
+		return err
+	}
+	return rs.updateRepo(name)
+}
+
+// PushBundle pushes all refs of the bundle at path into a repository,
+// creating it if it doesn't exist, like FetchBundle. Rather than being fetched,
+// the refs are received by receive-pack like those of a push, so that the
+// hooks check them, with env added to their environment. It returns the refs
+// that changed, like ReceivePack. A repository created for the bundle is
+// removed again if the bundle isn't pushed, for example because the hooks
+// rejected it.
+func (rs *RepoSource) PushBundle(name string, path string, env []string) ([]RefUpdate, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	unlock := rs.Locks.Lock(name, WriteLock)
+	defer unlock()
+	// The repository is pushed to from another directory.
+	rp, err := filepath.Abs(filepath.Join(rs.Path, name))
+	if err != nil {
+		return nil, err
+	}
+	var created bool
+	_, err = os.Stat(rp)
+	if os.IsNotExist(err) {
+		var head string
+		head, err = bundleHead(path)
+		if err != nil {
+			return nil, err
+		}
+		created = true
+		defer func() {
+			if created {
+				os.RemoveAll(rp) // nolint: errcheck
+			}
+		}()
+		err = rs.createBareRepo(name, head)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	rg, err := git.PlainOpen(rp)
+	if err != nil {
+		return nil, err
+	}
+	old, err := commitRefs(rg)
+	if err != nil {
+		return nil, err
+	}
+	// The bundle is fetched into a scratch repository borrowing the objects
+	// of the repository, so that it only holds what the bundle adds, and
+	// pushed from there.
+	tmp, err := os.MkdirTemp("", "soft-serve-unbundle")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp) // nolint: errcheck
+	err = runGit("", "init", "--bare", "--quiet", tmp)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(tmp, "objects", "info", "alternates"), []byte(filepath.Join(rp, "objects")+"\n"), 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = runGit(tmp, "fetch", "--quiet", path, "refs/*:refs/*")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"push", "--quiet"}
+	if rs.HooksPath != "" {
+		args = append(args, "--receive-pack=git -c core.hooksPath="+shellQuote(rs.HooksPath)+" receive-pack")
+	}
+	args = append(args, rp, "refs/*:refs/*")
+	cmd := exec.Command("git", args...)
+	cmd.Dir = tmp
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		// What the hooks wrote tells why the refs were rejected.
+		msgs := make([]string, 0)
+		for _, l := range strings.Split(stderr.String(), "\n") {
+			if strings.HasPrefix(l, "remote: ") {
+				l = strings.TrimSpace(strings.TrimPrefix(l, "remote: "))
+				msgs = append(msgs, strings.TrimPrefix(l, "error: "))
+			}
+		}
+		if len(msgs) > 0 {
+			return nil, errors.New(strings.Join(msgs, "\n"))
+		}
+		return nil, fmt.Errorf("git push: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	// The repository is kept from here on, as it holds the pushed refs.
+	created = false
+	err = runGit(rp, "update-server-info")
+	if err != nil {
+		return nil, err
+	}
+	cur, err := commitRefs(rg)
+	if err != nil {
+		return nil, err
+	}
+	us, err := refUpdates(rg, old, cur)
+	if err != nil {
+		return nil, err
+	}
+	return us, rs.updateRepo(name)
+}
+
+// shellQuote quotes s for the shell git runs commands such as receive-pack
+// with.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// bundleHead guesses the branch the HEAD of a bundle points to from the
+// branches pointing at the same commit, preferring main and master. It
+// returns an empty string if the bundle has no HEAD.
+func bundleHead(path string) (string, error) {
+	out, err := gitOutput("", "bundle", "list-heads", path)
+	if err != nil {
+		return "", err
+	}
+	refs := parseRefs(out)
+	h, ok := refs["HEAD"]
+	if !ok {
+		return "", nil
+	}
+	for _, b := range []string{"refs/heads/main", "refs/heads/master"} {
+		if refs[b] == h {
+			return b, nil
+		}
+	}
+	names := make([]string, 0)
+	for ref, rh := range refs {
+		if rh == h && strings.HasPrefix(ref, "refs/heads/") {
+			names = append(names, ref)
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// InitBareRepo creates an empty bare repository. If head is set, HEAD is
+// pointed at it.
+func (rs *RepoSource) InitBareRepo(name string, head string) error {
+	unlock := rs.Locks.Lock(name, WriteLock)
+	defer unlock()
+	return rs.initBareRepo(name, head)
+}
+
+// initBareRepo creates an empty bare repository. The caller must hold the
+// write lock of the repository.
+func (rs *RepoSource) initBareRepo(name string, head string) error {
+	err := rs.createBareRepo(name, head)
+	if err != nil {
+		return err
+	}
+	return rs.updateRepo(name)
+}
+
+// createBareRepo creates an empty bare repository like initBareRepo, without
+// loading it.
+func (rs *RepoSource) createBareRepo(name string, head string) error {
+	rp, err := rs.newRepoPath(name)
+	if err != nil {
+		return err
+	}
+	err = runGit("", "init", "--bare", "--quiet", rp)
+	if err != nil {
+		return err
+	}
+	if head != "" {
+		err = runGit(rp, "symbolic-ref", "HEAD", head)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRefs(out string) map[string]string {
+	refs := make(map[string]string)
+	for _, l := range strings.Split(out, "\n") {
+		fs := strings.Fields(l)
+		if len(fs) == 2 {
+			refs[fs[1]] = fs[0]
+		}
+	}
+	return refs
+}
+
+// gitOutput runs git in dir and returns its output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
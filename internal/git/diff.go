@@ -0,0 +1,207 @@
+package git
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around changes.
+	diffContext = 3
+	// maxDiffSize is the size of the largest file that's diffed, in bytes.
+	maxDiffSize = 512 * 1024
+)
+
+// DiffOp is what a line of a diff does.
+type DiffOp int
+
+// Operations of the lines of a diff.
+const (
+	DiffEqual DiffOp = iota
+	DiffAdd
+	DiffDelete
+)
+
+// DiffLine is a line of a diff. Old and New are its line numbers in the old
+// and new file, or 0 if it isn't in the file.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+	Old  int
+	New  int
+}
+
+// Hunk is a series of changed lines, with the unchanged lines around them.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []DiffLine
+}
+
+// FileDiff is the change to a file.
+type FileDiff struct {
+	// From is the path of the file before the change, and To after it. From
+	// is empty for new files, and To for deleted ones.
+	From string
+	To   string
+	// IsBinary is set for binary files, and TooLarge for files too large to
+	// diff. Neither has hunks.
+	IsBinary  bool
+	TooLarge  bool
+	Additions int
+	Deletions int
+	Hunks     []Hunk
+}
+
+// Name returns the path of the file after the change, or before it if it was
+// deleted.
+func (f FileDiff) Name() string {
+	if f.To != "" {
+		return f.To
+	}
+	return f.From
+}
+
+// Diff returns the changes a commit made to its first parent, or to an empty
+// tree for a root commit, sorted by path. Renamed files are detected.
+func (r *Repo) Diff(c *object.Commit) ([]FileDiff, error) {
+	t, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var pt *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		pt, err = p.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+	chs, err := object.DiffTreeWithOptions(context.Background(), pt, t, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]FileDiff, 0, len(chs))
+	for _, ch := range chs {
+		fd := FileDiff{From: ch.From.Name, To: ch.To.Name}
+		from, to, err := ch.Files()
+		if err != nil {
+			return nil, err
+		}
+		if (from != nil && from.Size > maxDiffSize) || (to != nil && to.Size > maxDiffSize) {
+			fd.TooLarge = true
+			fds = append(fds, fd)
+			continue
+		}
+		p, err := ch.Patch()
+		if err != nil {
+			return nil, err
+		}
+		for _, fp := range p.FilePatches() {
+			if fp.IsBinary() {
+				fd.IsBinary = true
+				continue
+			}
+			fd.Hunks = hunks(fp.Chunks())
+			for _, h := range fd.Hunks {
+				for _, l := range h.Lines {
+					switch l.Op {
+					case DiffAdd:
+						fd.Additions++
+					case DiffDelete:
+						fd.Deletions++
+					}
+				}
+			}
+		}
+		fds = append(fds, fd)
+	}
+	sort.SliceStable(fds, func(i, j int) bool { return fds[i].Name() < fds[j].Name() })
+	return fds, nil
+}
+
+// hunks groups the lines of a file patch into hunks, with diffContext
+// unchanged lines around the changed ones.
+func hunks(chunks []fdiff.Chunk) []Hunk {
+	var lines []DiffLine
+	o, n := 0, 0
+	for _, c := range chunks {
+		text := c.Content()
+		if text == "" {
+			continue
+		}
+		for _, t := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+			l := DiffLine{Text: t}
+			switch c.Type() {
+			case fdiff.Equal:
+				o++
+				n++
+				l.Op, l.Old, l.New = DiffEqual, o, n
+			case fdiff.Add:
+				n++
+				l.Op, l.New = DiffAdd, n
+			case fdiff.Delete:
+				o++
+				l.Op, l.Old = DiffDelete, o
+			}
+			lines = append(lines, l)
+		}
+	}
+
+	var hs []Hunk
+	for i := 0; i < len(lines); {
+		if lines[i].Op == DiffEqual {
+			i++
+			continue
+		}
+		// Extend the hunk over the following changes until there are more
+		// unchanged lines between two changes than the context around both.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j-end <= 2*diffContext; j++ {
+			if lines[j].Op != DiffEqual {
+				end = j
+			}
+		}
+		i = end + 1
+		end += diffContext
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+		hs = append(hs, newHunk(lines[start:end+1]))
+	}
+	return hs
+}
+
+// newHunk returns the hunk of a series of lines, numbered like in the hunk
+// headers of unified diffs.
+func newHunk(lines []DiffLine) Hunk {
+	h := Hunk{Lines: lines}
+	for _, l := range lines {
+		if l.Old > 0 {
+			if h.OldStart == 0 {
+				h.OldStart = l.Old
+			}
+			h.OldLines++
+		}
+		if l.New > 0 {
+			if h.NewStart == 0 {
+				h.NewStart = l.New
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
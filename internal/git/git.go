@@ -6,11 +6,13 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/memory"
@@ -25,6 +27,9 @@ type Repo struct {
 	Repository  *git.Repository
 	Readme      string
 	LastUpdated *time.Time
+	// Size is the disk usage of the repository in bytes, as of when it was
+	// last loaded or updated.
+	Size int64
 }
 
 // RepoCommit contains metadata for a Git commit.
@@ -44,10 +49,16 @@ func (cl CommitLog) Less(i, j int) bool {
 
 // RepoSource is a reference to an on-disk repositories.
 type RepoSource struct {
-	Path    string
-	mtx     sync.Mutex
-	repos   []*Repo
-	commits CommitLog
+	Path string
+	// HooksPath is the directory of the git hooks run by ReceivePack, if set.
+	HooksPath string
+	// Locks serializes the pushes and maintenance of each repository.
+	Locks *LockManager
+	mtx   sync.Mutex
+	repos []*Repo
+	index *index
+	// wmtx serializes the writes of the index.
+	wmtx sync.Mutex
 }
 
 // NewRepoSource creates a new RepoSource.
@@ -56,15 +67,19 @@ func NewRepoSource(repoPath string) *RepoSource {
 	if err != nil {
 		log.Fatal(err)
 	}
-	rs := &RepoSource{Path: repoPath}
+	rs := &RepoSource{
+		Path:  repoPath,
+		Locks: NewLockManager(),
+	}
 	return rs
 }
 
-// AllRepos returns all repositories for the given RepoSource.
+// AllRepos returns all repositories for the given RepoSource. The returned
+// slice is a copy, so it doesn't change when repositories are loaded.
 func (rs *RepoSource) AllRepos() []*Repo {
 	rs.mtx.Lock()
 	defer rs.mtx.Unlock()
-	return rs.repos
+	return append([]*Repo(nil), rs.repos...)
 }
 
 // GetRepo returns a repository by name.
@@ -106,67 +121,250 @@ func (rs *RepoSource) InitRepo(name string, bare bool) (*Repo, error) {
 	return r, nil
 }
 
-// GetCommits returns commits for the repository.
+// GetCommits returns the latest commits across all repositories, newest
+// first. Only the returned commits are read from the repositories.
 func (rs *RepoSource) GetCommits(limit int) []RepoCommit {
 	rs.mtx.Lock()
 	defer rs.mtx.Unlock()
-	if limit > len(rs.commits) {
-		limit = len(rs.commits)
+	if rs.index == nil {
+		return []RepoCommit{}
+	}
+	rg := make(map[string]*git.Repository, len(rs.repos))
+	for _, r := range rs.repos {
+		rg[r.Name] = r.Repository
+	}
+	cl := make(CommitLog, 0, limit)
+	for _, ic := range rs.index.topCommits(limit) {
+		r, ok := rg[ic.Name]
+		if !ok {
+			continue
+		}
+		c, err := r.CommitObject(plumbing.NewHash(ic.Commit.Hash))
+		if err != nil {
+			log.Printf("error loading commit %s in %s: %s", ic.Commit.Hash, ic.Name, err)
+			continue
+		}
+		cl = append(cl, RepoCommit{Name: ic.Name, Commit: c})
 	}
-	return rs.commits[:limit]
+	sort.Stable(cl)
+	return cl
 }
 
-// LoadRepos opens Git repositories.
-func (rs *RepoSource) LoadRepos() error {
+// CommitsSince returns the number of commits of a repository authored after
+// the given time, as of when it was last indexed. Only the newest commits are
+// indexed, so the count is at most maxIndexedCommits.
+func (rs *RepoSource) CommitsSince(name string, since time.Time) int {
 	rs.mtx.Lock()
 	defer rs.mtx.Unlock()
+	if rs.index == nil {
+		return 0
+	}
+	ri, ok := rs.index.Repos[name]
+	if !ok {
+		return 0
+	}
+	// Commits are sorted newest first.
+	return sort.Search(len(ri.Commits), func(i int) bool {
+		return !ri.Commits[i].When.After(since)
+	})
+}
+
+// LoadRepos opens Git repositories. Repositories are indexed incrementally
+// against the on-disk index, so only commits that were added since the last
+// run are walked. Each repository is indexed holding its read lock, so
+// pushes keep going while the repositories are loaded.
+func (rs *RepoSource) LoadRepos() error {
 	rd, err := os.ReadDir(rs.Path)
 	if err != nil {
 		return err
 	}
-	rs.repos = make([]*Repo, 0)
-	rs.commits = make([]RepoCommit, 0)
+	err = rs.loadIndex()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
 	for _, de := range rd {
 		rn := de.Name()
-		rg, err := git.PlainOpen(filepath.Join(rs.Path, rn))
+		// Hidden directories, such as the LFS object store, aren't repos.
+		if !de.IsDir() || strings.HasPrefix(rn, ".") {
+			continue
+		}
+		unlock := rs.Locks.Lock(rn, ReadLock)
+		_, _, err = rs.refreshRepo(rn)
+		unlock()
 		if err != nil {
 			return err
 		}
-		r, err := rs.loadRepo(rn, rg)
+		seen[rn] = struct{}{}
+	}
+
+	rs.mtx.Lock()
+	// Repositories created while we were loading weren't listed, so only
+	// the ones that are gone from disk are dropped.
+	repos := make([]*Repo, 0, len(rs.repos))
+	for _, r := range rs.repos {
+		if _, ok := seen[r.Name]; ok || rs.exists(r.Name) {
+			repos = append(repos, r)
+		}
+	}
+	rs.repos = repos
+	gone := make([]string, 0)
+	for rn := range rs.index.Repos {
+		if _, ok := seen[rn]; !ok && !rs.exists(rn) {
+			delete(rs.index.Repos, rn)
+			gone = append(gone, rn)
+		}
+	}
+	rs.mtx.Unlock()
+	for _, rn := range gone {
+		err = rs.writeIndex(rn)
 		if err != nil {
 			return err
 		}
-		rs.repos = append(rs.repos, r)
 	}
 	return nil
 }
 
-func (rs *RepoSource) loadRepo(name string, rg *git.Repository) (*Repo, error) {
-	r := &Repo{Name: name}
-	r.Repository = rg
-	l, err := rg.Log(&git.LogOptions{All: true})
+// UpdateRepo re-indexes a single repository, for example after a push. Only
+// the commits that were added since the repository was last indexed are
+// walked. If the repository isn't loaded yet, it will be opened and added.
+func (rs *RepoSource) UpdateRepo(name string) error {
+	unlock := rs.Locks.Lock(name, ReadLock)
+	defer unlock()
+	return rs.updateRepo(name)
+}
+
+// updateRepo is UpdateRepo for callers already holding a lock of the
+// repository.
+func (rs *RepoSource) updateRepo(name string) error {
+	_, _, err := rs.reindexRepo(name)
+	return err
+}
+
+// reindexRepo refreshes a repository. It returns the index of the repository
+// before and after, the former being nil if it wasn't indexed. The caller
+// must hold a lock of the repository.
+func (rs *RepoSource) reindexRepo(name string) (*repoIndex, *repoIndex, error) {
+	err := rs.loadIndex()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	err = l.ForEach(func(c *object.Commit) error {
-		if r.LastUpdated == nil {
-			r.LastUpdated = &c.Author.When
-			rf, err := c.File("README.md")
-			if err == nil {
-				rmd, err := rf.Contents()
-				if err == nil {
-					r.Readme = rmd
-				}
-			}
-		}
-		rs.commits = append(rs.commits, RepoCommit{Name: name, Commit: c})
+	return rs.refreshRepo(name)
+}
+
+// loadIndex reads the on-disk index if it isn't loaded yet.
+func (rs *RepoSource) loadIndex() error {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	if rs.index != nil {
 		return nil
-	})
+	}
+	var err error
+	rs.index, err = readIndex(filepath.Join(rs.Path, indexDir))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	// The index used to be a single file, which is now stale.
+	err = os.Remove(filepath.Join(rs.Path, ".index.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeIndex persists the index of a repository, or removes it if the
+// repository isn't indexed anymore. Writes are serialized and write the
+// latest index, so that an older index never replaces a newer one.
+func (rs *RepoSource) writeIndex(name string) error {
+	rs.wmtx.Lock()
+	defer rs.wmtx.Unlock()
+	rs.mtx.Lock()
+	ri := rs.index.Repos[name]
+	rs.mtx.Unlock()
+	path := filepath.Join(rs.Path, indexDir, name+".json")
+	if ri == nil {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ri.write(path)
+}
+
+// refreshRepo opens and indexes a repository and replaces its loaded version.
+// It returns the index of the repository before and after. The caller must
+// hold a lock of the repository, which keeps it from being maintained while
+// it's walked.
+//
+// Commits are walked without holding rs.mtx, so that other sessions aren't
+// blocked while a large push is being indexed. Several goroutines can index
+// the same repository at once, for example a push and a reload, so the index
+// is only stored if nobody else stored one in the meantime. Otherwise the
+// repository is indexed again, as our walk may have missed what the other
+// one saw.
+func (rs *RepoSource) refreshRepo(name string) (*repoIndex, *repoIndex, error) {
+	for {
+		rs.mtx.Lock()
+		prev := rs.index.Repos[name]
+		rs.mtx.Unlock()
+
+		rg, err := git.PlainOpen(filepath.Join(rs.Path, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		ri, err := indexRepo(rg, prev)
+		if err != nil {
+			return nil, nil, err
+		}
+		size, err := DirSize(filepath.Join(rs.Path, name))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rs.mtx.Lock()
+		if rs.index.Repos[name] != prev {
+			rs.mtx.Unlock()
+			continue
+		}
+		rs.index.Repos[name] = ri
+		r := newRepo(name, rg, ri, size)
+		var found bool
+		for i, er := range rs.repos {
+			if er.Name == name {
+				rs.repos[i] = r
+				found = true
+				break
+			}
+		}
+		if !found {
+			rs.repos = append(rs.repos, r)
+		}
+		rs.mtx.Unlock()
+		if ri != prev {
+			err = rs.writeIndex(name)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return prev, ri, nil
+	}
+}
+
+// exists reports whether a repository exists on disk.
+func (rs *RepoSource) exists(name string) bool {
+	fi, err := os.Stat(filepath.Join(rs.Path, name))
+	return err == nil && fi.IsDir()
+}
+
+func newRepo(name string, rg *git.Repository, ri *repoIndex, size int64) *Repo {
+	return &Repo{
+		Name:        name,
+		Repository:  rg,
+		Readme:      ri.Readme,
+		LastUpdated: ri.LastUpdated,
+		Size:        size,
 	}
-	sort.Sort(rs.commits)
-	return r, nil
 }
 
 // LatestFile returns the latest file at the specified path in the repository.
@@ -0,0 +1,196 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRepoExists indicates that a repository with the same name already
+// exists.
+var ErrRepoExists = errors.New("repo already exists")
+
+// ImportRepo clones the repository at url, which can be a local path or any
+// URL git can clone from, into a new bare repository with the given name. If
+// mirror is set, all refs are copied rather than just branches and tags,
+// which is what you want when url is a bare repository that's being migrated.
+// The remote is removed afterwards, so the imported repository doesn't refer
+// back to where it came from.
+func (rs *RepoSource) ImportRepo(name string, url string, mirror bool) error {
+	unlock := rs.Locks.Lock(name, WriteLock)
+	defer unlock()
+	rp, err := rs.newRepoPath(name)
+	if err != nil {
+		return err
+	}
+	mode := "--bare"
+	if mirror {
+		mode = "--mirror"
+	}
+	// The URL comes from users, so it must not be taken for an option.
+	err = runGit("", "clone", mode, "--quiet", "--", url, rp)
+	if err != nil {
+		os.RemoveAll(rp) // nolint: errcheck
+		return err
+	}
+	err = runGit(rp, "remote", "remove", "origin")
+	if err != nil {
+		return err
+	}
+	err = runGit(rp, "update-server-info")
+	if err != nil {
+		return err
+	}
+	return rs.updateRepo(name)
+}
+
+// MoveRepo moves the bare repository at path into the repository directory
+// under the given name. The repository has to be on the same file system.
+func (rs *RepoSource) MoveRepo(name string, path string) error {
+	unlock := rs.Locks.Lock(name, WriteLock)
+	defer unlock()
+	rp, err := rs.newRepoPath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path, rp)
+	if err != nil {
+		return err
+	}
+	err = runGit(rp, "update-server-info")
+	if err != nil {
+		return err
+	}
+	return rs.updateRepo(name)
+}
+
+// newRepoPath returns the path of a new repository with the given name.
+func (rs *RepoSource) newRepoPath(name string) (string, error) {
+	if !ValidRepoName(name) {
+		return "", fmt.Errorf("invalid repo name %q", name)
+	}
+	rp := filepath.Join(rs.Path, name)
+	_, err := os.Stat(rp)
+	if err == nil {
+		return "", fmt.Errorf("%w: %s", ErrRepoExists, name)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	return rp, nil
+}
+
+// defaultDescription is the description git gives new repositories.
+const defaultDescription = "Unnamed repository; edit this file 'description' to name the repository."
+
+// FoundRepo is a repository found by FindRepos.
+type FoundRepo struct {
+	// Path is the path of the repository, that is the git directory of bare
+	// repositories and the working tree of other repositories.
+	Path string
+	// RelPath is the path of the repository relative to the directory it was
+	// found in, without a .git suffix. It's the name of the repository on
+	// servers such as gitolite.
+	RelPath string
+	// Name is a valid repository name derived from RelPath.
+	Name string
+	Bare bool
+	// Description is the contents of the description file of the
+	// repository, unless it's the default one.
+	Description string
+	// Exported is set if the repository has a git-daemon-export-ok file,
+	// which marks repositories as public on servers such as cgit.
+	Exported bool
+}
+
+// FindRepos finds the bare and non-bare repositories in dir and its
+// subdirectories. Repositories nested in other repositories aren't returned.
+func FindRepos(dir string) ([]*FoundRepo, error) {
+	repos := make([]*FoundRepo, 0)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		gd := ""
+		bare := false
+		switch {
+		case IsBareRepo(path):
+			gd = path
+			bare = true
+		case IsBareRepo(filepath.Join(path, ".git")):
+			gd = filepath.Join(path, ".git")
+		default:
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = strings.TrimSuffix(filepath.ToSlash(rel), ".git")
+		if rel == "." {
+			rel = strings.TrimSuffix(filepath.Base(path), ".git")
+		}
+		r := &FoundRepo{
+			Path:    path,
+			RelPath: rel,
+			Name:    strings.ReplaceAll(rel, "/", "-"),
+			Bare:    bare,
+		}
+		desc, err := os.ReadFile(filepath.Join(gd, "description"))
+		if err == nil {
+			d := strings.TrimSpace(string(desc))
+			if d != defaultDescription {
+				r.Description = d
+			}
+		}
+		_, err = os.Stat(filepath.Join(gd, "git-daemon-export-ok"))
+		r.Exported = err == nil
+		repos = append(repos, r)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// IsBareRepo reports whether path is a bare repository or a git directory.
+func IsBareRepo(path string) bool {
+	for _, n := range []string{"HEAD", "objects", "refs"} {
+		_, err := os.Stat(filepath.Join(path, n))
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidRepoName reports whether name can be used as the name of a repository.
+func ValidRepoName(name string) bool {
+	return name != "" &&
+		!strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`) &&
+		strings.TrimSpace(name) == name
+}
+
+// RepoNameFromURL returns the name a repository cloned from url gets by
+// default, which is the last element of its path without a .git suffix.
+func RepoNameFromURL(url string) string {
+	url = strings.TrimRight(url, `/\`)
+	if i := strings.LastIndexAny(url, `/\:`); i >= 0 {
+		url = url[i+1:]
+	}
+	return strings.TrimSuffix(url, ".git")
+}
+
+// runGit runs git in dir, returning its error output as the error if it
+// fails.
+func runGit(dir string, args ...string) error {
+	_, err := gitOutput(dir, args...)
+	return err
+}
@@ -0,0 +1,465 @@
+package git
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	// indexDir is the directory, relative to the RepoSource path, where the
+	// index of each repository is persisted between runs.
+	indexDir = ".index"
+	// indexVersion is bumped whenever the on-disk index format changes. An
+	// index with a different version is discarded and rebuilt.
+	indexVersion = 2
+	// maxIndexedCommits is the number of commits kept in the index of a
+	// repository, newest first.
+	maxIndexedCommits = 1000
+)
+
+// index is the persisted state of all repositories in a RepoSource. It lets
+// us pick up where we left off instead of walking the history of every
+// repository on startup and on every push.
+type index struct {
+	Repos map[string]*repoIndex
+}
+
+// repoIndex is the indexed state of a single repository. It's replaced
+// rather than changed, so it can be used without holding a lock.
+type repoIndex struct {
+	Version int `json:"version"`
+	// Refs maps reference names to the commit they pointed to when the
+	// repository was last indexed.
+	Refs        map[string]string `json:"refs"`
+	Head        string            `json:"head"`
+	Readme      string            `json:"readme"`
+	LastUpdated *time.Time        `json:"last_updated,omitempty"`
+	// Commits are the newest commits reachable from Refs, up to
+	// maxIndexedCommits, newest first.
+	Commits []indexedCommit `json:"commits"`
+}
+
+// indexedCommit is a commit hash along with its author date, which is all we
+// need to sort commits across repositories without loading them.
+type indexedCommit struct {
+	Hash string    `json:"hash"`
+	When time.Time `json:"when"`
+}
+
+// readIndex reads the index of each repository persisted in dir. Indexes that
+// can't be read are left out, so that their repositories get indexed again.
+func readIndex(dir string) (*index, error) {
+	idx := &index{Repos: make(map[string]*repoIndex)}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, de := range des {
+		name := strings.TrimSuffix(de.Name(), ".json")
+		if de.IsDir() || name == de.Name() {
+			continue
+		}
+		ri, err := readRepoIndex(filepath.Join(dir, de.Name()))
+		if err != nil {
+			log.Printf("error reading the index of %s, it will be rebuilt: %s", name, err)
+			continue
+		}
+		idx.Repos[name] = ri
+	}
+	return idx, nil
+}
+
+func readRepoIndex(path string) (*repoIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint: errcheck
+	ri := &repoIndex{}
+	err = json.NewDecoder(f).Decode(ri)
+	if err != nil {
+		return nil, err
+	}
+	if ri.Version != indexVersion {
+		return nil, errors.New("outdated index")
+	}
+	return ri, nil
+}
+
+// write atomically persists the index of a repository to path.
+func (ri *repoIndex) write(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	err = json.NewEncoder(f).Encode(ri)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// indexRepo updates prev, which may be nil, with the current state of rg. Only
+// the commits that the references gained since prev are walked, unless a
+// reference was deleted or rewound, in which case the newest commits are
+// indexed from scratch.
+func indexRepo(rg *git.Repository, prev *repoIndex) (*repoIndex, error) {
+	refs, err := commitRefs(rg)
+	if err != nil {
+		return nil, err
+	}
+	var head string
+	hr, err := rg.Head()
+	if err == nil {
+		head = hr.Hash().String()
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+	if prev != nil && sameRefs(prev.Refs, refs) && prev.Head == head {
+		return prev, nil
+	}
+
+	if prev != nil {
+		rewound, err := hasRewoundRefs(rg, prev.Refs, refs)
+		if err != nil {
+			return nil, err
+		}
+		if rewound {
+			prev = nil
+		}
+	}
+
+	ri := &repoIndex{
+		Version: indexVersion,
+		Refs:    refs,
+		Head:    head,
+	}
+	var old []string
+	if prev != nil {
+		for _, h := range prev.Refs {
+			old = append(old, h)
+		}
+	}
+	added, err := walkNew(rg, refTips(refs), hashes(old), maxIndexedCommits)
+	if err != nil {
+		return nil, err
+	}
+	ri.Commits = added
+	if prev != nil {
+		ri.Commits = mergeCommits(prev.Commits, added)
+	}
+	sort.SliceStable(ri.Commits, func(i, j int) bool {
+		return ri.Commits[i].When.After(ri.Commits[j].When)
+	})
+	if len(ri.Commits) > maxIndexedCommits {
+		ri.Commits = ri.Commits[:maxIndexedCommits]
+	}
+
+	// The README and last updated time come from the first commit a full log
+	// would yield, which is HEAD if the repository has one.
+	var tip *object.Commit
+	if head != "" {
+		tip, err = rg.CommitObject(plumbing.NewHash(head))
+		if err != nil && err != plumbing.ErrObjectNotFound {
+			return nil, err
+		}
+	}
+	if tip == nil && len(ri.Commits) > 0 {
+		tip, err = rg.CommitObject(plumbing.NewHash(ri.Commits[0].Hash))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tip != nil {
+		lu := tip.Author.When
+		ri.LastUpdated = &lu
+		rf, err := tip.File("README.md")
+		if err == nil {
+			rmd, err := rf.Contents()
+			if err == nil {
+				ri.Readme = rmd
+			}
+		}
+	}
+	return ri, nil
+}
+
+// mergeCommits returns the commits of a and b, leaving out the commits of b
+// that are already in a.
+func mergeCommits(a, b []indexedCommit) []indexedCommit {
+	cs := make([]indexedCommit, 0, len(a)+len(b))
+	seen := make(map[string]struct{}, len(a))
+	for _, c := range a {
+		seen[c.Hash] = struct{}{}
+		cs = append(cs, c)
+	}
+	for _, c := range b {
+		if _, ok := seen[c.Hash]; !ok {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// commitRefs returns all references that point to a commit.
+func commitRefs(rg *git.Repository) (map[string]string, error) {
+	refs := make(map[string]string)
+	ri, err := rg.References()
+	if err != nil {
+		return nil, err
+	}
+	err = ri.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		// Like git log --all, skip references that don't point to a commit.
+		_, err := rg.CommitObject(ref.Hash())
+		if err != nil {
+			return nil
+		}
+		refs[ref.Name().String()] = ref.Hash().String()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func sameRefs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func refTips(refs map[string]string) []plumbing.Hash {
+	hs := make([]string, 0, len(refs))
+	for _, h := range refs {
+		hs = append(hs, h)
+	}
+	return hashes(hs)
+}
+
+func hashes(hs []string) []plumbing.Hash {
+	r := make([]plumbing.Hash, 0, len(hs))
+	for _, h := range hs {
+		r = append(r, plumbing.NewHash(h))
+	}
+	return r
+}
+
+// walkNew returns the commits reachable from tips that aren't reachable from
+// exclude, like git rev-list tips --not exclude, in no particular order. If
+// limit isn't 0, only about the newest limit commits are returned.
+//
+// Commits are walked newest first by committer date from both sides, and the
+// walk stops once only excluded commits are left to walk. So its cost is
+// proportional to the number of new commits rather than to the size of the
+// history.
+func walkNew(rg *git.Repository, tips, exclude []plumbing.Hash, limit int) ([]indexedCommit, error) {
+	w := &walk{
+		rg:       rg,
+		excluded: make(map[plumbing.Hash]bool),
+		queued:   make(map[plumbing.Hash]struct{}),
+		done:     make(map[plumbing.Hash]*object.Commit),
+	}
+	for _, h := range exclude {
+		err := w.push(h, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range tips {
+		err := w.push(h, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var n int
+	for w.pending > 0 && (limit == 0 || n < limit) {
+		c := heap.Pop(&w.queue).(*object.Commit)
+		delete(w.queued, c.Hash)
+		ex := w.excluded[c.Hash]
+		w.done[c.Hash] = c
+		if !ex {
+			w.pending--
+			n++
+		}
+		for _, p := range c.ParentHashes {
+			err := w.push(p, ex)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	added := make([]indexedCommit, 0, n)
+	for h, c := range w.done {
+		if !w.excluded[h] {
+			added = append(added, indexedCommit{Hash: h.String(), When: c.Author.When})
+		}
+	}
+	return added, nil
+}
+
+// walk is the state of walkNew.
+type walk struct {
+	rg *git.Repository
+	// excluded tells the commits seen so far, and whether they're reachable
+	// from the excluded commits. queued are the commits waiting in queue and
+	// done the ones that were walked. pending counts the queued commits that
+	// aren't excluded, the walk being over when there are none.
+	excluded map[plumbing.Hash]bool
+	queued   map[plumbing.Hash]struct{}
+	done     map[plumbing.Hash]*object.Commit
+	queue    commitQueue
+	pending  int
+}
+
+// push queues a commit to be walked, unless it was already seen. A commit
+// seen as new becomes excluded if it's reached from an excluded commit, and
+// so do its walked parents.
+func (w *walk) push(h plumbing.Hash, excluded bool) error {
+	if ex, ok := w.excluded[h]; ok {
+		if excluded && !ex {
+			w.excluded[h] = true
+			if _, ok := w.queued[h]; ok {
+				w.pending--
+			}
+			if c, ok := w.done[h]; ok {
+				for _, p := range c.ParentHashes {
+					err := w.push(p, true)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	w.excluded[h] = excluded
+	c, err := w.rg.CommitObject(h)
+	if err == plumbing.ErrObjectNotFound {
+		// Shallow repositories don't have all parents.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	heap.Push(&w.queue, c)
+	w.queued[h] = struct{}{}
+	if !excluded {
+		w.pending++
+	}
+	return nil
+}
+
+// commitQueue is a heap of commits, newest first by committer date.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// hasRewoundRefs reports whether any reference in prev was deleted or moved
+// to a commit that doesn't descend from its previous tip. When that happens,
+// commits may have become unreachable and the index can't be updated
+// incrementally.
+func hasRewoundRefs(rg *git.Repository, prev, cur map[string]string) (bool, error) {
+	for name, old := range prev {
+		h, ok := cur[name]
+		if !ok {
+			return true, nil
+		}
+		if h == old {
+			continue
+		}
+		if _, err := rg.CommitObject(plumbing.NewHash(old)); err != nil {
+			return true, nil
+		}
+		// The new tip descends from the old one if the old one reaches
+		// nothing that the new one doesn't.
+		gone, err := walkNew(rg, hashes([]string{old}), hashes([]string{h}), 0)
+		if err != nil {
+			return false, err
+		}
+		if len(gone) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// topCommits merges the per-repository commit lists of the index and returns
+// the newest limit commits across all repositories.
+func (idx *index) topCommits(limit int) []indexedRepoCommit {
+	pos := make(map[string]int, len(idx.Repos))
+	cs := make([]indexedRepoCommit, 0, limit)
+	for len(cs) < limit {
+		var next string
+		for name, ri := range idx.Repos {
+			p := pos[name]
+			if p >= len(ri.Commits) {
+				continue
+			}
+			if next == "" {
+				next = name
+				continue
+			}
+			nw := idx.Repos[next].Commits[pos[next]].When
+			w := ri.Commits[p].When
+			if w.After(nw) || (w.Equal(nw) && name < next) {
+				next = name
+			}
+		}
+		if next == "" {
+			break
+		}
+		cs = append(cs, indexedRepoCommit{
+			Name:   next,
+			Commit: idx.Repos[next].Commits[pos[next]],
+		})
+		pos[next]++
+	}
+	return cs
+}
+
+type indexedRepoCommit struct {
+	Name   string
+	Commit indexedCommit
+}
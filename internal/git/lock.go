@@ -0,0 +1,167 @@
+package git
+
+import (
+	"sync"
+)
+
+// LockMode is the kind of access to a repository a lock is held for.
+type LockMode int
+
+const (
+	// ReadLock is held while a repository is read, for example by a fetch.
+	// Reads run alongside each other and alongside a write.
+	ReadLock LockMode = iota
+	// WriteLock is held while the refs of a repository are updated, for
+	// example by a push. Writes run one at a time, alongside reads.
+	WriteLock
+	// ExclusiveLock is held while a repository is maintained. Nothing else
+	// runs on the repository at the same time.
+	ExclusiveLock
+)
+
+// String returns the name of the mode.
+func (m LockMode) String() string {
+	switch m {
+	case ReadLock:
+		return "read"
+	case WriteLock:
+		return "write"
+	case ExclusiveLock:
+		return "exclusive"
+	}
+	return "unknown"
+}
+
+// repoLock is the state of the lock of a repository.
+type repoLock struct {
+	readers   int
+	writer    bool
+	exclusive bool
+	// waiters counts the goroutines waiting for the lock, so that the lock
+	// is only forgotten once nobody uses it.
+	waiters int
+}
+
+// available reports whether the lock can be taken in the given mode.
+func (l *repoLock) available(mode LockMode) bool {
+	switch mode {
+	case ReadLock:
+		return !l.exclusive
+	case WriteLock:
+		return !l.exclusive && !l.writer
+	default:
+		return !l.exclusive && !l.writer && l.readers == 0
+	}
+}
+
+func (l *repoLock) take(mode LockMode) {
+	switch mode {
+	case ReadLock:
+		l.readers++
+	case WriteLock:
+		l.writer = true
+	default:
+		l.exclusive = true
+	}
+}
+
+func (l *repoLock) release(mode LockMode) {
+	switch mode {
+	case ReadLock:
+		l.readers--
+	case WriteLock:
+		l.writer = false
+	default:
+		l.exclusive = false
+	}
+}
+
+func (l *repoLock) idle() bool {
+	return l.readers == 0 && !l.writer && !l.exclusive && l.waiters == 0
+}
+
+// LockManager hands out per-repository locks, so that ref updates and
+// maintenance of a repository are serialized while fetches keep running in
+// parallel. Locks aren't reentrant: a goroutine holding the write lock of a
+// repository may take its read lock, but nothing else.
+//
+// Exclusive locks have no priority over the others, so a busy repository can
+// keep them waiting. Use TryLock to take them without waiting.
+type LockManager struct {
+	mtx   sync.Mutex
+	cond  *sync.Cond
+	repos map[string]*repoLock
+}
+
+// NewLockManager returns a new LockManager.
+func NewLockManager() *LockManager {
+	lm := &LockManager{
+		repos: make(map[string]*repoLock),
+	}
+	lm.cond = sync.NewCond(&lm.mtx)
+	return lm
+}
+
+// Lock waits until the lock of the named repository can be taken in the given
+// mode and takes it. The returned function releases the lock.
+func (lm *LockManager) Lock(name string, mode LockMode) func() {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	l := lm.repo(name)
+	l.waiters++
+	for !l.available(mode) {
+		lm.cond.Wait()
+	}
+	l.waiters--
+	l.take(mode)
+	return lm.unlocker(name, l, mode)
+}
+
+// TryLock takes the lock of the named repository in the given mode if it can
+// be taken right away. It returns false if it can't, in which case there's
+// nothing to release.
+func (lm *LockManager) TryLock(name string, mode LockMode) (func(), bool) {
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+	l := lm.repo(name)
+	if !l.available(mode) {
+		lm.forget(name, l)
+		return nil, false
+	}
+	l.take(mode)
+	return lm.unlocker(name, l, mode), true
+}
+
+// repo returns the lock of the named repository, creating it if nobody uses
+// it. The caller must hold lm.mtx.
+func (lm *LockManager) repo(name string) *repoLock {
+	l, ok := lm.repos[name]
+	if !ok {
+		l = &repoLock{}
+		lm.repos[name] = l
+	}
+	return l
+}
+
+// forget drops the lock of the named repository once nobody uses it. The
+// caller must hold lm.mtx.
+func (lm *LockManager) forget(name string, l *repoLock) {
+	if l.idle() {
+		delete(lm.repos, name)
+	}
+}
+
+// unlocker returns a function releasing a lock. Releasing it more than once
+// has no effect.
+func (lm *LockManager) unlocker(name string, l *repoLock, mode LockMode) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lm.mtx.Lock()
+			defer lm.mtx.Unlock()
+			l.release(mode)
+			lm.forget(name, l)
+			lm.cond.Broadcast()
+		})
+	}
+}
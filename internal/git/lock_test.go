@@ -0,0 +1,112 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+// blocked reports whether taking the lock in the given mode blocks, releasing
+// it once it's taken.
+func blocked(lm *LockManager, name string, mode LockMode) bool {
+	done := make(chan struct{})
+	go func() {
+		unlock := lm.Lock(name, mode)
+		unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return false
+	case <-time.After(100 * time.Millisecond):
+		<-done
+		return true
+	}
+}
+
+func TestLockCompatibility(t *testing.T) {
+	cases := []struct {
+		held   LockMode
+		mode   LockMode
+		allows bool
+	}{
+		{ReadLock, ReadLock, true},
+		{ReadLock, WriteLock, true},
+		{ReadLock, ExclusiveLock, false},
+		{WriteLock, ReadLock, true},
+		{WriteLock, WriteLock, false},
+		{WriteLock, ExclusiveLock, false},
+		{ExclusiveLock, ReadLock, false},
+		{ExclusiveLock, WriteLock, false},
+		{ExclusiveLock, ExclusiveLock, false},
+	}
+	for _, c := range cases {
+		lm := NewLockManager()
+		unlock := lm.Lock("repo", c.held)
+		unlockTry, ok := lm.TryLock("repo", c.mode)
+		if ok != c.allows {
+			t.Errorf("TryLock(%s) while holding %s = %t, want %t", c.mode, c.held, ok, c.allows)
+		}
+		if ok {
+			unlockTry()
+		}
+		unlock()
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	lm := NewLockManager()
+	unlock := lm.Lock("repo", WriteLock)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		unlock()
+	}()
+	if !blocked(lm, "repo", WriteLock) {
+		t.Error("a second write lock was taken while the first one was held")
+	}
+	if blocked(lm, "repo", WriteLock) {
+		t.Error("the write lock wasn't released")
+	}
+}
+
+func TestLockIsPerRepo(t *testing.T) {
+	lm := NewLockManager()
+	unlock := lm.Lock("a", ExclusiveLock)
+	defer unlock()
+	for _, mode := range []LockMode{ReadLock, WriteLock, ExclusiveLock} {
+		if blocked(lm, "b", mode) {
+			t.Errorf("the %s lock of b waited for the exclusive lock of a", mode)
+		}
+	}
+}
+
+func TestLockForgetsIdleRepos(t *testing.T) {
+	lm := NewLockManager()
+	unlockRead := lm.Lock("repo", ReadLock)
+	unlockWrite := lm.Lock("repo", WriteLock)
+	if _, ok := lm.TryLock("repo", ExclusiveLock); ok {
+		t.Fatal("the exclusive lock was taken while the repo was in use")
+	}
+	unlockRead()
+	unlockWrite()
+	if n := len(lm.repos); n != 0 {
+		t.Errorf("%d locks left after releasing them all", n)
+	}
+	unlock, ok := lm.TryLock("repo", ExclusiveLock)
+	if !ok {
+		t.Fatal("the exclusive lock of an idle repo couldn't be taken")
+	}
+	unlock()
+}
+
+func TestUnlockTwice(t *testing.T) {
+	lm := NewLockManager()
+	unlock := lm.Lock("repo", WriteLock)
+	unlock()
+	unlockOther := lm.Lock("repo", WriteLock)
+	defer unlockOther()
+	// Releasing a lock twice must not release someone else's lock.
+	unlock()
+	if _, ok := lm.TryLock("repo", WriteLock); ok {
+		t.Error("releasing a lock twice released the next holder's lock")
+	}
+}
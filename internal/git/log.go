@@ -0,0 +1,64 @@
+package git
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Log pages through the history of a revision, newest commits first. Commits
+// are only read from the repository as pages are requested.
+type Log struct {
+	iter object.CommitIter
+	done bool
+}
+
+// Log returns the history of the commit the revision points to, such as HEAD
+// or refs/heads/main.
+func (r *Repo) Log(rev string) (*Log, error) {
+	h, err := r.Repository.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	iter, err := r.Repository.Log(&git.LogOptions{
+		From:  *h,
+		Order: git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Log{iter: iter}, nil
+}
+
+// Next returns up to n more commits. It returns fewer once the history is
+// exhausted, and none after that.
+func (l *Log) Next(n int) ([]*object.Commit, error) {
+	cs := make([]*object.Commit, 0, n)
+	for !l.done && len(cs) < n {
+		c, err := l.iter.Next()
+		if err == io.EOF {
+			l.Close()
+			break
+		}
+		if err != nil {
+			return cs, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// Done reports whether the whole history has been read.
+func (l *Log) Done() bool {
+	return l.done
+}
+
+// Close releases the history once no more pages are needed.
+func (l *Log) Close() {
+	if !l.done {
+		l.done = true
+		l.iter.Close()
+	}
+}
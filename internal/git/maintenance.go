@@ -0,0 +1,109 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrRepoBusy indicates that a repository is in use, so it can't be
+// maintained right now.
+var ErrRepoBusy = errors.New("repo is busy")
+
+// RepoStats are the storage statistics of a repository, as reported by git
+// count-objects.
+type RepoStats struct {
+	LooseObjects  int64
+	LooseSize     int64
+	PackedObjects int64
+	Packs         int64
+	PackSize      int64
+	// Garbage counts the files in the object directory that aren't objects
+	// or packs, such as leftovers of interrupted pushes.
+	Garbage     int64
+	CommitGraph bool
+}
+
+// maintenanceTasks are the git commands run to maintain a repository, in
+// order. Unreachable objects are only pruned once they're two weeks old, like
+// git gc does.
+var maintenanceTasks = [][]string{
+	{"pack-refs", "--all", "--prune"},
+	{"repack", "-a", "-d", "-l", "-q"},
+	{"prune", "--expire=2.weeks.ago"},
+	{"commit-graph", "write", "--reachable"},
+}
+
+// Maintain packs the refs and objects of a repository, prunes its old
+// unreachable objects and writes its commit-graph, holding the exclusive lock
+// of the repository. It returns ErrRepoBusy without doing anything if the
+// repository is in use; pushes and fetches arriving during the maintenance
+// wait for it to finish.
+func (rs *RepoSource) Maintain(ctx context.Context, name string) error {
+	unlock, ok := rs.Locks.TryLock(name, ExclusiveLock)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRepoBusy, name)
+	}
+	defer unlock()
+	rp := filepath.Join(rs.Path, name)
+	for _, args := range maintenanceTasks {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = rp
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			msg := strings.TrimSpace(string(out))
+			if msg == "" {
+				msg = err.Error()
+			}
+			return fmt.Errorf("git %s: %s", args[0], msg)
+		}
+	}
+	// The loaded repository caches the packs it found, which were just
+	// replaced, so it has to be opened again.
+	return rs.updateRepo(name)
+}
+
+// Stats returns the storage statistics of a repository.
+func (rs *RepoSource) Stats(name string) (*RepoStats, error) {
+	rp := filepath.Join(rs.Path, name)
+	out, err := gitOutput(rp, "count-objects", "-v")
+	if err != nil {
+		return nil, err
+	}
+	st := &RepoStats{}
+	for _, l := range strings.Split(out, "\n") {
+		kv := strings.SplitN(l, ": ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch kv[0] {
+		case "count":
+			st.LooseObjects = n
+		case "size":
+			st.LooseSize = n * 1024
+		case "in-pack":
+			st.PackedObjects = n
+		case "packs":
+			st.Packs = n
+		case "size-pack":
+			st.PackSize = n * 1024
+		case "garbage":
+			st.Garbage = n
+		}
+	}
+	for _, p := range []string{"commit-graph", "commit-graphs"} {
+		if _, err := os.Stat(filepath.Join(rp, "objects", "info", p)); err == nil {
+			st.CommitGraph = true
+		}
+	}
+	return st, nil
+}
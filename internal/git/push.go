@@ -0,0 +1,73 @@
+package git
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxUpdateCommits is the number of commits of a ref update that are loaded.
+const maxUpdateCommits = 5
+
+// RefUpdate is a ref changed by a push.
+type RefUpdate struct {
+	// Ref is the full name of the ref, such as refs/heads/main.
+	Ref string
+	// Old is the commit the ref pointed to before the push, empty if the push
+	// created it, and New the one after, empty if the push deleted it.
+	Old string
+	New string
+	// Commits are the newest commits the push added to the repository on the
+	// ref, up to maxUpdateCommits, newest first. Total counts all of them.
+	Commits []*object.Commit
+	Total   int
+}
+
+// refUpdates compares the refs of a repository before and after a push. The
+// commits of an update are the ones that weren't reachable from the old refs,
+// and are only counted towards the first ref by name that they're reachable
+// from.
+func refUpdates(rg *git.Repository, old, cur map[string]string) ([]RefUpdate, error) {
+	exclude := make([]string, 0, len(old))
+	for _, h := range old {
+		exclude = append(exclude, h)
+	}
+	names := make([]string, 0, len(cur))
+	for n, h := range cur {
+		if old[n] != h {
+			names = append(names, n)
+		}
+	}
+	for n := range old {
+		if _, ok := cur[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	us := make([]RefUpdate, 0, len(names))
+	for _, n := range names {
+		u := RefUpdate{Ref: n, Old: old[n], New: cur[n]}
+		if u.New != "" {
+			added, err := walkNew(rg, hashes([]string{u.New}), hashes(exclude), 0)
+			if err != nil {
+				return nil, err
+			}
+			exclude = append(exclude, u.New)
+			sort.SliceStable(added, func(i, j int) bool {
+				return added[i].When.After(added[j].When)
+			})
+			u.Total = len(added)
+			for i := 0; i < len(added) && i < maxUpdateCommits; i++ {
+				c, err := rg.CommitObject(plumbing.NewHash(added[i].Hash))
+				if err != nil {
+					return nil, err
+				}
+				u.Commits = append(u.Commits, c)
+			}
+		}
+		us = append(us, u)
+	}
+	return us, nil
+}
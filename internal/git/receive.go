@@ -0,0 +1,111 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// ReceivePack runs git receive-pack for a push to a repository, reading the
+// push from rw and writing the response to it. The repository is created if
+// it doesn't exist. env is added to the environment of receive-pack and the
+// hooks it runs. Once the push is received, HEAD is pointed at the first
+// branch if the branch it points to doesn't exist, and the info files used by
+// dumb transports are updated. The push holds the write lock of the
+// repository, so pushes to the same repository run one at a time.
+//
+// It returns the refs the push changed, sorted by name. They're read before
+// and after receive-pack while the write lock is held, so that other pushes
+// can't be mistaken for this one.
+func (rs *RepoSource) ReceivePack(ctx context.Context, name string, rw io.ReadWriter, env []string) ([]RefUpdate, error) {
+	unlock := rs.Locks.Lock(name, WriteLock)
+	defer unlock()
+	rp := filepath.Join(rs.Path, name)
+	_, err := os.Stat(rp)
+	if os.IsNotExist(err) {
+		err = runGit("", "init", "--bare", "--quiet", rp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rg, err := git.PlainOpen(rp)
+	if err != nil {
+		return nil, err
+	}
+	old, err := commitRefs(rg)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"receive-pack", rp}
+	if rs.HooksPath != "" {
+		args = append([]string{"-c", "core.hooksPath=" + rs.HooksPath}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = rw
+	cmd.Stdout = rw
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("git receive-pack: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	err = ensureHead(rp)
+	if err != nil {
+		return nil, err
+	}
+	err = runGit(rp, "update-server-info")
+	if err != nil {
+		return nil, err
+	}
+	cur, err := commitRefs(rg)
+	if err != nil {
+		return nil, err
+	}
+	return refUpdates(rg, old, cur)
+}
+
+// ensureHead points HEAD at the first branch of a repository if the branch it
+// points to doesn't exist, for example after the first push of a branch other
+// than the default one.
+func ensureHead(rp string) error {
+	if _, err := gitOutput(rp, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		return nil
+	}
+	out, err := gitOutput(rp, "for-each-ref", "--count=1", "--format=%(refname)", "refs/heads/")
+	if err != nil {
+		return err
+	}
+	b := strings.TrimSpace(out)
+	if b == "" {
+		return nil
+	}
+	return runGit(rp, "symbolic-ref", "HEAD", b)
+}
+
+// DirSize returns the total size of the files in dir, in bytes.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// Files can disappear while walking, for example when git
+			// repacks.
+			if os.IsNotExist(err) && path != dir {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
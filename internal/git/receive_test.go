@@ -0,0 +1,365 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// relayEnv is set when the test binary is run by git as a transport, see
+// relay.
+const relayEnv = "SOFT_SERVE_TEST_RELAY"
+
+func TestMain(m *testing.M) {
+	if addr := os.Getenv(relayEnv); addr != "" {
+		os.Exit(relay(addr, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// relay connects git to a testServer. git runs the test binary through the
+// ext:: transport with the service and repo as arguments; the relay sends
+// them to the server as the first line and then copies the connection to
+// stdin and stdout.
+func relay(addr string, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "relay: bad arguments %q\n", args)
+		return 1
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "relay: %s\n", err)
+		return 1
+	}
+	defer conn.Close() // nolint: errcheck
+	fmt.Fprintf(conn, "%s %s\n", args[0], args[1])
+	go func() {
+		io.Copy(conn, os.Stdin)          // nolint: errcheck
+		conn.(*net.TCPConn).CloseWrite() // nolint: errcheck
+	}()
+	io.Copy(os.Stdout, conn) // nolint: errcheck
+	return 0
+}
+
+// testServer serves pushes and fetches to a RepoSource the way the SSH
+// server does: pushes go through ReceivePack and update the repo afterwards,
+// and fetches hold the read lock of the repo.
+type testServer struct {
+	rs   *RepoSource
+	ln   net.Listener
+	wg   sync.WaitGroup
+	mtx  sync.Mutex
+	errs []error
+}
+
+func newTestServer(t *testing.T, rs *RepoSource) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{rs: rs, ln: ln}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer conn.Close() // nolint: errcheck
+				err := s.serve(conn)
+				if err != nil {
+					s.mtx.Lock()
+					s.errs = append(s.errs, err)
+					s.mtx.Unlock()
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close() // nolint: errcheck
+		s.wg.Wait()
+		for _, err := range s.errs {
+			t.Errorf("server: %s", err)
+		}
+	})
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn) error {
+	br := bufio.NewReader(conn)
+	l, err := br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fs := strings.Fields(l)
+	if len(fs) != 2 {
+		return fmt.Errorf("bad request %q", l)
+	}
+	service, repo := fs[0], fs[1]
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{br, conn}
+	switch service {
+	case "git-receive-pack":
+		_, err = s.rs.ReceivePack(context.Background(), repo, rw, nil)
+		if err != nil {
+			return err
+		}
+		return s.rs.UpdateRepo(repo)
+	case "git-upload-pack":
+		unlock := s.rs.Locks.Lock(repo, ReadLock)
+		defer unlock()
+		cmd := exec.Command("git", "upload-pack", filepath.Join(s.rs.Path, repo))
+		cmd.Stdin = rw
+		cmd.Stdout = rw
+		return cmd.Run()
+	}
+	return fmt.Errorf("unknown service %q", service)
+}
+
+// url returns the URL git uses to reach a repo through the server.
+func (s *testServer) url(repo string) string {
+	return fmt.Sprintf("ext::%s %%S %s", os.Args[0], repo)
+}
+
+// env returns the environment of the git clients, which isolates them from
+// the configuration of the machine and points them at the server.
+func (s *testServer) env(home string) []string {
+	return append(os.Environ(),
+		"HOME="+home,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Tester",
+		"GIT_AUTHOR_EMAIL=tester@example.com",
+		"GIT_COMMITTER_NAME=Tester",
+		"GIT_COMMITTER_EMAIL=tester@example.com",
+		relayEnv+"="+s.ln.Addr().String(),
+	)
+}
+
+// client runs git commands in a work tree.
+type client struct {
+	dir string
+	env []string
+}
+
+func (c *client) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-c", "protocol.ext.allow=always"}, args...)...)
+	cmd.Dir = c.dir
+	cmd.Env = c.env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return string(out), nil
+}
+
+// newClient creates an empty work tree in dir with the server repo as its
+// origin.
+func newClient(s *testServer, dir string, repo string) (*client, error) {
+	c := &client{dir: dir, env: s.env(dir)}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"symbolic-ref", "HEAD", "refs/heads/main"},
+		{"remote", "add", "origin", s.url(repo)},
+	} {
+		if _, err := c.git(args...); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// commit commits a new file to the work tree.
+func (c *client) commit(name string) error {
+	err := os.WriteFile(filepath.Join(c.dir, name), []byte(name+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+	_, err = c.git("add", name)
+	if err != nil {
+		return err
+	}
+	_, err = c.git("commit", "--quiet", "-m", name)
+	return err
+}
+
+func newTestRepoSource(t *testing.T) *RepoSource {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	rs := NewRepoSource(filepath.Join(t.TempDir(), "repos"))
+	err := rs.InitBareRepo("repo", "refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+// hammer runs fn on workers goroutines while reloading and maintaining the
+// repos until they're done, and returns the errors of fn.
+func hammer(t *testing.T, rs *RepoSource, workers int, fn func(w int) error) []error {
+	done := make(chan struct{})
+	var bg sync.WaitGroup
+	bg.Add(1)
+	go func() {
+		defer bg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := rs.LoadRepos(); err != nil {
+				t.Errorf("LoadRepos: %s", err)
+			}
+			err := rs.Maintain(context.Background(), "repo")
+			if err != nil && !errors.Is(err, ErrRepoBusy) {
+				t.Errorf("Maintain: %s", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			errs[w] = fn(w)
+		}(w)
+	}
+	wg.Wait()
+	close(done)
+	bg.Wait()
+	return errs
+}
+
+// checkRepo checks that the repo is sound and that its index agrees with its
+// refs.
+func checkRepo(t *testing.T, rs *RepoSource, wantCommits int) {
+	rp := filepath.Join(rs.Path, "repo")
+	if _, err := gitOutput(rp, "fsck", "--strict"); err != nil {
+		t.Error(err)
+	}
+	refs, _, err := rs.Refs("repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rs.GetRepo("repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.mtx.Lock()
+	ri := rs.index.Repos["repo"]
+	rs.mtx.Unlock()
+	if !sameRefs(ri.Refs, refs) {
+		t.Errorf("indexed refs %v, want %v", ri.Refs, refs)
+	}
+	if len(ri.Commits) != wantCommits {
+		t.Errorf("indexed %d commits, want %d", len(ri.Commits), wantCommits)
+	}
+	loaded, err := commitRefs(r.Repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRefs(loaded, refs) {
+		t.Errorf("loaded repo has refs %v, want %v", loaded, refs)
+	}
+}
+
+// TestConcurrentPushesToBranches pushes to a branch per worker at once.
+// Every push has to succeed.
+func TestConcurrentPushesToBranches(t *testing.T) {
+	const workers, pushes = 8, 5
+	rs := newTestRepoSource(t)
+	s := newTestServer(t, rs)
+	errs := hammer(t, rs, workers, func(w int) error {
+		c, err := newClient(s, t.TempDir(), "repo")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < pushes; i++ {
+			err = c.commit(fmt.Sprintf("w%d-%d", w, i))
+			if err != nil {
+				return err
+			}
+			_, err = c.git("push", "--quiet", "origin", fmt.Sprintf("HEAD:refs/heads/w%d", w))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for w, err := range errs {
+		if err != nil {
+			t.Errorf("worker %d: %s", w, err)
+		}
+	}
+	checkRepo(t, rs, workers*pushes)
+}
+
+// TestConcurrentPushesToOneBranch has every worker push to the same branch,
+// rebasing and retrying when the branch moved. Pushes are serialized, so they
+// may only be rejected because the branch moved, never because another push
+// held a ref lock, and no commit may get lost.
+func TestConcurrentPushesToOneBranch(t *testing.T) {
+	const workers, pushes = 4, 5
+	rs := newTestRepoSource(t)
+	s := newTestServer(t, rs)
+	errs := hammer(t, rs, workers, func(w int) error {
+		c, err := newClient(s, t.TempDir(), "repo")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < pushes; i++ {
+			err = c.commit(fmt.Sprintf("w%d-%d", w, i))
+			if err != nil {
+				return err
+			}
+			for attempt := 0; ; attempt++ {
+				_, err = c.git("push", "--quiet", "origin", "HEAD:refs/heads/main")
+				if err == nil {
+					break
+				}
+				if !strings.Contains(err.Error(), "fetch first") || attempt == 100 {
+					return err
+				}
+				// Someone else pushed first.
+				_, err = c.git("pull", "--quiet", "--rebase", "origin", "main")
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	for w, err := range errs {
+		if err != nil {
+			t.Errorf("worker %d: %s", w, err)
+		}
+	}
+	out, err := gitOutput(filepath.Join(rs.Path, "repo"), "rev-list", "--count", "refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.TrimSpace(out); n != fmt.Sprint(workers*pushes) {
+		t.Errorf("main has %s commits, want %d", n, workers*pushes)
+	}
+	checkRepo(t, rs, workers*pushes)
+}
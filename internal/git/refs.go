@@ -0,0 +1,79 @@
+package git
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Ref is a branch or tag, and the commit it points to.
+type Ref struct {
+	// Name is the full name of the ref, such as refs/heads/main.
+	Name  string
+	IsTag bool
+	// IsDefault is set for the branch HEAD points to.
+	IsDefault bool
+	Commit    *object.Commit
+}
+
+// Short returns the name of the ref without its refs/heads/ or refs/tags/
+// prefix.
+func (r Ref) Short() string {
+	return plumbing.ReferenceName(r.Name).Short()
+}
+
+// Refs returns the branches and then the tags of the repository that point to
+// a commit. The default branch comes first, and the others are sorted by the
+// date of their commit, newest first.
+func (r *Repo) Refs() ([]Ref, error) {
+	var def plumbing.ReferenceName
+	if hr, err := r.Repository.Reference(plumbing.HEAD, false); err == nil && hr.Type() == plumbing.SymbolicReference {
+		def = hr.Target()
+	}
+	iter, err := r.Repository.References()
+	if err != nil {
+		return nil, err
+	}
+	var refs []Ref
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		n := ref.Name()
+		if ref.Type() != plumbing.HashReference || !(n.IsBranch() || n.IsTag()) {
+			return nil
+		}
+		h := ref.Hash()
+		// Annotated tags point to a tag object rather than to the commit.
+		if t, err := r.Repository.TagObject(h); err == nil {
+			h = t.Target
+		}
+		c, err := r.Repository.CommitObject(h)
+		if err != nil {
+			// Like commitRefs, skip refs that don't point to a commit.
+			return nil
+		}
+		refs = append(refs, Ref{
+			Name:      n.String(),
+			IsTag:     n.IsTag(),
+			IsDefault: n == def,
+			Commit:    c,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		switch {
+		case a.IsTag != b.IsTag:
+			return !a.IsTag
+		case a.IsDefault != b.IsDefault:
+			return a.IsDefault
+		case !a.Commit.Committer.When.Equal(b.Commit.Committer.When):
+			return a.Commit.Committer.When.After(b.Commit.Committer.When)
+		default:
+			return a.Name < b.Name
+		}
+	})
+	return refs, nil
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrNotAFile indicates that a path is a directory or submodule rather than a
+// file.
+var ErrNotAFile = errors.New("not a file")
+
+// TreeEntry is a file or directory in the tree of a commit.
+type TreeEntry struct {
+	Name string
+	// Path is the path of the entry from the root of the tree.
+	Path  string
+	IsDir bool
+	// IsSubmodule is set for submodules, whose contents aren't in the
+	// repository.
+	IsSubmodule bool
+	// Size is the size of a file in bytes.
+	Size int64
+}
+
+// tree returns the tree of the commit the revision points to, such as HEAD or
+// refs/heads/main.
+func (r *Repo) tree(rev string) (*object.Tree, error) {
+	h, err := r.Repository.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.Repository.CommitObject(*h)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tree()
+}
+
+// Tree returns the entries of the directory at dir in the tree of the commit
+// the revision points to, directories first and then by name. The root
+// directory is "".
+func (r *Repo) Tree(rev string, dir string) ([]TreeEntry, error) {
+	t, err := r.tree(rev)
+	if err != nil {
+		return nil, err
+	}
+	dir = strings.Trim(dir, "/")
+	if dir != "" {
+		t, err = t.Tree(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	es := make([]TreeEntry, 0, len(t.Entries))
+	for _, e := range t.Entries {
+		te := TreeEntry{
+			Name:        e.Name,
+			Path:        path.Join(dir, e.Name),
+			IsDir:       e.Mode == filemode.Dir,
+			IsSubmodule: e.Mode == filemode.Submodule,
+		}
+		if !te.IsDir && !te.IsSubmodule {
+			te.Size, err = t.Size(e.Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		es = append(es, te)
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		if es[i].IsDir != es[j].IsDir {
+			return es[i].IsDir
+		}
+		return es[i].Name < es[j].Name
+	})
+	return es, nil
+}
+
+// ReadFile returns up to limit bytes of the file at the given path in the tree
+// of the commit the revision points to, and the full size of the file. A
+// negative limit reads the whole file.
+func (r *Repo) ReadFile(rev string, name string, limit int64) ([]byte, int64, error) {
+	t, err := r.tree(rev)
+	if err != nil {
+		return nil, 0, err
+	}
+	e, err := t.FindEntry(strings.Trim(name, "/"))
+	if err != nil {
+		return nil, 0, err
+	}
+	if !e.Mode.IsFile() {
+		return nil, 0, ErrNotAFile
+	}
+	b, err := r.Repository.BlobObject(e.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	rd, err := b.Reader()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rd.Close() // nolint: errcheck
+	var src io.Reader = rd
+	if limit >= 0 {
+		src = io.LimitReader(rd, limit)
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, b.Size, nil
+}
@@ -0,0 +1,257 @@
+// Package gitolite reads the access rules and public keys of a gitolite
+// server, so they can be translated into Soft Serve users.
+package gitolite
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Everyone is the gitolite group every user belongs to.
+const Everyone = "@all"
+
+// Config is the configuration of a gitolite server, read from a checkout of
+// its gitolite-admin repo.
+type Config struct {
+	// Keys maps user names to their public keys.
+	Keys map[string][]string
+	// Warnings lists the parts of the configuration that have no equivalent in
+	// Soft Serve and were ignored.
+	Warnings []string
+
+	groups map[string][]string
+	rules  map[string][]rule
+}
+
+type rule struct {
+	perm  string
+	users []string
+}
+
+// Parse reads conf/gitolite.conf and the public keys in keydir of a checkout
+// of a gitolite-admin repo.
+func Parse(dir string) (*Config, error) {
+	c := &Config{
+		Keys:   make(map[string][]string),
+		groups: make(map[string][]string),
+		rules:  make(map[string][]rule),
+	}
+	err := c.parseConf(filepath.Join(dir, "conf", "gitolite.conf"), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = c.readKeys(filepath.Join(dir, "keydir"))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Repos returns the names of the repos that have access rules, sorted.
+func (c *Config) Repos() []string {
+	names := make([]string, 0, len(c.rules))
+	for n := range c.rules {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Users returns the names of the users that have public keys, sorted.
+func (c *Config) Users() []string {
+	names := make([]string, 0, len(c.Keys))
+	for n := range c.Keys {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CanRead reports whether user can read repo. User can also be one of the
+// special gitolite users, such as daemon or gitweb.
+func (c *Config) CanRead(repo string, user string) bool {
+	return c.can(repo, user, func(perm string) bool {
+		return strings.HasPrefix(perm, "R")
+	})
+}
+
+// CanWrite reports whether user can push to repo.
+func (c *Config) CanWrite(repo string, user string) bool {
+	return c.can(repo, user, func(perm string) bool {
+		return strings.HasPrefix(perm, "RW")
+	})
+}
+
+func (c *Config) can(repo string, user string, allowed func(perm string) bool) bool {
+	for _, r := range c.rules[repo] {
+		if !allowed(r.perm) {
+			continue
+		}
+		for _, u := range r.users {
+			if u == user || u == Everyone || c.inGroup(u, user) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inGroup reports whether user is a member of group.
+func (c *Config) inGroup(group string, user string) bool {
+	for _, m := range c.expand([]string{group}) {
+		if m == user {
+			return true
+		}
+	}
+	return false
+}
+
+// expand replaces the groups in names with their members. @all is kept as is.
+func (c *Config) expand(names []string) []string {
+	seen := make(map[string]struct{})
+	res := make([]string, 0, len(names))
+	var walk func(names []string)
+	walk = func(names []string) {
+		for _, n := range names {
+			if _, ok := seen[n]; ok {
+				continue
+			}
+			seen[n] = struct{}{}
+			if ms, ok := c.groups[n]; ok && n != Everyone {
+				walk(ms)
+				continue
+			}
+			res = append(res, n)
+		}
+	}
+	walk(names)
+	return res
+}
+
+func (c *Config) warnf(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// parseConf parses a gitolite.conf file. Included files are parsed in place.
+func (c *Config) parseConf(path string, repos []string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+	s := bufio.NewScanner(f)
+	ln := 0
+	for s.Scan() {
+		ln++
+		l := s.Text()
+		if i := strings.IndexByte(l, '#'); i >= 0 {
+			l = l[:i]
+		}
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		fs := strings.Fields(l)
+		switch {
+		case fs[0] == "include":
+			ms, err := filepath.Glob(filepath.Join(filepath.Dir(path), strings.Trim(strings.Join(fs[1:], " "), `"'`)))
+			if err != nil {
+				return err
+			}
+			for _, m := range ms {
+				err = c.parseConf(m, repos)
+				if err != nil {
+					return err
+				}
+			}
+		case fs[0] == "subconf":
+			c.warnf("%s:%d: subconf is not supported", path, ln)
+		case fs[0] == "repo":
+			repos = make([]string, 0)
+			for _, r := range c.expand(fs[1:]) {
+				if strings.ContainsAny(r, `^$*[]()\|?+`) {
+					c.warnf("%s:%d: wild repo %q is not supported", path, ln, r)
+					continue
+				}
+				repos = append(repos, r)
+			}
+		case fs[0] == "option" || fs[0] == "config":
+			c.warnf("%s:%d: %s lines are not supported", path, ln, fs[0])
+		case isGroupDef(l):
+			i := strings.IndexByte(l, '=')
+			g := strings.TrimSpace(l[:i])
+			c.groups[g] = append(c.groups[g], strings.Fields(l[i+1:])...)
+		default:
+			i := strings.IndexByte(l, '=')
+			if i < 0 {
+				c.warnf("%s:%d: can't parse %q", path, ln, l)
+				continue
+			}
+			lhs := strings.Fields(l[:i])
+			if len(lhs) == 0 {
+				c.warnf("%s:%d: can't parse %q", path, ln, l)
+				continue
+			}
+			perm := lhs[0]
+			if perm == "-" {
+				// Skipping a deny rule would grant the access it denies, so
+				// the configuration can't be translated.
+				return fmt.Errorf("%s:%d: deny rules are not supported, remove them to import", path, ln)
+			}
+			if len(lhs) > 1 {
+				c.warnf("%s:%d: ref restrictions are not supported, %s applies to the whole repo", path, ln, perm)
+			}
+			users := strings.Fields(l[i+1:])
+			for _, r := range repos {
+				c.rules[r] = append(c.rules[r], rule{perm: perm, users: users})
+			}
+		}
+	}
+	return s.Err()
+}
+
+// isGroupDef reports whether a line defines a group, such as
+// "@devs = alice bob". Spaces around the = are optional.
+func isGroupDef(l string) bool {
+	i := strings.IndexByte(l, '=')
+	if i < 0 {
+		return false
+	}
+	lhs := strings.Fields(l[:i])
+	return len(lhs) == 1 && strings.HasPrefix(lhs[0], "@")
+}
+
+// readKeys reads the public keys in keydir. Key files are named after their
+// user, optionally followed by @ and a key name, and can be in subdirectories.
+func (c *Config) readKeys(keydir string) error {
+	return filepath.Walk(keydir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == keydir {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".pub") {
+			return nil
+		}
+		user := strings.TrimSuffix(fi.Name(), ".pub")
+		if i := strings.LastIndexByte(user, '@'); i > 0 && !strings.Contains(user[i:], ".") {
+			user = user[:i]
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, k := range strings.Split(string(data), "\n") {
+			k = strings.TrimSpace(k)
+			if k != "" && !strings.HasPrefix(k, "#") {
+				c.Keys[user] = append(c.Keys[user], k)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package gitolite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAdmin writes the given files to a gitolite-admin checkout and returns
+// its path.
+func writeAdmin(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(data), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParse(t *testing.T) {
+	dir := writeAdmin(t, map[string]string{
+		"conf/gitolite.conf": `# The admin repo.
+repo gitolite-admin
+    RW+     =   admin
+
+@grp=alice
+@devs   =   @grp bob
+@repos  =   soft wish
+
+repo @repos
+    RW      =   @devs
+    R       =   carol # readers
+
+repo docs
+    RW  master  =   carol
+    R           =   @all
+
+repo foo/..*
+    RW  =   alice
+
+include "extra/*.conf"
+`,
+		"conf/extra/more.conf": `repo extra
+    RW+ = dave
+    option deny-rules = 1
+`,
+		"keydir/admin.pub":             "ssh-ed25519 AAAA admin\n",
+		"keydir/alice@laptop.pub":      "ssh-ed25519 AAAA alice1\n",
+		"keydir/sub/alice@desktop.pub": "# comment\nssh-ed25519 AAAA alice2\n\n",
+		"keydir/bob@example.com.pub":   "ssh-ed25519 AAAA bob\n",
+		"keydir/notes.txt":             "not a key",
+	})
+	c, err := Parse(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(c.Repos(), " "), "docs extra gitolite-admin soft wish"; got != want {
+		t.Errorf("got repos %q, want %q", got, want)
+	}
+	if got, want := strings.Join(c.Users(), " "), "admin alice bob@example.com"; got != want {
+		t.Errorf("got users %q, want %q", got, want)
+	}
+	if got := len(c.Keys["alice"]); got != 2 {
+		t.Errorf("got %d keys for alice, want 2", got)
+	}
+
+	cases := []struct {
+		repo, user  string
+		read, write bool
+	}{
+		{"gitolite-admin", "admin", true, true},
+		{"gitolite-admin", "alice", false, false},
+		{"soft", "alice", true, true},
+		{"wish", "bob", true, true},
+		{"soft", "carol", true, false},
+		{"soft", "dave", false, false},
+		{"docs", "carol", true, true},
+		{"docs", "dave", true, false},
+		{"docs", "daemon", true, false},
+		{"extra", "dave", true, true},
+		{"foo/bar", "alice", false, false},
+	}
+	for _, tc := range cases {
+		if got := c.CanRead(tc.repo, tc.user); got != tc.read {
+			t.Errorf("CanRead(%q, %q) = %t, want %t", tc.repo, tc.user, got, tc.read)
+		}
+		if got := c.CanWrite(tc.repo, tc.user); got != tc.write {
+			t.Errorf("CanWrite(%q, %q) = %t, want %t", tc.repo, tc.user, got, tc.write)
+		}
+	}
+
+	for _, w := range []string{
+		"ref restrictions are not supported",
+		`wild repo "foo/..*" is not supported`,
+		"option lines are not supported",
+	} {
+		found := false
+		for _, cw := range c.Warnings {
+			found = found || strings.Contains(cw, w)
+		}
+		if !found {
+			t.Errorf("no warning %q in %q", w, c.Warnings)
+		}
+	}
+	if len(c.Warnings) != 3 {
+		t.Errorf("got warnings %q, want 3", c.Warnings)
+	}
+}
+
+func TestParseDenyRule(t *testing.T) {
+	dir := writeAdmin(t, map[string]string{
+		"conf/gitolite.conf": `repo soft
+    -   master  =   bob
+    RW+         =   @all
+`,
+	})
+	_, err := Parse(dir)
+	if err == nil || !strings.Contains(err.Error(), "gitolite.conf:2: deny rules are not supported") {
+		t.Errorf("got error %v, want a deny rule error", err)
+	}
+}
+
+func TestParseMissingConf(t *testing.T) {
+	_, err := Parse(t.TempDir())
+	if !os.IsNotExist(err) {
+		t.Errorf("got error %v, want a missing file error", err)
+	}
+}
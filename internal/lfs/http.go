@@ -0,0 +1,601 @@
+package lfs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	gm "github.com/charmbracelet/wish/git"
+)
+
+const mediaType = "application/vnd.git-lfs+json"
+
+// maxLocks is the maximum number of locks returned at once.
+const maxLocks = 100
+
+type pointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type batchRequest struct {
+	Operation string    `json:"operation"`
+	Transfers []string  `json:"transfers"`
+	Objects   []pointer `json:"objects"`
+	HashAlgo  string    `json:"hash_algo"`
+}
+
+type batchResponse struct {
+	Transfer string         `json:"transfer"`
+	Objects  []*batchObject `json:"objects"`
+	HashAlgo string         `json:"hash_algo"`
+}
+
+type batchObject struct {
+	pointer
+	Authenticated bool               `json:"authenticated,omitempty"`
+	Actions       map[string]*action `json:"actions,omitempty"`
+	Error         *objectError       `json:"error,omitempty"`
+}
+
+type action struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in,omitempty"`
+}
+
+type objectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lockOwner struct {
+	Name string `json:"name"`
+}
+
+type lock struct {
+	ID       string     `json:"id"`
+	Path     string     `json:"path"`
+	LockedAt time.Time  `json:"locked_at"`
+	Owner    *lockOwner `json:"owner,omitempty"`
+}
+
+type lockRequest struct {
+	Path   string `json:"path"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+	Force  bool   `json:"force"`
+}
+
+// request is an authenticated request to the LFS API of a repo.
+type request struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	repo string
+	// user is the name of the user the request was authenticated as, or
+	// config.Anonymous.
+	user   string
+	access gm.AccessLevel
+}
+
+// Handler serves the Git LFS batch API, the basic transfer adapter and the
+// file locking API at /<repo>.git/info/lfs. Requests are authenticated with
+// the tokens handed out by git-lfs-authenticate, either as bearer tokens or as
+// the password of basic auth, and get the same access to a repo as the user
+// does over SSH. Requests without credentials are anonymous.
+type Handler struct {
+	cfg   *config.Config
+	store *Store
+}
+
+// NewHandler returns a Handler storing objects under the repo path of cfg.
+func NewHandler(cfg *config.Config) *Handler {
+	return &Handler{
+		cfg:   cfg,
+		store: NewStore(cfg.Cfg.RepoPath),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i := strings.Index(r.URL.Path, "/info/lfs/")
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	repo := repoName(r.URL.Path[:i])
+	route := r.URL.Path[i+len("/info/lfs/"):]
+	if !git.ValidRepoName(repo) {
+		writeError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+	user, ok := h.user(r)
+	if !ok {
+		w.Header().Set("LFS-Authenticate", `Basic realm="Soft Serve"`)
+		writeError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+	req := &request{
+		w:      w,
+		r:      r,
+		repo:   repo,
+		user:   user,
+		access: h.cfg.AuthRepoUser(repo, user),
+	}
+	switch {
+	case route == "objects/batch" && r.Method == http.MethodPost:
+		h.batch(req)
+	case route == "objects/verify" && r.Method == http.MethodPost:
+		h.verify(req)
+	case strings.HasPrefix(route, "objects/") && r.Method == http.MethodGet:
+		h.download(req, strings.TrimPrefix(route, "objects/"))
+	case strings.HasPrefix(route, "objects/") && r.Method == http.MethodPut:
+		h.upload(req, strings.TrimPrefix(route, "objects/"))
+	case route == "locks" && r.Method == http.MethodGet:
+		h.listLocks(req)
+	case route == "locks" && r.Method == http.MethodPost:
+		h.createLock(req)
+	case route == "locks/verify" && r.Method == http.MethodPost:
+		h.verifyLocks(req)
+	case strings.HasPrefix(route, "locks/") && strings.HasSuffix(route, "/unlock") && r.Method == http.MethodPost:
+		h.unlock(req, strings.TrimSuffix(strings.TrimPrefix(route, "locks/"), "/unlock"))
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// user returns the name of the user a request is authenticated as. It returns
+// false if the request has invalid credentials.
+func (h *Handler) user(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return config.Anonymous, true
+	}
+	var raw string
+	switch {
+	case strings.HasPrefix(auth, "Bearer "):
+		raw = strings.TrimPrefix(auth, "Bearer ")
+	case strings.HasPrefix(auth, "Basic "):
+		b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+		if err != nil {
+			return "", false
+		}
+		i := strings.IndexByte(string(b), ':')
+		if i < 0 {
+			return "", false
+		}
+		raw = string(b[i+1:])
+	default:
+		return "", false
+	}
+	t, err := h.cfg.DB.Token(raw)
+	if err != nil {
+		return "", false
+	}
+	return t.User, true
+}
+
+// auth checks that the request has at least the given access to the repo,
+// and writes an error response if it doesn't. Anonymous requests are asked
+// for credentials, and repos the user can't read are reported as missing.
+func (req *request) auth(access gm.AccessLevel) bool {
+	if req.access >= access {
+		return true
+	}
+	switch {
+	case req.r.Header.Get("Authorization") == "":
+		req.w.Header().Set("LFS-Authenticate", `Basic realm="Soft Serve"`)
+		writeError(req.w, http.StatusUnauthorized, "authentication required")
+	case req.access == gm.NoAccess:
+		writeError(req.w, http.StatusNotFound, "repository not found")
+	default:
+		writeError(req.w, http.StatusForbidden, "you don't have write access to this repository")
+	}
+	return false
+}
+
+// readJSON decodes the JSON body of a request, writing an error response if
+// it's invalid.
+func (req *request) readJSON(v interface{}) bool {
+	err := json.NewDecoder(req.r.Body).Decode(v)
+	if err != nil {
+		writeError(req.w, http.StatusUnprocessableEntity, fmt.Sprintf("invalid request: %s", err))
+		return false
+	}
+	return true
+}
+
+func (h *Handler) batch(req *request) {
+	var br batchRequest
+	if !req.readJSON(&br) {
+		return
+	}
+	access, err := operationAccess(br.Operation)
+	if err != nil {
+		writeError(req.w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if !req.auth(access) {
+		return
+	}
+	if br.HashAlgo != "" && br.HashAlgo != "sha256" {
+		writeError(req.w, http.StatusConflict, fmt.Sprintf("unsupported hash algorithm %q", br.HashAlgo))
+		return
+	}
+	if len(br.Transfers) > 0 && !contains(br.Transfers, "basic") {
+		writeError(req.w, http.StatusUnprocessableEntity, "only the basic transfer adapter is supported")
+		return
+	}
+	if _, err := h.cfg.Source.GetRepo(req.repo); err != nil {
+		writeError(req.w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	href := repoURL(h.cfg, req.repo) + "/objects/"
+	header := make(map[string]string)
+	if auth := req.r.Header.Get("Authorization"); auth != "" {
+		header["Authorization"] = auth
+	}
+	res := batchResponse{
+		Transfer: "basic",
+		Objects:  make([]*batchObject, 0, len(br.Objects)),
+		HashAlgo: "sha256",
+	}
+	var limits *config.QuotaLimits
+	if br.Operation == "upload" {
+		limits, err = h.cfg.QuotaLimits(req.repo, req.user)
+		if err != nil {
+			log.Printf("error computing the quotas of %s: %s", req.repo, err)
+			writeError(req.w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+	var uploadSize int64
+	for _, p := range br.Objects {
+		bo := &batchObject{pointer: p}
+		res.Objects = append(res.Objects, bo)
+		if !ValidOID(p.OID) || p.Size < 0 {
+			bo.Error = &objectError{Code: http.StatusUnprocessableEntity, Message: "invalid object"}
+			continue
+		}
+		o, err := h.cfg.DB.LFSObject(req.repo, p.OID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			log.Printf("error looking up LFS object %s in %s: %s", p.OID, req.repo, err)
+			bo.Error = &objectError{Code: http.StatusInternalServerError, Message: "internal error"}
+			continue
+		}
+		switch {
+		case br.Operation == "download" && o == nil:
+			bo.Error = &objectError{Code: http.StatusNotFound, Message: "object not found"}
+		case br.Operation == "download":
+			bo.Size = o.Size
+			bo.Authenticated = true
+			bo.Actions = map[string]*action{
+				"download": {Href: href + p.OID, Header: header},
+			}
+		case o != nil:
+			// Already uploaded, nothing to do.
+		default:
+			if err := limits.CheckObject(p.Size); err != nil {
+				bo.Error = &objectError{Code: http.StatusUnprocessableEntity, Message: err.Error()}
+				continue
+			}
+			uploadSize += p.Size
+			bo.Authenticated = true
+			bo.Actions = map[string]*action{
+				"upload": {Href: href + p.OID, Header: header},
+				"verify": {Href: href + "verify", Header: header},
+			}
+		}
+	}
+	if limits != nil {
+		err = limits.Check(uploadSize)
+		if err != nil {
+			writeError(req.w, http.StatusInsufficientStorage, err.Error())
+			return
+		}
+	}
+	writeJSON(req.w, http.StatusOK, res)
+}
+
+func (h *Handler) download(req *request, oid string) {
+	if !req.auth(gm.ReadOnlyAccess) {
+		return
+	}
+	if !ValidOID(oid) {
+		writeError(req.w, http.StatusNotFound, "object not found")
+		return
+	}
+	// Objects are shared between repos, so only serve objects that were
+	// uploaded to this one.
+	if _, err := h.cfg.DB.LFSObject(req.repo, oid); err != nil {
+		writeError(req.w, http.StatusNotFound, "object not found")
+		return
+	}
+	f, err := h.store.Open(oid)
+	if err != nil {
+		log.Printf("error opening LFS object %s of %s: %s", oid, req.repo, err)
+		writeError(req.w, http.StatusNotFound, "object not found")
+		return
+	}
+	defer f.Close() // nolint: errcheck
+	req.w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(req.w, req.r, oid, time.Time{}, f)
+}
+
+func (h *Handler) upload(req *request, oid string) {
+	if !req.auth(gm.ReadWriteAccess) {
+		return
+	}
+	if !ValidOID(oid) {
+		writeError(req.w, http.StatusUnprocessableEntity, "invalid object ID")
+		return
+	}
+	if _, err := h.cfg.Source.GetRepo(req.repo); err != nil {
+		writeError(req.w, http.StatusNotFound, "repository not found")
+		return
+	}
+	limits, err := h.cfg.QuotaLimits(req.repo, req.user)
+	if err != nil {
+		log.Printf("error computing the quotas of %s: %s", req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	// Uploads don't have to go through the batch API, so the quotas are
+	// checked again, and the body is never read past the size it declares.
+	if req.r.ContentLength < 0 {
+		writeError(req.w, http.StatusLengthRequired, "missing content length")
+		return
+	}
+	err = limits.CheckObject(req.r.ContentLength)
+	if err != nil {
+		writeError(req.w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	err = limits.Check(req.r.ContentLength)
+	if err != nil {
+		writeError(req.w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+	body := http.MaxBytesReader(req.w, req.r.Body, req.r.ContentLength)
+	// The content is hashed even if the object is already stored for another
+	// repo, so it can't be added to a repo without having it.
+	n, err := h.store.Put(oid, body)
+	if errors.Is(err, ErrBadObject) {
+		writeError(req.w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("error storing LFS object %s of %s: %s", oid, req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "error storing object")
+		return
+	}
+	_, err = h.cfg.DB.AddLFSObject(&db.LFSObject{Repo: req.repo, OID: oid, Size: n, CreatedBy: req.user})
+	if err != nil {
+		log.Printf("error recording LFS object %s of %s: %s", oid, req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "error storing object")
+		return
+	}
+	req.w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) verify(req *request) {
+	if !req.auth(gm.ReadWriteAccess) {
+		return
+	}
+	var p pointer
+	if !req.readJSON(&p) {
+		return
+	}
+	o, err := h.cfg.DB.LFSObject(req.repo, p.OID)
+	if err != nil {
+		writeError(req.w, http.StatusNotFound, "object not found")
+		return
+	}
+	if o.Size != p.Size {
+		writeError(req.w, http.StatusUnprocessableEntity, fmt.Sprintf("object size is %d, expected %d", o.Size, p.Size))
+		return
+	}
+	writeJSON(req.w, http.StatusOK, p)
+}
+
+func (h *Handler) listLocks(req *request) {
+	if !req.auth(gm.ReadOnlyAccess) {
+		return
+	}
+	ls, err := h.cfg.DB.LFSLocks(req.repo)
+	if err != nil {
+		log.Printf("error listing LFS locks of %s: %s", req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "error listing locks")
+		return
+	}
+	q := req.r.URL.Query()
+	path, id := q.Get("path"), q.Get("id")
+	filtered := make([]*db.LFSLock, 0, len(ls))
+	for _, l := range ls {
+		if (path == "" || l.Path == path) && (id == "" || l.ID == id) {
+			filtered = append(filtered, l)
+		}
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	page, next := paginate(filtered, q.Get("cursor"), limit)
+	writeJSON(req.w, http.StatusOK, map[string]interface{}{
+		"locks":       apiLocks(page),
+		"next_cursor": next,
+	})
+}
+
+func (h *Handler) createLock(req *request) {
+	if !req.auth(gm.ReadWriteAccess) {
+		return
+	}
+	var lr lockRequest
+	if !req.readJSON(&lr) {
+		return
+	}
+	if lr.Path == "" {
+		writeError(req.w, http.StatusUnprocessableEntity, "missing path")
+		return
+	}
+	l := &db.LFSLock{Repo: req.repo, Path: lr.Path, Owner: req.user}
+	el, err := h.cfg.DB.CreateLFSLock(l)
+	if errors.Is(err, db.ErrLockExists) {
+		writeJSON(req.w, http.StatusConflict, map[string]interface{}{
+			"lock":    apiLock(el),
+			"message": "already created lock",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("error creating LFS lock in %s: %s", req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "error creating lock")
+		return
+	}
+	writeJSON(req.w, http.StatusCreated, map[string]interface{}{"lock": apiLock(l)})
+}
+
+func (h *Handler) verifyLocks(req *request) {
+	if !req.auth(gm.ReadWriteAccess) {
+		return
+	}
+	var lr lockRequest
+	if !req.readJSON(&lr) {
+		return
+	}
+	ls, err := h.cfg.DB.LFSLocks(req.repo)
+	if err != nil {
+		log.Printf("error listing LFS locks of %s: %s", req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "error listing locks")
+		return
+	}
+	page, next := paginate(ls, lr.Cursor, lr.Limit)
+	ours := make([]*lock, 0)
+	theirs := make([]*lock, 0)
+	for _, l := range page {
+		if l.Owner == req.user {
+			ours = append(ours, apiLock(l))
+		} else {
+			theirs = append(theirs, apiLock(l))
+		}
+	}
+	writeJSON(req.w, http.StatusOK, map[string]interface{}{
+		"ours":        ours,
+		"theirs":      theirs,
+		"next_cursor": next,
+	})
+}
+
+func (h *Handler) unlock(req *request, id string) {
+	if !req.auth(gm.ReadWriteAccess) {
+		return
+	}
+	var lr lockRequest
+	if !req.readJSON(&lr) {
+		return
+	}
+	l, err := h.cfg.DB.LFSLock(req.repo, id)
+	if err != nil {
+		writeError(req.w, http.StatusNotFound, "lock not found")
+		return
+	}
+	if l.Owner != req.user {
+		if !lr.Force {
+			writeError(req.w, http.StatusForbidden, fmt.Sprintf("lock is owned by %s", l.Owner))
+			return
+		}
+		if req.access < gm.AdminAccess {
+			writeError(req.w, http.StatusForbidden, "only admins can remove locks of other users")
+			return
+		}
+	}
+	err = h.cfg.DB.DeleteLFSLock(req.repo, id)
+	if err != nil {
+		log.Printf("error deleting LFS lock %s of %s: %s", id, req.repo, err)
+		writeError(req.w, http.StatusInternalServerError, "error deleting lock")
+		return
+	}
+	writeJSON(req.w, http.StatusOK, map[string]interface{}{"lock": apiLock(l)})
+}
+
+// paginate returns the page of locks starting at the lock with ID cursor, or
+// at the first lock if cursor is empty, and the ID of the first lock of the
+// next page, if any.
+func paginate(ls []*db.LFSLock, cursor string, limit int) ([]*db.LFSLock, string) {
+	if limit <= 0 || limit > maxLocks {
+		limit = maxLocks
+	}
+	start := 0
+	if cursor != "" {
+		start = len(ls)
+		for i, l := range ls {
+			if l.ID == cursor {
+				start = i
+				break
+			}
+		}
+	}
+	ls = ls[start:]
+	if len(ls) <= limit {
+		return ls, ""
+	}
+	return ls[:limit], ls[limit].ID
+}
+
+func apiLock(l *db.LFSLock) *lock {
+	return &lock{
+		ID:       l.ID,
+		Path:     l.Path,
+		LockedAt: l.LockedAt,
+		Owner:    &lockOwner{Name: l.Owner},
+	}
+}
+
+func apiLocks(ls []*db.LFSLock) []*lock {
+	res := make([]*lock, 0, len(ls))
+	for _, l := range ls {
+		res = append(res, apiLock(l))
+	}
+	return res
+}
+
+// repoName returns the name of a repo from its path in a URL or in the
+// arguments of git-lfs-authenticate.
+func repoName(path string) string {
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// repoURL returns the URL of the LFS API of a repo.
+func repoURL(cfg *config.Config, repo string) string {
+	return fmt.Sprintf("%s/%s.git/info/lfs", cfg.Cfg.HTTPURL, repo)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("error writing LFS response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"message": msg})
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
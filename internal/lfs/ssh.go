@@ -0,0 +1,96 @@
+package lfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/wish"
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/gliderlabs/ssh"
+)
+
+// tokenTTL is how long the tokens handed out by git-lfs-authenticate are
+// valid. git-lfs asks for a new one once it expires.
+const tokenTTL = time.Hour
+
+// authResponse is the response to git-lfs-authenticate.
+type authResponse struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header"`
+	ExpiresIn int               `json:"expires_in"`
+}
+
+// Middleware handles the git-lfs-authenticate SSH command, which git-lfs runs
+// to get the URL and credentials of the LFS API of a repo served over SSH.
+// Other sessions are passed on to the next handler.
+func Middleware(cfg *config.Config) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			args := s.Command()
+			if len(args) == 0 {
+				sh(s)
+				return
+			}
+			var err error
+			switch args[0] {
+			case "git-lfs-authenticate":
+				err = authenticate(cfg, s, args[1:])
+			case "git-lfs-transfer":
+				// git-lfs falls back to git-lfs-authenticate.
+				err = fmt.Errorf("git-lfs-transfer is not supported")
+			default:
+				sh(s)
+				return
+			}
+			if err != nil {
+				fmt.Fprintf(s.Stderr(), "error: %s\n", err)
+				_ = s.Exit(1)
+				return
+			}
+			_ = s.Exit(0)
+		}
+	}
+}
+
+// authenticate checks that the user has the access needed for an LFS
+// operation on a repo and writes a short-lived token for the LFS API.
+func authenticate(cfg *config.Config, s ssh.Session, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: git-lfs-authenticate <repo> <upload|download>")
+	}
+	repo := repoName(args[0])
+	access, err := operationAccess(args[1])
+	if err != nil {
+		return err
+	}
+	if cfg.AuthRepo(repo, s.PublicKey()) < access {
+		return gm.ErrNotAuthed
+	}
+	err = cfg.DB.DeleteExpiredTokens()
+	if err != nil {
+		return err
+	}
+	raw, _, err := cfg.DB.CreateToken(cfg.UserName(s.PublicKey()), "git-lfs", time.Now().Add(tokenTTL))
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(s).Encode(authResponse{
+		Href:      repoURL(cfg, repo),
+		Header:    map[string]string{"Authorization": "Bearer " + raw},
+		ExpiresIn: int(tokenTTL / time.Second),
+	})
+}
+
+// operationAccess returns the access level needed for an LFS operation.
+func operationAccess(op string) (gm.AccessLevel, error) {
+	switch op {
+	case "download":
+		return gm.ReadOnlyAccess, nil
+	case "upload":
+		return gm.ReadWriteAccess, nil
+	default:
+		return gm.NoAccess, fmt.Errorf("unknown operation %q", op)
+	}
+}
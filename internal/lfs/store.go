@@ -0,0 +1,108 @@
+// Package lfs implements Git LFS for Soft Serve: the batch and locking APIs
+// over HTTP, and the git-lfs-authenticate SSH command that hands out the
+// credentials to use them.
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrBadObject indicates that uploaded content doesn't match its object ID.
+var ErrBadObject = errors.New("content doesn't match the object ID")
+
+// Store is an on-disk store of LFS objects, shared by all repos. Objects are
+// stored by their SHA-256 object ID, so content pushed to several repos is
+// only stored once. Which repos an object belongs to is recorded in the
+// database.
+type Store struct {
+	Path string
+}
+
+// NewStore returns the object store under the repo path.
+func NewStore(repoPath string) *Store {
+	// Hidden, so it isn't taken for a repo.
+	return &Store{Path: filepath.Join(repoPath, ".lfs")}
+}
+
+// ValidOID reports whether oid is a valid SHA-256 object ID.
+func ValidOID(oid string) bool {
+	if len(oid) != 64 {
+		return false
+	}
+	for _, c := range oid {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// objectPath returns the path of an object. Objects are spread over two
+// levels of directories, like git-lfs does locally.
+func (s *Store) objectPath(oid string) string {
+	return filepath.Join(s.Path, "objects", oid[0:2], oid[2:4], oid)
+}
+
+// Objects returns the IDs of all stored objects.
+func (s *Store) Objects() ([]string, error) {
+	oids := make([]string, 0)
+	err := filepath.Walk(filepath.Join(s.Path, "objects"), func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && ValidOID(fi.Name()) {
+			oids = append(oids, fi.Name())
+		}
+		return nil
+	})
+	return oids, err
+}
+
+// Open opens an object for reading.
+func (s *Store) Open(oid string) (*os.File, error) {
+	return os.Open(s.objectPath(oid))
+}
+
+// Put stores the content read from r as the object oid and returns its size.
+// The content is written to a temporary file first and only moved in place if
+// its SHA-256 hash matches oid, so readers never see partial objects.
+func (s *Store) Put(oid string, r io.Reader) (int64, error) {
+	tmp := filepath.Join(s.Path, "tmp")
+	err := os.MkdirAll(tmp, os.ModeDir|os.FileMode(0700))
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(tmp, oid)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		f.Close() // nolint: errcheck
+		return 0, err
+	}
+	err = f.Close()
+	if err != nil {
+		return 0, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != oid {
+		return 0, fmt.Errorf("%w: %s", ErrBadObject, oid)
+	}
+	op := s.objectPath(oid)
+	err = os.MkdirAll(filepath.Dir(op), os.ModeDir|os.FileMode(0700))
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(f.Name(), op)
+}
@@ -0,0 +1,386 @@
+// Package limit protects the SSH server from clients opening too many
+// sessions, running too many git commands or failing to authenticate over and
+// over, as configured by the limits of the config.
+//
+// Sessions and git commands are counted per public key, or per IP address for
+// clients without a key. Failed connections are counted per IP address, which
+// is locked out once it fails too often.
+package limit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/push"
+	"github.com/charmbracelet/wish"
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Errors sent to throttled clients.
+var (
+	ErrTooManySessions = errors.New("too many sessions, try again later")
+	ErrTooManyGit      = errors.New("too many git operations, try again in a minute")
+)
+
+// metrics counts the throttled requests, which admins see with server limits.
+var metrics = expvar.NewMap("limits")
+
+// Names of the metrics.
+const (
+	metricSessionsRejected    = "sessions_rejected"
+	metricGitRejected         = "git_rejected"
+	metricAuthFailures        = "auth_failures"
+	metricLockouts            = "lockouts"
+	metricConnectionsRejected = "connections_rejected"
+)
+
+// gitCommands are the commands counted as git operations.
+var gitCommands = map[string]bool{
+	"git-upload-pack":    true,
+	"git-upload-archive": true,
+	"git-receive-pack":   true,
+}
+
+// forgetFailuresAfter is how long the failed connections of an IP address are
+// remembered once its lockout is over.
+const forgetFailuresAfter = 24 * time.Hour
+
+// sweepInterval is how often the clients and IP addresses that aren't limited
+// anymore are forgotten.
+const sweepInterval = time.Minute
+
+// client is the state of a public key, or of an IP address for clients
+// without a key.
+type client struct {
+	name     string
+	sessions int
+	// tokens is the number of git operations the client can run right now.
+	// It's refilled over the minute.
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update, up to perMinute.
+func (c *client) refill(perMinute int, now time.Time) {
+	c.tokens += now.Sub(c.updated).Minutes() * float64(perMinute)
+	if c.tokens > float64(perMinute) {
+		c.tokens = float64(perMinute)
+	}
+	c.updated = now
+}
+
+// failures are the failed connections of an IP address.
+type failures struct {
+	count int
+	// lockouts is the number of times the address was locked out, which
+	// doubles the length of the next lockout.
+	lockouts int
+	until    time.Time
+	last     time.Time
+}
+
+// Limiter enforces the limits of the config.
+type Limiter struct {
+	cfg       *config.Config
+	mtx       sync.Mutex
+	clients   map[string]*client
+	failures  map[string]*failures
+	lastSweep time.Time
+}
+
+// NewLimiter returns a new Limiter enforcing the limits of cfg, which are
+// read again every time they're checked.
+func NewLimiter(cfg *config.Config) *Limiter {
+	return &Limiter{
+		cfg:      cfg,
+		clients:  make(map[string]*client),
+		failures: make(map[string]*failures),
+	}
+}
+
+// Middleware rejects sessions over the session limit and git commands over
+// the git limit before they reach the next handler. Sessions of the users of
+// the config clear the failed connections of their IP address, but not its
+// past lockouts. Anonymous sessions don't, as anyone could open one between
+// guesses.
+func (l *Limiter) Middleware() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			ls := l.cfg.LimitSettings()
+			id, name := l.identity(s)
+			args := s.Command()
+			isGit := len(args) > 0 && gitCommands[args[0]]
+			err := l.open(ls, id, name, isGit)
+			if err != nil {
+				log.Printf("Throttled %s: %s", name, err)
+				if isGit {
+					push.FatalGit(s, err)
+				} else {
+					fmt.Fprintf(s.Stderr(), "error: %s\n", err)
+					_ = s.Exit(1)
+				}
+				return
+			}
+			defer l.close(id)
+			if l.cfg.IsUser(s.PublicKey()) {
+				l.succeeded(host(s.RemoteAddr()))
+			}
+			sh(s)
+		}
+	}
+}
+
+// open counts a new session of a client, and a git operation if isGit is set.
+func (l *Limiter) open(ls *config.LimitSettings, id, name string, isGit bool) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	l.sweep(ls, now)
+	c, ok := l.clients[id]
+	if !ok {
+		c = &client{name: name, tokens: float64(ls.GitPerMinute), updated: now}
+		l.clients[id] = c
+	}
+	if ls.MaxSessions > 0 && c.sessions >= ls.MaxSessions {
+		metrics.Add(metricSessionsRejected, 1)
+		l.forget(ls, id, c)
+		return ErrTooManySessions
+	}
+	if isGit && ls.GitPerMinute > 0 {
+		c.refill(ls.GitPerMinute, now)
+		if c.tokens < 1 {
+			metrics.Add(metricGitRejected, 1)
+			l.forget(ls, id, c)
+			return ErrTooManyGit
+		}
+		c.tokens--
+	}
+	c.sessions++
+	return nil
+}
+
+// close counts the end of a session of a client.
+func (l *Limiter) close(id string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if c, ok := l.clients[id]; ok {
+		c.sessions--
+	}
+}
+
+// forget drops a client once it has no sessions and all its tokens. The
+// caller must hold l.mtx.
+func (l *Limiter) forget(ls *config.LimitSettings, id string, c *client) {
+	if c.sessions == 0 && c.tokens >= float64(ls.GitPerMinute) {
+		delete(l.clients, id)
+	}
+}
+
+// sweep forgets the clients and IP addresses that aren't limited anymore, at
+// most once per sweepInterval. The caller must hold l.mtx.
+func (l *Limiter) sweep(ls *config.LimitSettings, now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for id, c := range l.clients {
+		c.refill(ls.GitPerMinute, now)
+		l.forget(ls, id, c)
+	}
+	for ip, f := range l.failures {
+		if now.After(f.until) && now.Sub(f.last) > forgetFailuresAfter {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// Option installs the connection callbacks of the limiter on an SSH server:
+// connections from locked out IP addresses are closed right away, and failed
+// authentications are counted towards the lockout of their IP address.
+func (l *Limiter) Option() ssh.Option {
+	return func(srv *ssh.Server) error {
+		srv.ConnCallback = l.connCallback
+		srv.ConnectionFailedCallback = l.connectionFailed
+		return nil
+	}
+}
+
+func (l *Limiter) connCallback(ctx ssh.Context, conn net.Conn) net.Conn {
+	ip := host(conn.RemoteAddr())
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if f, ok := l.failures[ip]; ok && time.Now().Before(f.until) {
+		metrics.Add(metricConnectionsRejected, 1)
+		return nil
+	}
+	return conn
+}
+
+func (l *Limiter) connectionFailed(conn net.Conn, err error) {
+	// Clients closing the connection before authenticating, such as health
+	// checks, don't count.
+	var ae *gossh.ServerAuthError
+	if !errors.As(err, &ae) && !strings.Contains(err.Error(), "too many authentication failures") {
+		return
+	}
+	metrics.Add(metricAuthFailures, 1)
+	ls := l.cfg.LimitSettings()
+	if ls.AuthFailures == 0 {
+		return
+	}
+	ip := host(conn.RemoteAddr())
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	f, ok := l.failures[ip]
+	if !ok {
+		f = &failures{}
+		l.failures[ip] = f
+	}
+	f.count++
+	f.last = now
+	if f.count < ls.AuthFailures {
+		return
+	}
+	d := ls.Lockout
+	for i := 0; i < f.lockouts && d < config.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > config.MaxLockout {
+		d = config.MaxLockout
+	}
+	f.count = 0
+	f.lockouts++
+	f.until = now.Add(d)
+	metrics.Add(metricLockouts, 1)
+	log.Printf("Locked out %s for %s after %d failed authentications", ip, d, ls.AuthFailures)
+}
+
+// succeeded forgets the failed connections of an IP address once a user
+// authenticated from it. Its past lockouts are kept, so that the next one is
+// longer.
+func (l *Limiter) succeeded(ip string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if f, ok := l.failures[ip]; ok {
+		f.count = 0
+	}
+}
+
+// Client is a public key, or an IP address for clients without a key, using
+// the server.
+type Client struct {
+	// Name is the user name and key fingerprint, or the IP address.
+	Name     string
+	Sessions int
+	// GitLeft is the number of git operations the client can run right now,
+	// or -1 if they're unlimited.
+	GitLeft int
+}
+
+// Clients returns the clients that have open sessions or ran git operations
+// recently, sorted by name.
+func (l *Limiter) Clients() []Client {
+	ls := l.cfg.LimitSettings()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	cs := make([]Client, 0, len(l.clients))
+	for _, c := range l.clients {
+		left := -1
+		if ls.GitPerMinute > 0 {
+			c.refill(ls.GitPerMinute, now)
+			left = int(c.tokens)
+		}
+		cs = append(cs, Client{Name: c.name, Sessions: c.sessions, GitLeft: left})
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
+	return cs
+}
+
+// Lockout is an IP address that's locked out.
+type Lockout struct {
+	IP    string
+	Until time.Time
+	// Lockouts is the number of times the address was locked out.
+	Lockouts int
+}
+
+// Lockouts returns the IP addresses that are locked out, sorted by address.
+func (l *Limiter) Lockouts() []Lockout {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := time.Now()
+	lo := make([]Lockout, 0)
+	for ip, f := range l.failures {
+		if now.Before(f.until) {
+			lo = append(lo, Lockout{IP: ip, Until: f.until, Lockouts: f.lockouts})
+		}
+	}
+	sort.Slice(lo, func(i, j int) bool { return lo[i].IP < lo[j].IP })
+	return lo
+}
+
+// Unlock lifts the lockout of an IP address and forgets its failed
+// connections. It returns false if the address wasn't locked out.
+func (l *Limiter) Unlock(ip string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	f, ok := l.failures[ip]
+	if !ok {
+		return false
+	}
+	delete(l.failures, ip)
+	return time.Now().Before(f.until)
+}
+
+// Metrics returns the number of throttled requests by kind, since the server
+// started.
+func Metrics() map[string]int64 {
+	m := map[string]int64{
+		metricSessionsRejected:    0,
+		metricGitRejected:         0,
+		metricAuthFailures:        0,
+		metricLockouts:            0,
+		metricConnectionsRejected: 0,
+	}
+	metrics.Do(func(kv expvar.KeyValue) {
+		if v, ok := kv.Value.(*expvar.Int); ok {
+			m[kv.Key] = v.Value()
+		}
+	})
+	return m
+}
+
+// identity returns the key a session is counted under, and the name it's
+// shown with.
+func (l *Limiter) identity(s ssh.Session) (string, string) {
+	pk := s.PublicKey()
+	if pk == nil {
+		ip := host(s.RemoteAddr())
+		return "ip " + ip, ip
+	}
+	sum := sha256.Sum256(pk.Marshal())
+	fp := "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+	return "key " + fp, l.cfg.UserName(pk) + " " + fp
+}
+
+// host returns the IP address of a remote address.
+func host(addr net.Addr) string {
+	h, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return h
+}
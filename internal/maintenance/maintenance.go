@@ -0,0 +1,240 @@
+// Package maintenance maintains the repos of a Soft Serve server in the
+// background. Repos are maintained after a number of pushes or once they have
+// too many loose objects, with only a few maintained at once.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/git"
+)
+
+// retryDelay is how long to wait before maintaining a repo again when it was
+// busy.
+const retryDelay = time.Minute
+
+// Scheduler runs the maintenance of the repos. Repos are never maintained
+// while they're being pushed to, and pushes arriving during a maintenance
+// wait for it to finish.
+type Scheduler struct {
+	cfg *config.Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mtx guards the fields below. cond is signaled when a run finishes.
+	mtx  sync.Mutex
+	cond *sync.Cond
+	// pushes counts the pushes to each repo since it was last maintained.
+	pushes map[string]int
+	// queued holds the repos waiting to be maintained or being maintained,
+	// so that a repo is only scheduled once at a time.
+	queued  map[string]bool
+	running int
+}
+
+// NewScheduler returns a scheduler for the repos of cfg. It doesn't run
+// anything until it's started.
+func NewScheduler(cfg *config.Config) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+		pushes: make(map[string]int),
+		queued: make(map[string]bool),
+	}
+	s.cond = sync.NewCond(&s.mtx)
+	return s
+}
+
+// Start starts checking the repos for loose objects in the background.
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(s.cfg.MaintenanceSettings().Interval):
+				s.check()
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler, interrupting the running maintenance, and waits
+// for it to finish.
+func (s *Scheduler) Stop() {
+	// Cancelling while holding mtx makes sure no run is scheduled once
+	// we're waiting for the runs to finish.
+	s.mtx.Lock()
+	s.cancel()
+	s.cond.Broadcast()
+	s.mtx.Unlock()
+	s.wg.Wait()
+}
+
+// Pushed records a push to a repo, scheduling its maintenance once it was
+// pushed to often enough.
+func (s *Scheduler) Pushed(repo string) {
+	ms := s.cfg.MaintenanceSettings()
+	if ms.Disabled {
+		return
+	}
+	s.mtx.Lock()
+	s.pushes[repo]++
+	n := s.pushes[repo]
+	s.mtx.Unlock()
+	if n >= ms.Pushes {
+		s.schedule(repo, fmt.Sprintf("%d pushes", n))
+	}
+}
+
+// check schedules the maintenance of the repos that have too many loose
+// objects.
+func (s *Scheduler) check() {
+	ms := s.cfg.MaintenanceSettings()
+	if ms.Disabled {
+		return
+	}
+	for _, r := range s.cfg.Source.AllRepos() {
+		st, err := s.cfg.Source.Stats(r.Name)
+		if err != nil {
+			log.Printf("error checking the loose objects of %s: %s", r.Name, err)
+			continue
+		}
+		if st.LooseObjects >= int64(ms.LooseObjects) {
+			s.schedule(r.Name, fmt.Sprintf("%d loose objects", st.LooseObjects))
+		}
+	}
+}
+
+// schedule maintains a repo in the background, unless it's already
+// scheduled.
+func (s *Scheduler) schedule(repo string, trigger string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.queued[repo] || s.ctx.Err() != nil {
+		return
+	}
+	s.queued[repo] = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		_, err := s.run(repo, trigger)
+		if errors.Is(err, git.ErrRepoBusy) {
+			time.AfterFunc(retryDelay, func() {
+				s.schedule(repo, trigger)
+			})
+		}
+	}()
+}
+
+// Run maintains a repo right away, once fewer than the allowed number of
+// repos are being maintained, and returns the recorded run. It returns
+// git.ErrRepoBusy if the repo is being pushed to or maintained.
+func (s *Scheduler) Run(repo string) (*db.MaintenanceRun, error) {
+	s.mtx.Lock()
+	if s.queued[repo] {
+		s.mtx.Unlock()
+		return nil, fmt.Errorf("%w: %s", git.ErrRepoBusy, repo)
+	}
+	s.queued[repo] = true
+	s.mtx.Unlock()
+	return s.run(repo, "manual")
+}
+
+// run maintains a queued repo and records the run. Runs that didn't happen,
+// because the repo was busy or the scheduler stopped, aren't recorded.
+func (s *Scheduler) run(repo string, trigger string) (*db.MaintenanceRun, error) {
+	defer func() {
+		s.mtx.Lock()
+		delete(s.queued, repo)
+		s.mtx.Unlock()
+	}()
+	if !s.acquire() {
+		return nil, s.ctx.Err()
+	}
+	defer s.release()
+	r := &db.MaintenanceRun{
+		Repo:      repo,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+	}
+	if gr, err := s.cfg.Source.GetRepo(repo); err == nil {
+		r.SizeBefore = gr.Size
+	}
+	err := s.cfg.Source.Maintain(s.ctx, repo)
+	if errors.Is(err, git.ErrRepoBusy) || s.ctx.Err() != nil {
+		return nil, err
+	}
+	r.Duration = time.Since(r.StartedAt)
+	if gr, err := s.cfg.Source.GetRepo(repo); err == nil {
+		r.SizeAfter = gr.Size
+	}
+	s.mtx.Lock()
+	delete(s.pushes, repo)
+	s.mtx.Unlock()
+	if err != nil {
+		r.Error = err.Error()
+		log.Printf("error maintaining %s: %s", repo, err)
+	} else {
+		log.Printf("Maintained %s (%s) in %s", repo, trigger, r.Duration.Round(time.Millisecond))
+	}
+	perr := s.cfg.DB.PutMaintenanceRun(r)
+	if perr != nil {
+		log.Printf("error recording the maintenance of %s: %s", repo, perr)
+	}
+	return r, err
+}
+
+// acquire waits until fewer than the allowed number of repos are being
+// maintained and takes a slot. It returns false if the scheduler stopped.
+func (s *Scheduler) acquire() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for s.running >= s.cfg.MaintenanceSettings().Concurrency {
+		if s.ctx.Err() != nil {
+			return false
+		}
+		s.cond.Wait()
+	}
+	if s.ctx.Err() != nil {
+		return false
+	}
+	s.running++
+	return true
+}
+
+func (s *Scheduler) release() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.running--
+	s.cond.Broadcast()
+}
+
+// Pushes returns the number of pushes to a repo since it was last maintained.
+// Pushes aren't counted across restarts.
+func (s *Scheduler) Pushes(repo string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.pushes[repo]
+}
+
+// Scheduled reports whether a repo is waiting to be maintained or being
+// maintained.
+func (s *Scheduler) Scheduled(repo string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.queued[repo]
+}
@@ -0,0 +1,81 @@
+// Package push serves git pushes over SSH. It takes over git-receive-pack
+// from the wish git middleware, so that the hooks run by git know the storage
+// quotas that apply to the push, and holds the locks of the repos while the
+// wish git middleware serves fetches.
+package push
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/maintenance"
+	"github.com/charmbracelet/wish"
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/gliderlabs/ssh"
+)
+
+// Middleware handles git-receive-pack sessions. Like the wish git middleware,
+// it creates repos on their first push and calls cfg.Push once a push is
+// received. Pushes are counted towards the maintenance of the repo by ms.
+// Fetches are passed on to the next handler holding the read lock of the
+// repo, so that they don't run while it's maintained. Other sessions are
+// passed on as they are.
+func Middleware(cfg *config.Config, ms *maintenance.Scheduler) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			args := s.Command()
+			if len(args) != 2 {
+				sh(s)
+				return
+			}
+			repo := strings.TrimPrefix(args[1], "/")
+			switch args[0] {
+			case "git-receive-pack":
+				receivePack(cfg, ms, s, repo)
+			case "git-upload-pack", "git-upload-archive":
+				if git.ValidRepoName(repo) {
+					unlock := cfg.Source.Locks.Lock(repo, git.ReadLock)
+					defer unlock()
+				}
+				sh(s)
+			default:
+				sh(s)
+			}
+		}
+	}
+}
+
+func receivePack(cfg *config.Config, ms *maintenance.Scheduler, s ssh.Session, repo string) {
+	pk := s.PublicKey()
+	if !git.ValidRepoName(repo) || cfg.AuthRepo(repo, pk) < gm.ReadWriteAccess {
+		FatalGit(s, gm.ErrNotAuthed)
+		return
+	}
+	l, err := cfg.QuotaLimits(repo, cfg.UserName(pk))
+	if err != nil {
+		log.Printf("error computing the quotas of %s: %s", repo, err)
+		FatalGit(s, gm.ErrSystemMalfunction)
+		return
+	}
+	us, err := cfg.Source.ReceivePack(s.Context(), repo, s, l.Env())
+	if err != nil {
+		log.Printf("error receiving push to %s: %s", repo, err)
+		FatalGit(s, gm.ErrSystemMalfunction)
+		return
+	}
+	cfg.Pushed(repo, pk, us)
+	ms.Pushed(repo)
+	_ = s.Exit(0)
+}
+
+// FatalGit writes an error to a git client as a packet line and ends the
+// session, the same way the wish git middleware does.
+func FatalGit(s ssh.Session, err error) {
+	// The length includes the 4 bytes of the length prefix and the newline.
+	msg := err.Error()
+	fmt.Fprintf(s, "%04x%s\n", len(msg)+5, msg)
+	_ = s.Exit(1)
+}
@@ -0,0 +1,467 @@
+// Package search finds text in the files of the default branch of the repos.
+// Files are looked up in a trigram index first, so that only the files that
+// can match are read. The index of a repo is updated with the blobs a push
+// adds rather than rebuilt, in the background so that pushes don't wait for
+// it.
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	// indexDir is the directory, relative to the RepoSource path, where the
+	// indexes of the repos are persisted.
+	indexDir = ".search"
+	// indexVersion is bumped whenever the on-disk format changes. Indexes
+	// with another version are rebuilt.
+	indexVersion = 2
+	// indexExt is the extension of the index files. Indexes used to be
+	// stored as JSON, in files with the .json extension.
+	indexExt = ".idx"
+	// maxFileSize is the size of the largest file that's indexed.
+	maxFileSize = 1 << 20
+	// binarySniffSize is how far into a file NUL bytes are looked for to
+	// tell binary files, which aren't indexed, from text.
+	binarySniffSize = 8000
+)
+
+// Index is the trigram index of the default branch of every repo of a
+// RepoSource.
+type Index struct {
+	rs *git.RepoSource
+	// mtx guards repos, whose indexes are replaced rather than changed so
+	// that searches can use them unlocked.
+	mtx   sync.RWMutex
+	repos map[string]*repoIndex
+	// qmtx guards queued, which holds the repos being updated, each mapped to
+	// whether it was scheduled again since. sem bounds the number of updates
+	// running at once, and wg tracks the goroutines running them.
+	qmtx   sync.Mutex
+	queued map[string]bool
+	sem    chan struct{}
+	wg     sync.WaitGroup
+}
+
+// repoIndex is the index of the default branch of a repo.
+type repoIndex struct {
+	Version int
+	// Commit is the commit of the default branch that was indexed, empty if
+	// the repo has no commits.
+	Commit string
+	// Files maps the paths of the indexed files to their blob.
+	Files map[string]string
+	// Trigrams are the trigrams of each blob, sorted. They're stored
+	// delta-encoded, see encodeTrigrams.
+	Trigrams map[string][]uint32
+
+	// blobs are the blobs in Trigrams, sorted, and postings the blobs each
+	// trigram is in, as sorted positions in blobs. paths are the paths of
+	// each blob, sorted.
+	blobs    []string
+	postings map[uint32][]int
+	paths    [][]string
+}
+
+// NewIndex returns the index of the repos of rs, as it was persisted. Repos
+// that were never indexed are only searched once they're scheduled.
+func NewIndex(rs *git.RepoSource) (*Index, error) {
+	ix := &Index{
+		rs:     rs,
+		repos:  make(map[string]*repoIndex),
+		queued: make(map[string]bool),
+		sem:    make(chan struct{}, runtime.NumCPU()),
+	}
+	err := os.MkdirAll(ix.dir(), 0700)
+	if err != nil {
+		return nil, err
+	}
+	des, err := os.ReadDir(ix.dir())
+	if err != nil {
+		return nil, err
+	}
+	for _, de := range des {
+		if !de.IsDir() && strings.HasSuffix(de.Name(), ".json") {
+			// The JSON indexes are stale, their repos are indexed again
+			// by UpdateAll.
+			err = os.Remove(filepath.Join(ix.dir(), de.Name()))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		name := strings.TrimSuffix(de.Name(), indexExt)
+		if de.IsDir() || name == de.Name() {
+			continue
+		}
+		ri, err := readRepoIndex(ix.path(name))
+		if err != nil {
+			log.Printf("error reading the search index of %s, it will be rebuilt: %s", name, err)
+			continue
+		}
+		ix.repos[name] = ri
+	}
+	return ix, nil
+}
+
+func (ix *Index) dir() string {
+	return filepath.Join(ix.rs.Path, indexDir)
+}
+
+func (ix *Index) path(repo string) string {
+	return filepath.Join(ix.dir(), repo+indexExt)
+}
+
+// UpdateAll schedules the update of every repo, and of the indexes of the
+// repos that are gone, which are dropped.
+func (ix *Index) UpdateAll() {
+	seen := make(map[string]struct{})
+	for _, r := range ix.rs.AllRepos() {
+		seen[r.Name] = struct{}{}
+		ix.Schedule(r.Name)
+	}
+	ix.mtx.RLock()
+	gone := make([]string, 0)
+	for n := range ix.repos {
+		if _, ok := seen[n]; !ok {
+			gone = append(gone, n)
+		}
+	}
+	ix.mtx.RUnlock()
+	for _, n := range gone {
+		ix.Schedule(n)
+	}
+}
+
+// Schedule updates the index of a repo in the background, or drops it if the
+// repo is gone. A repo is only updated by one goroutine at a time: if it's
+// scheduled while it's being updated, it's updated once more afterwards, for
+// all the times it was scheduled in the meantime.
+func (ix *Index) Schedule(repo string) {
+	ix.qmtx.Lock()
+	defer ix.qmtx.Unlock()
+	if _, ok := ix.queued[repo]; ok {
+		ix.queued[repo] = true
+		return
+	}
+	ix.queued[repo] = false
+	ix.wg.Add(1)
+	go ix.run(repo)
+}
+
+// Wait waits until the scheduled updates are done.
+func (ix *Index) Wait() {
+	ix.wg.Wait()
+}
+
+// run updates a repo until it isn't scheduled again.
+func (ix *Index) run(repo string) {
+	defer ix.wg.Done()
+	for {
+		ix.sem <- struct{}{}
+		err := ix.update(repo)
+		<-ix.sem
+		if err != nil {
+			log.Printf("error updating the search index of %s: %s", repo, err)
+		}
+		ix.qmtx.Lock()
+		if !ix.queued[repo] {
+			delete(ix.queued, repo)
+			ix.qmtx.Unlock()
+			return
+		}
+		ix.queued[repo] = false
+		ix.qmtx.Unlock()
+	}
+}
+
+// update indexes the default branch of a repo, or drops its index if it's
+// gone. Only the blobs that weren't in the previous index of the repo are
+// read.
+func (ix *Index) update(repo string) error {
+	r, err := ix.rs.GetRepo(repo)
+	if err == git.ErrMissingRepo {
+		return ix.remove(repo)
+	}
+	if err != nil {
+		return err
+	}
+	ix.mtx.RLock()
+	prev := ix.repos[repo]
+	ix.mtx.RUnlock()
+	ri := &repoIndex{
+		Version:  indexVersion,
+		Files:    make(map[string]string),
+		Trigrams: make(map[string][]uint32),
+	}
+	head, err := r.Repository.Head()
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return err
+	}
+	if head != nil {
+		ri.Commit = head.Hash().String()
+	}
+	if prev != nil && prev.Commit == ri.Commit {
+		return nil
+	}
+	if head != nil {
+		c, err := r.Repository.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		t, err := c.Tree()
+		if err != nil {
+			return err
+		}
+		err = t.Files().ForEach(func(f *object.File) error {
+			if f.Mode == filemode.Symlink || f.Size > maxFileSize {
+				return nil
+			}
+			h := f.Hash.String()
+			if _, ok := ri.Trigrams[h]; ok {
+				ri.Files[f.Name] = h
+				return nil
+			}
+			if prev != nil {
+				if ts, ok := prev.Trigrams[h]; ok {
+					ri.Files[f.Name] = h
+					ri.Trigrams[h] = ts
+					return nil
+				}
+			}
+			data, err := readBlob(&f.Blob)
+			if err != nil {
+				return err
+			}
+			if isBinary(data) {
+				return nil
+			}
+			ri.Files[f.Name] = h
+			ri.Trigrams[h] = trigrams(data)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	ri.build()
+	err = ri.write(ix.path(repo))
+	if err != nil {
+		return err
+	}
+	ix.mtx.Lock()
+	ix.repos[repo] = ri
+	ix.mtx.Unlock()
+	return nil
+}
+
+// remove drops the index of a repo.
+func (ix *Index) remove(repo string) error {
+	ix.mtx.Lock()
+	delete(ix.repos, repo)
+	ix.mtx.Unlock()
+	err := os.Remove(ix.path(repo))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// build sets up the postings of the index from its trigrams.
+func (ri *repoIndex) build() {
+	ri.blobs = make([]string, 0, len(ri.Trigrams))
+	for h := range ri.Trigrams {
+		ri.blobs = append(ri.blobs, h)
+	}
+	sort.Strings(ri.blobs)
+	pos := make(map[string]int, len(ri.blobs))
+	ri.postings = make(map[uint32][]int)
+	for i, h := range ri.blobs {
+		pos[h] = i
+		for _, t := range ri.Trigrams[h] {
+			ri.postings[t] = append(ri.postings[t], i)
+		}
+	}
+	ri.paths = make([][]string, len(ri.blobs))
+	for p, h := range ri.Files {
+		i := pos[h]
+		ri.paths[i] = append(ri.paths[i], p)
+	}
+	for _, ps := range ri.paths {
+		sort.Strings(ps)
+	}
+}
+
+// diskIndex is a repoIndex as it's stored: gob-encoded and gzipped, with the
+// trigrams of each blob delta-encoded.
+type diskIndex struct {
+	Version  int
+	Commit   string
+	Files    map[string]string
+	Trigrams map[string][]byte
+}
+
+func readRepoIndex(path string) (*repoIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint: errcheck
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	di := &diskIndex{}
+	err = gob.NewDecoder(zr).Decode(di)
+	if err != nil {
+		return nil, err
+	}
+	if di.Version != indexVersion {
+		return nil, errors.New("outdated index")
+	}
+	ri := &repoIndex{
+		Version:  di.Version,
+		Commit:   di.Commit,
+		Files:    di.Files,
+		Trigrams: make(map[string][]uint32, len(di.Trigrams)),
+	}
+	for h, b := range di.Trigrams {
+		ri.Trigrams[h], err = decodeTrigrams(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ri.build()
+	return ri, nil
+}
+
+func (ri *repoIndex) write(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	di := &diskIndex{
+		Version:  ri.Version,
+		Commit:   ri.Commit,
+		Files:    ri.Files,
+		Trigrams: make(map[string][]byte, len(ri.Trigrams)),
+	}
+	for h, ts := range ri.Trigrams {
+		di.Trigrams[h] = encodeTrigrams(ts)
+	}
+	bw := bufio.NewWriter(f)
+	zw := gzip.NewWriter(bw)
+	err = gob.NewEncoder(zw).Encode(di)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// encodeTrigrams encodes sorted trigrams as the varints of the differences
+// between them, which mostly take a byte or two.
+func encodeTrigrams(ts []uint32) []byte {
+	b := make([]byte, 0, len(ts)*2)
+	var buf [binary.MaxVarintLen32]byte
+	var last uint32
+	for _, t := range ts {
+		n := binary.PutUvarint(buf[:], uint64(t-last))
+		b = append(b, buf[:n]...)
+		last = t
+	}
+	return b
+}
+
+// decodeTrigrams decodes trigrams encoded by encodeTrigrams.
+func decodeTrigrams(b []byte) ([]uint32, error) {
+	ts := make([]uint32, 0, len(b))
+	var last uint32
+	for len(b) > 0 {
+		d, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("corrupt trigrams")
+		}
+		last += uint32(d)
+		ts = append(ts, last)
+		b = b[n:]
+	}
+	return ts, nil
+}
+
+func readBlob(b *object.Blob) ([]byte, error) {
+	rd, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close() // nolint: errcheck
+	return io.ReadAll(rd)
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffSize {
+		data = data[:binarySniffSize]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// trigrams returns the trigrams of a text, sorted. Trigrams are folded to
+// lower case, and those spanning lines are left out since matches don't.
+func trigrams(data []byte) []uint32 {
+	set := make(map[uint32]struct{})
+	for i := 0; i+3 <= len(data); i++ {
+		if data[i] == '\n' || data[i+1] == '\n' || data[i+2] == '\n' {
+			continue
+		}
+		set[trigram(data[i], data[i+1], data[i+2])] = struct{}{}
+	}
+	ts := make([]uint32, 0, len(set))
+	for t := range set {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i] < ts[j]
+	})
+	return ts
+}
+
+// trigram packs three bytes, folded to lower case, into a trigram.
+func trigram(a, b, c byte) uint32 {
+	return uint32(lower(a))<<16 | uint32(lower(b))<<8 | uint32(lower(c))
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,38 @@
+package search
+
+import "testing"
+
+func TestTrigrams(t *testing.T) {
+	got := trigramStrings(trigrams([]byte("AbCd\nabc")))
+	want := []string{"abc", "bcd"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got trigrams %q, want %q", got, want)
+	}
+}
+
+func TestEncodeTrigrams(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"ab",
+		"func main() {\n\tfmt.Println(\"hello\")\n}\n",
+		"\x00\x01\x02\xff\xfe\xfd",
+	} {
+		ts := trigrams([]byte(text))
+		got, err := decodeTrigrams(encodeTrigrams(ts))
+		if err != nil {
+			t.Fatalf("%q: %s", text, err)
+		}
+		if len(got) != len(ts) {
+			t.Fatalf("%q: got %d trigrams, want %d", text, len(got), len(ts))
+		}
+		for i := range ts {
+			if got[i] != ts[i] {
+				t.Fatalf("%q: got trigram %#x at %d, want %#x", text, got[i], i, ts[i])
+			}
+		}
+	}
+	_, err := decodeTrigrams([]byte{0x80})
+	if err == nil {
+		t.Error("decoding a truncated varint didn't fail")
+	}
+}
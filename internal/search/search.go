@@ -0,0 +1,275 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// defaultLimit is the number of matches returned when the Query has no limit.
+const defaultLimit = 100
+
+// ErrEmptyQuery is returned when the pattern of a Query is empty.
+var ErrEmptyQuery = errors.New("empty query")
+
+// Query is a search of the files of the repos.
+type Query struct {
+	// Pattern is the text looked for, or a regular expression if Regex is
+	// set. Text is matched case-sensitively.
+	Pattern string
+	Regex   bool
+	// Repo restricts the search to a repo, if set.
+	Repo string
+	// Limit is the number of matches returned, defaultLimit if 0.
+	Limit int
+}
+
+// Match is a line of a file matching a Query. Start and End are the byte
+// offsets of the first match in Text.
+type Match struct {
+	Repo  string
+	Path  string
+	Line  int
+	Text  string
+	Start int
+	End   int
+}
+
+// Results are the matches of a Query, sorted by repo, path and line. More is
+// set if there were more matches than the limit.
+type Results struct {
+	Matches []Match
+	More    bool
+}
+
+// Search returns the lines matching a Query in the repos readable reports
+// true for.
+func (ix *Index) Search(q Query, readable func(repo string) bool) (*Results, error) {
+	if q.Pattern == "" {
+		return nil, ErrEmptyQuery
+	}
+	expr := regexp.QuoteMeta(q.Pattern)
+	if q.Regex {
+		expr = q.Pattern
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	need, err := required(expr)
+	if err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	ix.mtx.RLock()
+	names := make([]string, 0, len(ix.repos))
+	repos := make(map[string]*repoIndex, len(ix.repos))
+	for n, ri := range ix.repos {
+		if (q.Repo == "" || q.Repo == n) && readable(n) {
+			names = append(names, n)
+			repos[n] = ri
+		}
+	}
+	ix.mtx.RUnlock()
+	sort.Strings(names)
+
+	res := &Results{Matches: make([]Match, 0)}
+	for _, n := range names {
+		ri := repos[n]
+		files := make([]file, 0)
+		for _, b := range ri.candidates(need) {
+			for _, p := range ri.paths[b] {
+				files = append(files, file{path: p, blob: ri.blobs[b]})
+			}
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].path < files[j].path
+		})
+		for _, f := range files {
+			ms, err := ix.grep(n, f, re)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range ms {
+				if len(res.Matches) == limit {
+					res.More = true
+					return res, nil
+				}
+				res.Matches = append(res.Matches, m)
+			}
+		}
+	}
+	return res, nil
+}
+
+// file is an indexed file, with its blob.
+type file struct {
+	path string
+	blob string
+}
+
+// grep returns the lines of a file matching re.
+func (ix *Index) grep(repo string, f file, re *regexp.Regexp) ([]Match, error) {
+	r, err := ix.rs.GetRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.Repository.BlobObject(plumbing.NewHash(f.blob))
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBlob(b)
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]Match, 0)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), maxFileSize)
+	for l := 1; sc.Scan(); l++ {
+		line := sc.Bytes()
+		loc := re.FindIndex(line)
+		if loc == nil {
+			continue
+		}
+		ms = append(ms, Match{
+			Repo:  repo,
+			Path:  f.path,
+			Line:  l,
+			Text:  string(line),
+			Start: loc[0],
+			End:   loc[1],
+		})
+	}
+	return ms, sc.Err()
+}
+
+// candidates returns the blobs holding every trigram of need, as positions
+// in blobs. Every blob is a candidate if need is empty.
+func (ri *repoIndex) candidates(need []uint32) []int {
+	if len(need) == 0 {
+		bs := make([]int, len(ri.blobs))
+		for i := range bs {
+			bs[i] = i
+		}
+		return bs
+	}
+	lists := make([][]int, 0, len(need))
+	for _, t := range need {
+		lists = append(lists, ri.postings[t])
+	}
+	// Intersecting the shortest lists first keeps the result small.
+	sort.Slice(lists, func(i, j int) bool {
+		return len(lists[i]) < len(lists[j])
+	})
+	bs := lists[0]
+	for _, l := range lists[1:] {
+		bs = intersect(bs, l)
+	}
+	return bs
+}
+
+func intersect(a, b []int) []int {
+	r := make([]int, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			r = append(r, a[i])
+			i++
+			j++
+		}
+	}
+	return r
+}
+
+// required returns the trigrams a line must hold to match a regular
+// expression. They come from the literals every match contains, so the
+// result may have less trigrams than it could, but never trigrams a match
+// may lack.
+func required(expr string) ([]uint32, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[uint32]struct{})
+	for _, lit := range literals(re.Simplify()) {
+		for i := 0; i+3 <= len(lit); i++ {
+			set[trigram(lit[i], lit[i+1], lit[i+2])] = struct{}{}
+		}
+	}
+	ts := make([]uint32, 0, len(set))
+	for t := range set {
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// literals returns the strings every match of re contains. Case-insensitive
+// literals are left out unless they only fold to ASCII, since the trigrams
+// only fold ASCII letters.
+func literals(re *syntax.Regexp) [][]byte {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 && !foldsToASCII(re.Rune) {
+			return nil
+		}
+		return [][]byte{runesToBytes(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return literals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return literals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		lits := make([][]byte, 0)
+		// Adjacent literals are joined, so that trigrams spanning them are
+		// required too.
+		var run []byte
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral &&
+				(sub.Flags&syntax.FoldCase == 0 || foldsToASCII(sub.Rune)) {
+				run = append(run, runesToBytes(sub.Rune)...)
+				continue
+			}
+			if run != nil {
+				lits = append(lits, run)
+				run = nil
+			}
+			lits = append(lits, literals(sub)...)
+		}
+		if run != nil {
+			lits = append(lits, run)
+		}
+		return lits
+	}
+	return nil
+}
+
+// foldsToASCII reports whether the runes only match ASCII text when case is
+// ignored. K and S don't, as they also match the Kelvin and long s signs.
+func foldsToASCII(rs []rune) bool {
+	for _, r := range rs {
+		if r >= utf8.RuneSelf || strings.ContainsRune("KkSs", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func runesToBytes(rs []rune) []byte {
+	return []byte(string(rs))
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// trigramStrings returns trigrams as sorted strings.
+func trigramStrings(ts []uint32) []string {
+	ss := make([]string, 0, len(ts))
+	for _, t := range ts {
+		ss = append(ss, string([]byte{byte(t >> 16), byte(t >> 8), byte(t)}))
+	}
+	sort.Strings(ss)
+	return ss
+}
+
+func TestRequired(t *testing.T) {
+	cases := []struct {
+		expr    string
+		matches []string
+		want    []string
+	}{
+		{"hello", []string{"say hello"}, []string{"ell", "hel", "llo"}},
+		{"(?i)HeLLo", []string{"HELLO world", "hello"}, []string{"ell", "hel", "llo"}},
+		{"foo(bar)+baz", []string{"foobarbarbaz"}, []string{"bar", "baz", "foo"}},
+		{"x*abcd", []string{"abcd", "xxabcd"}, []string{"abc", "bcd"}},
+		{"abc|def", []string{"abc", "def"}, []string{}},
+		{"ab", []string{"ab"}, []string{}},
+		{"(?i)kelvin", []string{"Kelvin", "KELVIN"}, []string{}},
+		{"(?i)ssh", []string{"ſsh", "SSH"}, []string{}},
+		{"(?i)ab(?-i)kelvin", []string{"ABkelvin"}, []string{"abk", "bke", "elv", "kel", "lvi", "vin"}},
+	}
+	for _, c := range cases {
+		ts, err := required(c.expr)
+		if err != nil {
+			t.Fatalf("%q: %s", c.expr, err)
+		}
+		got := trigramStrings(ts)
+		if len(got) != len(c.want) {
+			t.Errorf("%q: got trigrams %q, want %q", c.expr, got, c.want)
+		} else {
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Errorf("%q: got trigrams %q, want %q", c.expr, got, c.want)
+					break
+				}
+			}
+		}
+		re := regexp.MustCompile(c.expr)
+		for _, m := range c.matches {
+			if !re.MatchString(m) {
+				t.Fatalf("%q doesn't match %q", c.expr, m)
+			}
+			have := make(map[uint32]bool)
+			for _, t := range trigrams([]byte(m)) {
+				have[t] = true
+			}
+			for _, r := range ts {
+				if !have[r] {
+					t.Errorf("%q: match %q lacks required trigram %q", c.expr, m, trigramStrings([]uint32{r}))
+				}
+			}
+		}
+	}
+}
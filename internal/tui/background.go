@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/soft-serve/internal/config"
+)
+
+// backgroundTimeout is how long the terminal of a client has to tell its
+// background color.
+const backgroundTimeout = 2 * time.Second
+
+var (
+	// oscBackground is the answer to an OSC 11 query, with the red, green
+	// and blue of the background in 1 to 4 hex digits, terminated by BEL or
+	// ST.
+	oscBackground = regexp.MustCompile(`\x1b\]11;rgb:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})(?:\x07|\x1b\\)`)
+	// deviceAttributes is the answer to a primary device attributes query.
+	deviceAttributes = regexp.MustCompile(`\x1b\[\?[0-9;]*c`)
+)
+
+// sessionInput reads the input of a session in the background, so that
+// reading it can time out without losing what was read too late.
+type sessionInput struct {
+	c   chan []byte
+	err error
+	buf []byte
+}
+
+// newSessionInput starts reading r until it fails or ctx is done.
+func newSessionInput(ctx context.Context, r io.Reader) *sessionInput {
+	in := &sessionInput{c: make(chan []byte)}
+	go func() {
+		defer close(in.c)
+		for {
+			b := make([]byte, 256)
+			n, err := r.Read(b)
+			if n > 0 {
+				select {
+				case in.c <- b[:n]:
+				case <-ctx.Done():
+					in.err = io.EOF
+					return
+				}
+			}
+			if err != nil {
+				in.err = err
+				return
+			}
+		}
+	}()
+	return in
+}
+
+// Read implements io.Reader.
+func (in *sessionInput) Read(p []byte) (int, error) {
+	if len(in.buf) == 0 {
+		b, ok := <-in.c
+		if !ok {
+			return 0, in.err
+		}
+		in.buf = b
+	}
+	n := copy(p, in.buf)
+	in.buf = in.buf[n:]
+	return n, nil
+}
+
+// queryBackground asks the terminal of a client for its background color with
+// OSC 11, and returns the theme mode it fits, empty if the terminal didn't
+// tell. The query is followed by a device attributes query, which terminals
+// answer whether or not they know OSC 11, so that only terminals that don't
+// answer at all are waited for. What the client types meanwhile is kept in
+// in.
+func queryBackground(w io.Writer, in *sessionInput) string {
+	_, err := io.WriteString(w, "\x1b]11;?\x07\x1b[c")
+	if err != nil {
+		return ""
+	}
+	var got []byte
+	timeout := time.After(backgroundTimeout)
+wait:
+	for !deviceAttributes.Match(got) {
+		select {
+		case b, ok := <-in.c:
+			if !ok {
+				break wait
+			}
+			got = append(got, b...)
+		case <-timeout:
+			break wait
+		}
+	}
+	var mode string
+	if m := oscBackground.FindSubmatch(got); m != nil {
+		mode = backgroundMode(m[1], m[2], m[3])
+		got = bytes.Replace(got, m[0], nil, 1)
+	}
+	if loc := deviceAttributes.FindIndex(got); loc != nil {
+		got = append(got[:loc[0]], got[loc[1]:]...)
+	}
+	in.buf = got
+	return mode
+}
+
+// backgroundMode returns the theme mode of a background color, light if its
+// lightness is at least half.
+func backgroundMode(r, g, b []byte) string {
+	var min, max float64 = 1, 0
+	for _, c := range [][]byte{r, g, b} {
+		v, err := strconv.ParseUint(string(c), 16, 16)
+		if err != nil {
+			return ""
+		}
+		f := float64(v) / float64(uint64(1)<<(4*len(c))-1)
+		if f < min {
+			min = f
+		}
+		if f > max {
+			max = f
+		}
+	}
+	if (min+max)/2 >= 0.5 {
+		return config.ThemeLight
+	}
+	return config.ThemeDark
+}
+
+// colorFgBgMode returns the theme mode of the background in COLORFGBG, empty
+// if it isn't set. COLORFGBG is "fg;bg", or "fg;default;bg" in some
+// terminals, with the colors as ANSI color numbers. 7 and the bright colors
+// but 8 are light.
+func colorFgBgMode(env []string) string {
+	fgbg := strings.Split(getenv(env, "COLORFGBG"), ";")
+	bg, err := strconv.Atoi(fgbg[len(fgbg)-1])
+	if err != nil {
+		return ""
+	}
+	if bg == 7 || (bg > 8 && bg < 16) {
+		return config.ThemeLight
+	}
+	return config.ThemeDark
+}
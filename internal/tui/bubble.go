@@ -7,7 +7,10 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/events"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/activity"
 	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/repo"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/search"
 	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/selection"
 	"github.com/charmbracelet/soft-serve/internal/tui/style"
 	"github.com/gliderlabs/ssh"
@@ -28,6 +31,9 @@ type SessionConfig struct {
 	Height      int
 	InitialRepo string
 	Session     ssh.Session
+	// Background is the theme mode of the background of the terminal,
+	// empty if it's unknown.
+	Background string
 }
 
 type MenuEntry struct {
@@ -38,8 +44,12 @@ type MenuEntry struct {
 }
 
 type Bubble struct {
+	// config is a snapshot of live, taken again when it's reloaded.
 	config      *config.Config
+	live        *config.Config
+	events      *events.Subscription
 	styles      *style.Styles
+	background  string
 	state       sessionState
 	error       string
 	width       int
@@ -50,15 +60,24 @@ type Bubble struct {
 	activeBox   int
 	repoSelect  *selection.Bubble
 	session     ssh.Session
+	// activity and search are shown on the home screen.
+	activity *activity.Bubble
+	search   *search.Bubble
 
 	// remember the last resize so we can re-send it when selecting a different repo.
 	lastResize tea.WindowSizeMsg
 }
 
+// NewBubble returns the TUI of a session. It follows the changes of the repos
+// and of cfg until the session ends.
 func NewBubble(cfg *config.Config, sCfg *SessionConfig) *Bubble {
+	snap := cfg.Snapshot()
 	b := &Bubble{
-		config:      cfg,
-		styles:      style.DefaultStyles(),
+		config:      snap,
+		live:        cfg,
+		events:      cfg.Events.Subscribe(),
+		styles:      themeStyles(snap.Theme, sCfg.Session.Environ(), sCfg.Background),
+		background:  sCfg.Background,
 		width:       sCfg.Width,
 		height:      sCfg.Height,
 		repoMenu:    make([]MenuEntry, 0),
@@ -66,18 +85,27 @@ func NewBubble(cfg *config.Config, sCfg *SessionConfig) *Bubble {
 		initialRepo: sCfg.InitialRepo,
 		session:     sCfg.Session,
 	}
+	// The activity and search check access with the live config, so that
+	// they follow reloads.
+	b.activity = activity.NewBubble(cfg, sCfg.Session.PublicKey(), b.styles)
+	b.search = search.NewBubble(cfg, sCfg.Session.PublicKey(), b.styles)
 	b.state = startState
 	return b
 }
 
 func (b *Bubble) Init() tea.Cmd {
-	return b.setupCmd
+	return tea.Batch(b.setupCmd, b.activity.Init(), b.waitEvent)
 }
 
 func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	cmds := make([]tea.Cmd, 0)
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// While the menu is filtered or a search typed, keys but ctrl+c go
+		// to the box.
+		if b.typing() && msg.String() != "ctrl+c" {
+			break
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return b, tea.Quit
@@ -92,6 +120,21 @@ func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				b.activeBox++
 			}
 		}
+	case eventMsg:
+		for _, e := range msg {
+			if b.state != loadedState {
+				break
+			}
+			err := b.refresh(e)
+			if err != nil {
+				b.error = err.Error()
+				b.state = errorState
+			}
+		}
+		// The activity is refreshed after the config, so that it's rendered
+		// with the new theme.
+		b.activity.Update(activity.RefreshMsg{})
+		return b, b.waitEvent
 	case errMsg:
 		b.error = msg.Error()
 		b.state = errorState
@@ -101,6 +144,7 @@ func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		b.width = msg.Width
 		b.height = msg.Height
 		if b.state == loadedState {
+			b.repoSelect.SetHeight(b.menuHeight())
 			for i, bx := range b.boxes {
 				m, cmd := bx.Update(msg)
 				b.boxes[i] = m
@@ -114,6 +158,19 @@ func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		rb := b.repoMenu[msg.Index].bubble
 		rb.GotoTop()
 		b.boxes[1] = rb
+	case search.OpenMsg:
+		for i, me := range b.repoMenu {
+			// The config repo is in the menu of users who can't read it.
+			if me.Repo == msg.Repo && b.readable(me.Repo) {
+				b.repoSelect.Select(i)
+				b.activeBox = 1
+				b.boxes[1] = me.bubble
+				me.bubble.OpenFile(msg.Path, msg.Line)
+				cmds = append(cmds, func() tea.Msg {
+					return b.lastResize
+				})
+			}
+		}
 	case selection.ActiveMsg:
 		rb := b.repoMenu[msg.Index].bubble
 		rb.GotoTop()
@@ -132,6 +189,20 @@ func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return b, tea.Batch(cmds...)
 }
 
+// typing reports whether the active box is being typed into.
+func (b *Bubble) typing() bool {
+	if b.state != loadedState {
+		return false
+	}
+	switch box := b.boxes[b.activeBox].(type) {
+	case *selection.Bubble:
+		return box.Filtering()
+	case *repo.Bubble:
+		return box.Typing()
+	}
+	return false
+}
+
 func (b *Bubble) viewForBox(i int) string {
 	isActive := i == b.activeBox
 	switch box := b.boxes[i].(type) {
@@ -152,6 +223,15 @@ func (b *Bubble) viewForBox(i int) string {
 	}
 }
 
+// menuHeight is the number of lines the menu has for the repos.
+func (b Bubble) menuHeight() int {
+	return b.height -
+		b.styles.App.GetVerticalFrameSize() -
+		lipgloss.Height(b.headerView()) -
+		lipgloss.Height(b.footerView()) -
+		b.styles.Menu.GetVerticalFrameSize()
+}
+
 func (b Bubble) headerView() string {
 	w := b.width - b.styles.App.GetHorizontalFrameSize()
 	name := ""
@@ -162,7 +242,6 @@ func (b Bubble) headerView() string {
 }
 
 func (b Bubble) footerView() string {
-	w := &strings.Builder{}
 	var h []helpEntry
 	switch b.state {
 	case errorState:
@@ -173,17 +252,38 @@ func (b Bubble) footerView() string {
 			{"↑/↓", "navigate"},
 			{"q", "quit"},
 		}
-		if _, ok := b.boxes[b.activeBox].(*repo.Bubble); ok {
-			h = append(h[:2], helpEntry{"f/b", "pgdown/pgup"}, h[2])
+		var bh []selection.HelpEntry
+		switch box := b.boxes[b.activeBox].(type) {
+		case *repo.Bubble:
+			bh = box.Help()
+		case *selection.Bubble:
+			bh = box.Help()
 		}
+		if len(bh) > 0 {
+			rh := make([]helpEntry, 0)
+			for _, e := range bh {
+				rh = append(rh, helpEntry{e.Key, e.Value})
+			}
+			h = append(append(h[:2], rh...), h[2])
+		}
+	}
+	// Leave out the entries before quit that don't fit on one line.
+	max := b.width - b.styles.App.GetHorizontalFrameSize()
+	for len(h) > 1 && lipgloss.Width(b.helpView(h)) > max {
+		h = append(h[:len(h)-2], h[len(h)-1])
 	}
+	return b.styles.Footer.Copy().Width(b.width).Render(b.helpView(h))
+}
+
+func (b Bubble) helpView(h []helpEntry) string {
+	w := &strings.Builder{}
 	for i, v := range h {
 		fmt.Fprint(w, v.Render(b.styles))
 		if i != len(h)-1 {
 			fmt.Fprint(w, b.styles.HelpDivider)
 		}
 	}
-	return b.styles.Footer.Copy().Width(b.width).Render(w.String())
+	return w.String()
 }
 
 func (b Bubble) errorView() string {
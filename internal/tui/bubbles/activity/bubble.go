@@ -0,0 +1,208 @@
+package activity
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/db"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	gm "github.com/charmbracelet/wish/git"
+	"github.com/dustin/go-humanize"
+	"github.com/gliderlabs/ssh"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/muesli/reflow/truncate"
+)
+
+const (
+	// maxEntries is the number of pushes, or commits, shown.
+	maxEntries = 50
+	// hashLength is the length of the abbreviated commit hashes.
+	hashLength = 7
+)
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry = tree.HelpEntry
+
+// RefreshMsg tells the Bubble to read the activity again, after a push or a
+// reload.
+type RefreshMsg struct{}
+
+// Bubble shows the latest pushes to the repos the user can read. Until
+// anything is pushed, it shows the latest commits of the repos instead.
+type Bubble struct {
+	cfg    *config.Config
+	pk     ssh.PublicKey
+	styles *style.Styles
+	width  int
+	height int
+	pushes []*db.Push
+	// commits are shown if there are no pushes.
+	commits []git.RepoCommit
+	lines   []string
+	offset  int
+	err     error
+}
+
+// NewBubble returns a Bubble showing the activity of the repos the given key
+// can read.
+func NewBubble(cfg *config.Config, pk ssh.PublicKey, styles *style.Styles) *Bubble {
+	return &Bubble{
+		cfg:    cfg,
+		pk:     pk,
+		styles: styles,
+	}
+}
+
+func (b *Bubble) Init() tea.Cmd {
+	b.load()
+	return nil
+}
+
+// SetSize sets the size of the area the activity is shown in.
+func (b *Bubble) SetSize(w, h int) {
+	b.width = w - b.styles.Tree.GetHorizontalFrameSize()
+	b.height = h - b.styles.Tree.GetVerticalFrameSize()
+	b.render()
+}
+
+// Help returns the key bindings of the activity.
+func (b *Bubble) Help() []HelpEntry {
+	return []HelpEntry{{Key: "f/b", Value: "pgdown/pgup"}}
+}
+
+func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case RefreshMsg:
+		b.load()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "k", "up":
+			b.scroll(-1)
+		case "j", "down":
+			b.scroll(1)
+		case "b", "pgup":
+			b.scroll(-b.height)
+		case "f", "pgdown":
+			b.scroll(b.height)
+		case "g", "home":
+			b.scroll(-len(b.lines))
+		case "G", "end":
+			b.scroll(len(b.lines))
+		}
+	}
+	return b, nil
+}
+
+// load reads the activity.
+func (b *Bubble) load() {
+	b.pushes, b.err = b.cfg.Pushes(maxEntries, b.pk)
+	b.commits = nil
+	if b.err == nil && len(b.pushes) == 0 {
+		for _, rc := range b.cfg.Source.GetCommits(maxEntries) {
+			if b.cfg.AuthRepo(rc.Name, b.pk) >= gm.ReadOnlyAccess {
+				b.commits = append(b.commits, rc)
+			}
+		}
+	}
+	b.render()
+}
+
+func (b *Bubble) scroll(n int) {
+	b.offset += n
+	if b.offset > len(b.lines)-b.height {
+		b.offset = len(b.lines) - b.height
+	}
+	if b.offset < 0 {
+		b.offset = 0
+	}
+}
+
+// render lays out the activity for the width of the view.
+func (b *Bubble) render() {
+	var ls []string
+	switch {
+	case b.err != nil:
+		ls = []string{b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", b.err))}
+	case len(b.pushes) > 0:
+		for i, p := range b.pushes {
+			if i > 0 {
+				ls = append(ls, "")
+			}
+			ls = append(ls, b.pushLines(p)...)
+		}
+	case len(b.commits) > 0:
+		ls = append(ls, b.styles.TreeNote.Render("Nothing was pushed yet. These are the latest commits:"), "")
+		for _, rc := range b.commits {
+			ls = append(ls, b.commitLine(rc))
+		}
+	default:
+		ls = []string{b.styles.TreeNote.Render("Nothing was pushed yet.")}
+	}
+	for i, l := range ls {
+		ls[i] = truncate.String(l, uint(b.width))
+	}
+	b.lines = ls
+	b.scroll(0)
+}
+
+// pushLines renders a push: the repo, ref, pusher and date, and the commits it
+// added.
+func (b *Bubble) pushLines(p *db.Push) []string {
+	title := b.styles.TreeDir.Render(p.Repo) + " " +
+		b.styles.BreadcrumbRef.Render(plumbing.ReferenceName(p.Ref).Short()) + " " +
+		b.styles.LogAuthor.Render(p.Pusher)
+	when := b.styles.LogDate.Render(humanize.Time(p.CreatedAt))
+	pad := b.width - lipgloss.Width(title) - lipgloss.Width(when)
+	if pad < 1 {
+		pad = 1
+	}
+	ls := []string{title + strings.Repeat(" ", pad) + when}
+	switch {
+	case p.New == "":
+		ls = append(ls, "  "+b.styles.TreeNote.Render("deleted"))
+	case p.Total == 0 && p.Old == "":
+		ls = append(ls, "  "+b.styles.TreeNote.Render("created at ")+b.styles.LogHash.Render(p.New[:hashLength]))
+	case p.Total == 0:
+		ls = append(ls, "  "+b.styles.TreeNote.Render("moved to ")+b.styles.LogHash.Render(p.New[:hashLength]))
+	}
+	for _, c := range p.Commits {
+		ls = append(ls, "  "+b.styles.LogHash.Render(c.Hash[:hashLength])+" "+tree.Sanitize(c.Subject))
+	}
+	if more := p.Total - len(p.Commits); more > 0 {
+		commits := "commits"
+		if more == 1 {
+			commits = "commit"
+		}
+		ls = append(ls, "  "+b.styles.TreeNote.Render(fmt.Sprintf("and %d more %s", more, commits)))
+	}
+	return ls
+}
+
+// commitLine renders a commit of a repo.
+func (b *Bubble) commitLine(rc git.RepoCommit) string {
+	c := rc.Commit
+	subject := strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0]
+	l := b.styles.TreeDir.Render(rc.Name) + " " +
+		b.styles.LogHash.Render(c.Hash.String()[:hashLength]) + " " +
+		tree.Sanitize(subject) + " " +
+		b.styles.LogAuthor.Render(c.Author.Name)
+	when := b.styles.LogDate.Render(humanize.Time(c.Author.When))
+	pad := b.width - lipgloss.Width(l) - lipgloss.Width(when)
+	if pad < 1 {
+		pad = 1
+	}
+	return l + strings.Repeat(" ", pad) + when
+}
+
+func (b *Bubble) View() string {
+	end := b.offset + b.height
+	if end > len(b.lines) {
+		end = len(b.lines)
+	}
+	return b.styles.Tree.Render(strings.Join(b.lines[b.offset:end], "\n"))
+}
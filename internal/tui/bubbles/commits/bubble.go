@@ -1,67 +1,243 @@
 package commits
 
 import (
+	"fmt"
 	"strings"
 
-	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
 	"github.com/dustin/go-humanize"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/muesli/reflow/truncate"
 )
 
+const (
+	// pageSize is the number of commits read from the history at a time.
+	pageSize = 50
+	// hashLength is the length of the abbreviated commit hashes.
+	hashLength = 7
+	// authorMaxWidth is the widest an author name is shown in the list.
+	authorMaxWidth = 20
+)
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry = tree.HelpEntry
+
+// Bubble shows the history of a ref, newest commits first. Commits are read
+// a page at a time as the cursor gets close to the last one read, and a
+// commit is shown with its diff once it's opened.
 type Bubble struct {
-	Commits  []git.RepoCommit
-	Height   int
-	Width    int
-	viewport viewport.Model
+	repo    *git.Repo
+	ref     string
+	styles  *style.Styles
+	width   int
+	height  int
+	log     *git.Log
+	commits []*object.Commit
+	cursor  int
+	offset  int
+	// commit is the open commit, if any.
+	commit *commitView
+	// split shows the diffs side by side on wide terminals.
+	split bool
+	err   error
 }
 
-func NewBubble(height int, width int, rcs []git.RepoCommit) *Bubble {
+// NewBubble returns a Bubble showing the history of a ref, such as
+// refs/heads/main.
+func NewBubble(repo *git.Repo, ref string, styles *style.Styles, width, height int) *Bubble {
 	b := &Bubble{
-		Commits:  rcs,
-		viewport: viewport.Model{Height: height, Width: width},
+		repo:   repo,
+		ref:    ref,
+		styles: styles,
+		split:  true,
 	}
-	s := ""
-	for _, rc := range rcs {
-		s += b.renderCommit(rc) + "\n"
-	}
-	b.viewport.SetContent(s)
+	b.SetSize(width, height)
 	return b
 }
 
 func (b *Bubble) Init() tea.Cmd {
+	b.log, b.err = b.repo.Log(b.ref)
+	if b.err == nil {
+		b.load()
+	}
 	return nil
 }
 
+// SetSize sets the size of the area the history is shown in.
+func (b *Bubble) SetSize(w, h int) {
+	b.width = w - b.styles.Tree.GetHorizontalFrameSize()
+	b.height = h - b.styles.Tree.GetVerticalFrameSize()
+	if b.commit != nil {
+		b.commit.setSize(b.width, b.listHeight())
+	}
+	b.scroll()
+}
+
+// Help returns the key bindings of the current view.
+func (b *Bubble) Help() []HelpEntry {
+	if b.commit != nil {
+		return b.commit.help()
+	}
+	return []HelpEntry{{Key: "enter", Value: "open"}, {Key: "f/b", Value: "pgdown/pgup"}}
+}
+
 func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	cmds := make([]tea.Cmd, 0)
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if b.commit != nil {
+			if ok, cmd := b.commit.update(msg); ok {
+				return b, cmd
+			}
+			switch msg.String() {
+			case "esc", "backspace", "-":
+				b.commit = nil
+			case "s":
+				b.split = !b.split
+				b.commit.setSplit(b.split)
+			}
+			return b, nil
+		}
 		switch msg.String() {
-		case "up", "k":
-			b.viewport.LineUp(1)
-		case "down", "j":
-			b.viewport.LineDown(1)
+		case "k", "up":
+			b.move(-1)
+		case "j", "down":
+			b.move(1)
+		case "b", "pgup":
+			b.move(-b.listHeight())
+		case "f", "pgdown":
+			b.move(b.listHeight())
+		case "g", "home":
+			b.move(-len(b.commits))
+		case "G", "end":
+			// Like less, going to the end reads the rest of the history.
+			for b.err == nil && !b.log.Done() {
+				b.load()
+			}
+			b.move(len(b.commits))
+		case "enter", "l", "right":
+			b.open()
 		}
 	}
-	return b, tea.Batch(cmds...)
+	return b, nil
+}
+
+// load reads the next page of the history.
+func (b *Bubble) load() {
+	cs, err := b.log.Next(pageSize)
+	b.commits = append(b.commits, cs...)
+	if err != nil {
+		b.err = err
+	}
+}
+
+func (b *Bubble) move(n int) {
+	b.cursor += n
+	// Read more of the history before the cursor reaches the end of what's
+	// been read, so that the list never looks shorter than it is.
+	for b.err == nil && !b.log.Done() && b.cursor+b.listHeight() >= len(b.commits) {
+		b.load()
+	}
+	if b.cursor >= len(b.commits) {
+		b.cursor = len(b.commits) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	b.scroll()
 }
 
-func (b *Bubble) renderCommit(rc git.RepoCommit) string {
-	s := ""
-	s += commitRepoNameStyle.Render(rc.Name)
-	s += " "
-	s += commitDateStyle.Render(humanize.Time(rc.Commit.Author.When))
-	s += "\n"
-	s += commitCommentStyle.Render(strings.TrimSpace(rc.Commit.Message))
-	s += "\n"
-	s += commitAuthorStyle.Render(rc.Commit.Author.Name)
-	s += " "
-	s += commitAuthorEmailStyle.Render(rc.Commit.Author.Email)
-	s += " "
-	return commitBoxStyle.Width(b.viewport.Width).Render(s)
+// scroll keeps the cursor in view.
+func (b *Bubble) scroll() {
+	h := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if h > 0 && b.cursor >= b.offset+h {
+		b.offset = b.cursor - h + 1
+	}
+}
+
+// open shows the commit under the cursor.
+func (b *Bubble) open() {
+	if b.cursor >= len(b.commits) {
+		return
+	}
+	b.commit = newCommitView(b.repo, b.commits[b.cursor], b.styles, b.split, b.width, b.listHeight())
+}
+
+func (b *Bubble) listHeight() int {
+	return b.height - lipgloss.Height(b.breadcrumbView())
+}
+
+// breadcrumbView renders the ref, the hash of the open commit and the file
+// whose diff is shown.
+func (b *Bubble) breadcrumbView() string {
+	parts := []string{b.styles.BreadcrumbRef.Render(plumbing.ReferenceName(b.ref).Short())}
+	if b.commit != nil {
+		parts = append(parts, b.styles.Breadcrumb.Render(b.commit.commit.Hash.String()[:hashLength]))
+		if f := b.commit.file(); f >= 0 {
+			parts = append(parts, b.styles.Breadcrumb.Render(b.commit.files[f].Name()))
+		}
+	}
+	s := strings.Join(parts, b.styles.BreadcrumbSeparator.String())
+	return b.styles.Breadcrumbs.Render(truncate.StringWithTail(s, uint(b.width), "…"))
 }
 
 func (b *Bubble) View() string {
-	return b.viewport.View()
+	s := &strings.Builder{}
+	s.WriteString(b.breadcrumbView())
+	s.WriteRune('\n')
+	switch {
+	case b.err != nil && b.err == plumbing.ErrReferenceNotFound:
+		s.WriteString(b.styles.TreeNote.Render("No commits yet."))
+	case b.err != nil && len(b.commits) == 0:
+		s.WriteString(b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", b.err)))
+	case b.commit != nil:
+		s.WriteString(b.commit.view())
+	default:
+		s.WriteString(b.listView())
+	}
+	return b.styles.Tree.Render(s.String())
+}
+
+func (b *Bubble) listView() string {
+	cursor := b.styles.MenuCursor.String()
+	cw := lipgloss.Width(cursor)
+	lines := make([]string, 0, b.listHeight())
+	for i := b.offset; i < len(b.commits) && i < b.offset+b.listHeight(); i++ {
+		c := b.commits[i]
+		hash := b.styles.LogHash.Render(c.Hash.String()[:hashLength])
+		author := truncate.StringWithTail(tree.Sanitize(c.Author.Name), authorMaxWidth, "…")
+		when := humanize.Time(c.Author.When)
+		right := b.styles.LogAuthor.Render(author) + " " + b.styles.LogDate.Render(when)
+		prefix := strings.Repeat(" ", cw)
+		ss := b.styles.TreeFile
+		if i == b.cursor {
+			prefix = cursor
+			ss = b.styles.TreeSelected
+		}
+		l := prefix + " " + hash + " "
+		sw := b.width - lipgloss.Width(l) - lipgloss.Width(right) - 1
+		if sw < 1 {
+			sw = 1
+		}
+		l += ss.Render(truncate.StringWithTail(subject(c), uint(sw), "…"))
+		pad := b.width - lipgloss.Width(l) - lipgloss.Width(right)
+		if pad < 1 {
+			pad = 1
+		}
+		lines = append(lines, l+strings.Repeat(" ", pad)+right)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// subject returns the first line of the message of a commit, sanitized for
+// the terminal.
+func subject(c *object.Commit) string {
+	return tree.Sanitize(strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0])
 }
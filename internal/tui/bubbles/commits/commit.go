@@ -0,0 +1,369 @@
+package commits
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	"github.com/dustin/go-humanize"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/muesli/reflow/truncate"
+	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
+)
+
+const (
+	// splitMinWidth is the narrowest the diffs are shown side by side.
+	splitMinWidth = 100
+	// numberWidth is the width of the line numbers of the diffs.
+	numberWidth = 4
+	// dateFormat is the format of the dates of a commit, the same as git's.
+	dateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+)
+
+// commitView shows a commit: its message and metadata, the files it changed
+// and their diffs.
+type commitView struct {
+	styles *style.Styles
+	commit *object.Commit
+	files  []git.FileDiff
+	err    error
+	width  int
+	height int
+	// split shows the diffs side by side when the view is wide enough.
+	split    bool
+	viewport viewport.Model
+	lines    int
+	// offsets are the lines the diffs of the files start at.
+	offsets []int
+}
+
+func newCommitView(repo *git.Repo, c *object.Commit, styles *style.Styles, split bool, w, h int) *commitView {
+	v := &commitView{
+		styles: styles,
+		commit: c,
+		split:  split,
+	}
+	v.files, v.err = repo.Diff(c)
+	v.setSize(w, h)
+	return v
+}
+
+func (v *commitView) setSize(w, h int) {
+	f := v.file()
+	v.width = w
+	v.height = h
+	v.viewport.Width = w
+	v.viewport.Height = h
+	v.render()
+	if f >= 0 {
+		v.gotoLine(v.offsets[f])
+	}
+}
+
+// setSplit shows the diffs side by side or not, keeping the current file in
+// view.
+func (v *commitView) setSplit(split bool) {
+	v.split = split
+	v.setSize(v.width, v.height)
+}
+
+// isSplit reports whether the diffs are shown side by side.
+func (v *commitView) isSplit() bool {
+	return v.split && v.width >= splitMinWidth
+}
+
+func (v *commitView) help() []HelpEntry {
+	h := []HelpEntry{{Key: "n/p", Value: "next/prev file"}}
+	if v.width >= splitMinWidth {
+		h = append(h, HelpEntry{Key: "s", Value: "split/unified"})
+	}
+	return append(h, HelpEntry{Key: "esc", Value: "back"})
+}
+
+// update handles a key, and reports whether it was handled.
+func (v *commitView) update(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch msg.String() {
+	case "n":
+		for _, o := range v.offsets {
+			if o > v.viewport.YOffset {
+				v.gotoLine(o)
+				break
+			}
+		}
+	case "p":
+		for i := len(v.offsets) - 1; i >= 0; i-- {
+			if v.offsets[i] < v.viewport.YOffset {
+				v.gotoLine(v.offsets[i])
+				break
+			}
+		}
+	case "g", "home":
+		v.viewport.GotoTop()
+	case "G", "end":
+		v.viewport.GotoBottom()
+	case "esc", "backspace", "-", "s":
+		return false, nil
+	default:
+		var cmd tea.Cmd
+		v.viewport, cmd = v.viewport.Update(msg)
+		return true, cmd
+	}
+	return true, nil
+}
+
+// gotoLine scrolls a line to the top of the view, or as close as it gets.
+func (v *commitView) gotoLine(y int) {
+	if y > v.lines-v.height {
+		y = v.lines - v.height
+	}
+	if y < 0 {
+		y = 0
+	}
+	v.viewport.YOffset = y
+}
+
+// file returns the index of the file whose diff is at the top of the view,
+// or -1 above the first one.
+func (v *commitView) file() int {
+	f := -1
+	for i, o := range v.offsets {
+		if o <= v.viewport.YOffset {
+			f = i
+		}
+	}
+	return f
+}
+
+func (v *commitView) view() string {
+	return v.viewport.View()
+}
+
+// render lays out the commit for the width of the view.
+func (v *commitView) render() {
+	ls := v.headerLines()
+	ls = append(ls, v.statLines()...)
+	v.offsets = v.offsets[:0]
+	for _, f := range v.files {
+		ls = append(ls, "")
+		v.offsets = append(v.offsets, len(ls))
+		ls = append(ls, v.fileLines(f)...)
+	}
+	for i, l := range ls {
+		ls[i] = truncate.String(l, uint(v.width))
+	}
+	v.lines = len(ls)
+	v.viewport.SetContent(strings.Join(ls, "\n"))
+}
+
+// headerLines renders the hash, parents, author, committer and message of the
+// commit.
+func (v *commitView) headerLines() []string {
+	c := v.commit
+	label := v.styles.TreeNote
+	ls := []string{label.Render("commit     ") + v.styles.LogHash.Render(c.Hash.String())}
+	if len(c.ParentHashes) > 0 {
+		ps := make([]string, len(c.ParentHashes))
+		for i, p := range c.ParentHashes {
+			ps[i] = v.styles.LogHash.Render(p.String()[:hashLength])
+		}
+		ls = append(ls, label.Render("Parents:   ")+strings.Join(ps, " "))
+	}
+	ls = append(ls,
+		label.Render("Author:    ")+signature(c.Author),
+		label.Render("Committer: ")+signature(c.Committer),
+		"",
+	)
+	w := v.width - 4
+	if w < 1 {
+		w = 1
+	}
+	msg := tree.Sanitize(strings.TrimRight(c.Message, "\n"))
+	for _, l := range strings.Split(wrap.String(wordwrap.String(msg, w), w), "\n") {
+		ls = append(ls, "    "+l)
+	}
+	return append(ls, "")
+}
+
+// signature renders the author or committer of a commit.
+func signature(s object.Signature) string {
+	return fmt.Sprintf("%s <%s> %s (%s)", tree.Sanitize(s.Name), tree.Sanitize(s.Email), s.When.Format(dateFormat), humanize.Time(s.When))
+}
+
+// statLines renders the files changed by the commit, with their number of
+// added and deleted lines.
+func (v *commitView) statLines() []string {
+	if v.err != nil {
+		return []string{v.styles.TreeNote.Render(fmt.Sprintf("Error: %s", v.err))}
+	}
+	adds, dels := 0, 0
+	for _, f := range v.files {
+		adds += f.Additions
+		dels += f.Deletions
+	}
+	files := "files"
+	if len(v.files) == 1 {
+		files = "file"
+	}
+	ls := []string{fmt.Sprintf("%d %s changed, %s %s", len(v.files), files,
+		v.styles.DiffAdd.Render(fmt.Sprintf("+%d", adds)),
+		v.styles.DiffDelete.Render(fmt.Sprintf("-%d", dels)))}
+	for _, f := range v.files {
+		var stat string
+		switch {
+		case f.IsBinary:
+			stat = v.styles.TreeNote.Render("binary")
+		case f.TooLarge:
+			stat = v.styles.TreeNote.Render("too large")
+		default:
+			stat = v.styles.DiffAdd.Render(fmt.Sprintf("+%d", f.Additions)) + " " +
+				v.styles.DiffDelete.Render(fmt.Sprintf("-%d", f.Deletions))
+		}
+		nw := v.width - 4 - lipgloss.Width(stat) - 1
+		if nw < 1 {
+			nw = 1
+		}
+		l := "  " + status(f) + " " + truncate.StringWithTail(fileName(f), uint(nw), "…")
+		pad := v.width - lipgloss.Width(l) - lipgloss.Width(stat)
+		if pad < 1 {
+			pad = 1
+		}
+		ls = append(ls, l+strings.Repeat(" ", pad)+stat)
+	}
+	return ls
+}
+
+// status returns the letter git shows for the change to a file.
+func status(f git.FileDiff) string {
+	switch {
+	case f.From == "":
+		return "A"
+	case f.To == "":
+		return "D"
+	case f.From != f.To:
+		return "R"
+	default:
+		return "M"
+	}
+}
+
+// fileName returns the path of a changed file, with its old path if it was
+// renamed, sanitized for the terminal.
+func fileName(f git.FileDiff) string {
+	if f.From != "" && f.To != "" && f.From != f.To {
+		return tree.Sanitize(f.From) + " → " + tree.Sanitize(f.To)
+	}
+	return tree.Sanitize(f.Name())
+}
+
+// fileLines renders the diff of a file.
+func (v *commitView) fileLines(f git.FileDiff) []string {
+	ls := []string{v.styles.DiffFile.Render(truncate.StringWithTail(fileName(f), uint(v.width), "…"))}
+	switch {
+	case f.IsBinary:
+		return append(ls, v.styles.TreeNote.Render("Binary file not shown."))
+	case f.TooLarge:
+		return append(ls, v.styles.TreeNote.Render("This file is too large to diff."))
+	case len(f.Hunks) == 0:
+		return append(ls, v.styles.TreeNote.Render("No changes to the contents."))
+	}
+	for _, h := range f.Hunks {
+		ls = append(ls, v.styles.DiffHunk.Render(fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)))
+		if v.isSplit() {
+			ls = append(ls, v.splitLines(h)...)
+		} else {
+			ls = append(ls, v.unifiedLines(h)...)
+		}
+	}
+	return ls
+}
+
+// unifiedLines renders a hunk with the old and new lines one after another.
+func (v *commitView) unifiedLines(h git.Hunk) []string {
+	ls := make([]string, 0, len(h.Lines))
+	tw := v.width - 2*(numberWidth+1) - 1
+	for _, l := range h.Lines {
+		ls = append(ls, v.number(l.Old)+" "+v.number(l.New)+" "+v.text(l, tw))
+	}
+	return ls
+}
+
+// splitLines renders a hunk with the old lines on the left and the new ones
+// on the right. Deleted lines are paired with the lines added in their place.
+func (v *commitView) splitLines(h git.Hunk) []string {
+	divider := v.styles.LineNumber.Render(" │ ")
+	half := (v.width - lipgloss.Width(divider)) / 2
+	ls := make([]string, 0, len(h.Lines))
+	for i := 0; i < len(h.Lines); {
+		l := h.Lines[i]
+		if l.Op == git.DiffEqual {
+			ls = append(ls, v.cell(&l, l.Old, half)+divider+v.cell(&l, l.New, half))
+			i++
+			continue
+		}
+		var dels, adds []git.DiffLine
+		for ; i < len(h.Lines) && h.Lines[i].Op != git.DiffEqual; i++ {
+			if h.Lines[i].Op == git.DiffDelete {
+				dels = append(dels, h.Lines[i])
+			} else {
+				adds = append(adds, h.Lines[i])
+			}
+		}
+		for j := 0; j < len(dels) || j < len(adds); j++ {
+			var left, right string
+			if j < len(dels) {
+				left = v.cell(&dels[j], dels[j].Old, half)
+			} else {
+				left = v.cell(nil, 0, half)
+			}
+			if j < len(adds) {
+				right = v.cell(&adds[j], adds[j].New, half)
+			}
+			ls = append(ls, left+divider+right)
+		}
+	}
+	return ls
+}
+
+// cell renders a side of a split diff line, padded to width, or a blank one
+// if l is nil.
+func (v *commitView) cell(l *git.DiffLine, n int, width int) string {
+	if l == nil {
+		return strings.Repeat(" ", width)
+	}
+	s := v.number(n) + " " + v.text(*l, width-numberWidth-1)
+	if pad := width - lipgloss.Width(s); pad > 0 {
+		s += strings.Repeat(" ", pad)
+	}
+	return s
+}
+
+// number renders a line number, or blanks if it's 0.
+func (v *commitView) number(n int) string {
+	s := ""
+	if n > 0 {
+		s = fmt.Sprint(n)
+	}
+	return v.styles.LineNumber.Render(fmt.Sprintf("%*s", numberWidth, s))
+}
+
+// text renders the marker and text of a diff line, cut to width.
+func (v *commitView) text(l git.DiffLine, width int) string {
+	if width < 1 {
+		return ""
+	}
+	s := truncate.String(tree.Sanitize(l.Text), uint(width-1))
+	switch l.Op {
+	case git.DiffAdd:
+		return v.styles.DiffAdd.Render("+" + s)
+	case git.DiffDelete:
+		return v.styles.DiffDelete.Render("-" + s)
+	default:
+		return " " + s
+	}
+}
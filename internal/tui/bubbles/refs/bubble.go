@@ -0,0 +1,233 @@
+package refs
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	"github.com/dustin/go-humanize"
+	"github.com/muesli/reflow/truncate"
+)
+
+const (
+	// hashLength is the length of the abbreviated commit hashes.
+	hashLength = 7
+	// nameMaxWidth is the widest a ref name is shown.
+	nameMaxWidth = 32
+)
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry = tree.HelpEntry
+
+// SelectedMsg is sent when a ref is selected.
+type SelectedMsg struct {
+	// Ref is the full name of the ref, such as refs/heads/main.
+	Ref string
+}
+
+// row is a line of the list: the heading of a section, or a ref.
+type row struct {
+	heading string
+	ref     int
+}
+
+// Bubble lists the branches and tags of a repo, with the commit they point
+// to, and selects the ref the repo is shown at.
+type Bubble struct {
+	repo *git.Repo
+	// ref is the ref the repo is shown at.
+	ref    string
+	styles *style.Styles
+	width  int
+	height int
+	refs   []git.Ref
+	rows   []row
+	cursor int
+	offset int
+	err    error
+}
+
+// NewBubble returns a Bubble listing the refs of a repo, which is shown at
+// ref.
+func NewBubble(repo *git.Repo, ref string, styles *style.Styles, width, height int) *Bubble {
+	b := &Bubble{
+		repo:   repo,
+		ref:    ref,
+		styles: styles,
+	}
+	b.SetSize(width, height)
+	return b
+}
+
+func (b *Bubble) Init() tea.Cmd {
+	b.refs, b.err = b.repo.Refs()
+	b.rows = b.rows[:0]
+	for i, r := range b.refs {
+		switch {
+		case i == 0 && !r.IsTag:
+			b.rows = append(b.rows, row{heading: "Branches"})
+		case r.IsTag && (i == 0 || !b.refs[i-1].IsTag):
+			b.rows = append(b.rows, row{heading: "Tags"})
+		}
+		b.rows = append(b.rows, row{ref: i})
+		if r.Name == b.ref {
+			b.cursor = i
+		}
+	}
+	b.scroll()
+	return nil
+}
+
+// SetSize sets the size of the area the refs are shown in.
+func (b *Bubble) SetSize(w, h int) {
+	b.width = w - b.styles.Tree.GetHorizontalFrameSize()
+	b.height = h - b.styles.Tree.GetVerticalFrameSize()
+	b.scroll()
+}
+
+// SetRef sets the ref the repo is shown at.
+func (b *Bubble) SetRef(ref string) {
+	b.ref = ref
+}
+
+// Help returns the key bindings of the list.
+func (b *Bubble) Help() []HelpEntry {
+	return []HelpEntry{{Key: "enter", Value: "select"}}
+}
+
+func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "k", "up":
+			b.move(-1)
+		case "j", "down":
+			b.move(1)
+		case "b", "pgup":
+			b.move(-b.height)
+		case "f", "pgdown":
+			b.move(b.height)
+		case "g", "home":
+			b.move(-len(b.refs))
+		case "G", "end":
+			b.move(len(b.refs))
+		case "enter":
+			if b.cursor < len(b.refs) {
+				ref := b.refs[b.cursor].Name
+				b.ref = ref
+				return b, func() tea.Msg {
+					return SelectedMsg{Ref: ref}
+				}
+			}
+		}
+	}
+	return b, nil
+}
+
+func (b *Bubble) move(n int) {
+	b.cursor += n
+	if b.cursor >= len(b.refs) {
+		b.cursor = len(b.refs) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	b.scroll()
+}
+
+// scroll keeps the cursor, and the heading of its section if there's room,
+// in view.
+func (b *Bubble) scroll() {
+	cr := 0
+	for i, r := range b.rows {
+		if r.heading == "" && r.ref == b.cursor {
+			cr = i
+			break
+		}
+	}
+	top := cr
+	if top > 0 && b.rows[top-1].heading != "" {
+		top--
+	}
+	if top < b.offset {
+		b.offset = top
+	}
+	if b.height > 0 && cr >= b.offset+b.height {
+		b.offset = cr - b.height + 1
+	}
+}
+
+func (b *Bubble) View() string {
+	var s string
+	switch {
+	case b.err != nil:
+		s = b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", b.err))
+	case len(b.refs) == 0:
+		s = b.styles.TreeNote.Render("No branches or tags yet.")
+	default:
+		s = b.listView()
+	}
+	return b.styles.Tree.Render(s)
+}
+
+func (b *Bubble) listView() string {
+	cursor := b.styles.MenuCursor.String()
+	cw := lipgloss.Width(cursor)
+	nw := 0
+	for _, r := range b.refs {
+		if w := lipgloss.Width(r.Short()); w > nw {
+			nw = w
+		}
+	}
+	if nw > nameMaxWidth {
+		nw = nameMaxWidth
+	}
+	def := b.styles.RefDefault.Render("default")
+	dw := lipgloss.Width(def)
+	lines := make([]string, 0, b.height)
+	for i := b.offset; i < len(b.rows) && i < b.offset+b.height; i++ {
+		if h := b.rows[i].heading; h != "" {
+			lines = append(lines, b.styles.RefHeading.Render(h))
+			continue
+		}
+		ri := b.rows[i].ref
+		r := b.refs[ri]
+		prefix := strings.Repeat(" ", cw)
+		ns := b.styles.TreeDir
+		if ri == b.cursor {
+			prefix = cursor
+			ns = b.styles.TreeSelected
+		}
+		mark := "  "
+		if r.Name == b.ref {
+			mark = b.styles.RefCurrent.Render("●") + " "
+		}
+		name := r.Short()
+		if lipgloss.Width(name) > nw {
+			name = truncate.StringWithTail(name, uint(nw), "…")
+		}
+		l := prefix + " " + mark + ns.Render(name) + strings.Repeat(" ", nw-lipgloss.Width(name)) + " "
+		if r.IsDefault {
+			l += def
+		} else {
+			l += strings.Repeat(" ", dw)
+		}
+		l += " " + b.styles.LogHash.Render(r.Commit.Hash.String()[:hashLength]) + " "
+		when := b.styles.LogDate.Render(humanize.Time(r.Commit.Committer.When))
+		sw := b.width - lipgloss.Width(l) - lipgloss.Width(when) - 1
+		if sw > 0 {
+			subject := strings.SplitN(strings.TrimSpace(r.Commit.Message), "\n", 2)[0]
+			l += truncate.StringWithTail(tree.Sanitize(subject), uint(sw), "…")
+		}
+		pad := b.width - lipgloss.Width(l) - lipgloss.Width(when)
+		if pad < 1 {
+			pad = 1
+		}
+		lines = append(lines, l+strings.Repeat(" ", pad)+when)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -4,15 +4,23 @@ import (
 	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
-	"github.com/charmbracelet/glamour/ansi"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/activity"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/commits"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/refs"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/search"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
 	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	"github.com/dustin/go-humanize"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/muesli/reflow/truncate"
 	"github.com/muesli/reflow/wrap"
 )
@@ -22,19 +30,41 @@ const (
 	repoNameMaxWidth = 32
 )
 
-var glamourStyle = func() ansi.StyleConfig {
-	noColor := ""
-	s := glamour.DarkStyleConfig
-	s.Document.StylePrimitive.Color = &noColor
-	s.CodeBlock.Chroma.Text.Color = &noColor
-	s.CodeBlock.Chroma.Name.Color = &noColor
-	return s
-}()
-
 type ErrMsg struct {
 	Error error
 }
 
+// tab is a view of the repo shown in the body.
+type tab int
+
+const (
+	readmeTab tab = iota
+	filesTab
+	logTab
+	refsTab
+	activityTab
+	searchTab
+)
+
+var tabNames = map[tab]string{
+	readmeTab:   "Readme",
+	filesTab:    "Files",
+	logTab:      "Log",
+	refsTab:     "Refs",
+	activityTab: "Activity",
+	searchTab:   "Search",
+}
+
+// repoTabs are the tabs of a repo, and homeTabs the ones of the home screen.
+// The tabs browsing the repo are left out for users who can't read it.
+var (
+	repoTabs = []tab{readmeTab, filesTab, logTab, refsTab}
+	homeTabs = []tab{readmeTab, filesTab, activityTab, searchTab}
+)
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry = tree.HelpEntry
+
 type Bubble struct {
 	templateObject interface{}
 	repoSource     *git.RepoSource
@@ -43,11 +73,25 @@ type Bubble struct {
 	styles         *style.Styles
 	readmeViewport *ViewportBubble
 	readme         string
-	height         int
-	heightMargin   int
-	width          int
-	widthMargin    int
-	Active         bool
+	tabs           []tab
+	tab            tab
+	// ref is the ref the README, files and history are shown at, HEAD unless
+	// another one is picked in the Refs tab.
+	ref string
+	// files, log and refs are created the first time their tab is shown, and
+	// files and log again once another ref is picked.
+	files        *tree.Bubble
+	log          *commits.Bubble
+	refs         *refs.Bubble
+	activity     *activity.Bubble
+	search       *search.Bubble
+	height       int
+	heightMargin int
+	width        int
+	widthMargin  int
+	Active       bool
+	// browsable is set if the viewer can read the repo, see SetBrowsable.
+	browsable bool
 
 	// XXX: ideally, we get these from the parent as a pointer. Currently, we
 	// can't add a *tui.Config because it's an illegal import cycle. One
@@ -68,6 +112,7 @@ func NewBubble(rs *git.RepoSource, name string, styles *style.Styles, width, wm,
 		readmeViewport: &ViewportBubble{
 			Viewport: &viewport.Model{},
 		},
+		tabs: repoTabs,
 	}
 	b.SetSize(width, height)
 	return b
@@ -80,6 +125,42 @@ func (b *Bubble) Init() tea.Cmd {
 func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if b.Typing() {
+			_, cmd := b.search.Update(msg)
+			return b, cmd
+		}
+		switch msg.String() {
+		case "[":
+			b.setTab(b.tabs[(b.tabIndex()+len(b.tabs)-1)%len(b.tabs)])
+			return b, nil
+		case "]":
+			b.setTab(b.tabs[(b.tabIndex()+1)%len(b.tabs)])
+			return b, nil
+		}
+		if b.tab == filesTab && b.files != nil {
+			_, cmd := b.files.Update(msg)
+			return b, cmd
+		}
+		if b.tab == logTab && b.log != nil {
+			_, cmd := b.log.Update(msg)
+			return b, cmd
+		}
+		if b.tab == refsTab && b.refs != nil {
+			_, cmd := b.refs.Update(msg)
+			return b, cmd
+		}
+		if b.tab == activityTab {
+			_, cmd := b.activity.Update(msg)
+			return b, cmd
+		}
+		if b.tab == searchTab {
+			_, cmd := b.search.Update(msg)
+			return b, cmd
+		}
+	case refs.SelectedMsg:
+		b.setRef(msg.Ref)
+		return b, nil
 	case tea.WindowSizeMsg:
 		b.SetSize(msg.Width, msg.Height)
 		// XXX: if we find that longer readmes take more than a few
@@ -101,7 +182,208 @@ func (b *Bubble) SetSize(w, h int) {
 	b.width = w
 	b.height = h
 	b.readmeViewport.Viewport.Width = w - b.widthMargin
-	b.readmeViewport.Viewport.Height = h - lipgloss.Height(b.headerView()) - b.heightMargin
+	b.readmeViewport.Viewport.Height = b.bodyHeight()
+	if b.files != nil {
+		b.files.SetSize(b.bodyWidth(), b.bodyHeight())
+	}
+	if b.log != nil {
+		b.log.SetSize(b.bodyWidth(), b.bodyHeight())
+	}
+	if b.refs != nil {
+		b.refs.SetSize(b.bodyWidth(), b.bodyHeight())
+	}
+	if b.activity != nil {
+		b.activity.SetSize(b.bodyWidth(), b.bodyHeight())
+	}
+	if b.search != nil {
+		b.search.SetSize(b.bodyWidth(), b.bodyHeight())
+	}
+}
+
+// SetHome turns the repo into the home screen, which has an Activity tab
+// showing a and a Search tab showing s instead of the tabs browsing the repo.
+func (b *Bubble) SetHome(a *activity.Bubble, s *search.Bubble) {
+	b.activity = a
+	b.search = s
+	b.setTabs()
+	a.SetSize(b.bodyWidth(), b.bodyHeight())
+	s.SetSize(b.bodyWidth(), b.bodyHeight())
+}
+
+// SetBrowsable sets whether the files and history of the repo can be shown.
+// The config repo is the home screen of everyone, but only the users who can
+// read it can browse it.
+func (b *Bubble) SetBrowsable(ok bool) {
+	b.browsable = ok
+	if !ok {
+		b.files = nil
+		b.log = nil
+		b.refs = nil
+	}
+	b.setTabs()
+}
+
+// setTabs sets the tabs of the repo or of the home screen, leaving out the
+// ones browsing the repo if it can't be browsed.
+func (b *Bubble) setTabs() {
+	ts := repoTabs
+	if b.activity != nil {
+		ts = homeTabs
+	}
+	b.tabs = make([]tab, 0, len(ts))
+	for _, t := range ts {
+		if !b.browsable && (t == filesTab || t == logTab || t == refsTab) {
+			continue
+		}
+		b.tabs = append(b.tabs, t)
+	}
+	if b.tabs[b.tabIndex()] != b.tab {
+		b.tab = readmeTab
+	}
+}
+
+// Typing reports whether a search query is being typed, so that keys should
+// go to the repo.
+func (b *Bubble) Typing() bool {
+	return b.tab == searchTab && b.search.Typing()
+}
+
+// OpenFile shows a file of the default branch in the Files tab, scrolled to a
+// line counted from 1.
+func (b *Bubble) OpenFile(path string, line int) {
+	if b.repo == nil || !b.browsable {
+		return
+	}
+	ref := "HEAD"
+	if hr, err := b.repo.Repository.Head(); err == nil {
+		ref = hr.Name().String()
+	}
+	if ref != b.ref {
+		b.setRef(ref)
+	}
+	b.setTab(filesTab)
+	if b.files != nil {
+		b.files.Open(path, line)
+	}
+}
+
+// tabIndex returns the position of the current tab.
+func (b *Bubble) tabIndex() int {
+	for i, t := range b.tabs {
+		if t == b.tab {
+			return i
+		}
+	}
+	return 0
+}
+
+// bodyWidth is the width of the tab shown in the body.
+func (b *Bubble) bodyWidth() int {
+	return b.width - b.widthMargin - b.styles.RepoBody.GetHorizontalFrameSize()
+}
+
+// bodyHeight is the height of the tab shown in the body.
+func (b *Bubble) bodyHeight() int {
+	return b.height - lipgloss.Height(b.headerView()) - lipgloss.Height(b.tabsView()) - b.heightMargin
+}
+
+// setTab switches to a tab, setting it up the first time it's shown.
+func (b *Bubble) setTab(t tab) {
+	b.tab = t
+	if !b.browsable {
+		return
+	}
+	if t == filesTab && b.files == nil && b.repo != nil {
+		b.files = tree.NewBubble(b.repo, b.ref, b.styles, b.bodyWidth(), b.bodyHeight(), b.renderMarkdown)
+		b.files.Init()
+	}
+	if t == logTab && b.log == nil && b.repo != nil {
+		b.log = commits.NewBubble(b.repo, b.ref, b.styles, b.bodyWidth(), b.bodyHeight())
+		b.log.Init()
+	}
+	if t == refsTab && b.refs == nil && b.repo != nil {
+		b.refs = refs.NewBubble(b.repo, b.ref, b.styles, b.bodyWidth(), b.bodyHeight())
+		b.refs.Init()
+	}
+}
+
+// setRef shows the README, files and history of the repo at a ref.
+func (b *Bubble) setRef(ref string) {
+	b.ref = ref
+	b.files = nil
+	b.log = nil
+	if b.refs != nil {
+		b.refs.SetRef(ref)
+	}
+	md, _, err := b.repo.ReadFile(ref, "README.md", -1)
+	if err != nil && err != object.ErrEntryNotFound && err != object.ErrDirectoryNotFound {
+		b.readme = ""
+		b.readmeViewport.Viewport.SetContent(b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", err)))
+		return
+	}
+	err = b.setReadme(string(md))
+	if err != nil {
+		b.readmeViewport.Viewport.SetContent(b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", err)))
+	}
+}
+
+// SetTemplate sets the object the README is filled in with from the next
+// Refresh on.
+func (b *Bubble) SetTemplate(tmp interface{}) {
+	b.templateObject = tmp
+}
+
+// Refresh reads the repo again after it changed. The current tab stays, and
+// so does the ref unless it was deleted, in which case the default branch is
+// shown.
+func (b *Bubble) Refresh() error {
+	r, err := b.repoSource.GetRepo(b.name)
+	if err == git.ErrMissingRepo {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.repo = r
+	ref := b.ref
+	if _, err := r.Repository.Reference(plumbing.ReferenceName(ref), true); err != nil || ref == "HEAD" {
+		ref = "HEAD"
+		if hr, err := r.Repository.Head(); err == nil {
+			ref = hr.Name().String()
+		}
+	}
+	b.refs = nil
+	if ref == "HEAD" {
+		// The repo is still empty.
+		b.ref = ref
+		b.files = nil
+		b.log = nil
+		return b.setReadme(r.Readme)
+	}
+	b.setRef(ref)
+	b.setTab(b.tab)
+	return nil
+}
+
+// Help returns the key bindings of the current tab.
+func (b *Bubble) Help() []HelpEntry {
+	h := []HelpEntry{{Key: "[/]", Value: "tabs"}}
+	if b.tab == filesTab && b.files != nil {
+		return append(h, b.files.Help()...)
+	}
+	if b.tab == logTab && b.log != nil {
+		return append(h, b.log.Help()...)
+	}
+	if b.tab == refsTab && b.refs != nil {
+		return append(h, b.refs.Help()...)
+	}
+	if b.tab == activityTab {
+		return append(h, b.activity.Help()...)
+	}
+	if b.tab == searchTab {
+		return append(h, b.search.Help()...)
+	}
+	return append(h, HelpEntry{Key: "f/b", Value: "pgdown/pgup"})
 }
 
 func (b *Bubble) GotoTop() {
@@ -116,6 +398,10 @@ func (b Bubble) headerView() string {
 	}
 	title = truncate.StringWithTail(title, repoNameMaxWidth, "…")
 	title = b.styles.RepoTitle.Render(title)
+	if b.repo != nil {
+		size := b.styles.RepoSize.Render(humanize.Bytes(uint64(b.repo.Size)))
+		title = lipgloss.JoinHorizontal(lipgloss.Top, title, size)
+	}
 
 	// Render clone command
 	var note string
@@ -149,15 +435,59 @@ func (b Bubble) headerView() string {
 	return lipgloss.JoinHorizontal(lipgloss.Top, title, note)
 }
 
+// tabsView renders the names of the tabs, and the ref the repo is shown at.
+func (b *Bubble) tabsView() string {
+	ts := make([]string, len(b.tabs))
+	for i, t := range b.tabs {
+		if t == b.tab {
+			ts[i] = b.styles.ActiveRepoTab.Render(tabNames[t])
+		} else {
+			ts[i] = b.styles.RepoTab.Render(tabNames[t])
+		}
+	}
+	s := strings.Join(ts, b.styles.RepoTabDivider.String())
+	if b.repo != nil && b.activity == nil {
+		ref := plumbing.ReferenceName(b.ref).Short()
+		w := b.bodyWidth() - b.styles.RepoTabs.GetHorizontalFrameSize() - lipgloss.Width(s) - 2
+		if w > 0 {
+			ref = truncate.StringWithTail(ref, uint(w), "…")
+			s += strings.Repeat(" ", w-lipgloss.Width(ref)+2) + b.styles.BreadcrumbRef.Render(ref)
+		}
+	}
+	return b.styles.RepoTabs.Render(s)
+}
+
 func (b *Bubble) View() string {
 	header := b.headerView()
 	bs := b.styles.RepoBody.Copy()
 	if b.Active {
 		bs = bs.BorderForeground(b.styles.ActiveBorderColor)
 	}
+	content := b.readmeViewport.View()
+	switch b.tab {
+	case filesTab:
+		content = b.styles.TreeNote.Render("No files yet.")
+		if b.files != nil {
+			content = b.files.View()
+		}
+	case logTab:
+		content = b.styles.TreeNote.Render("No commits yet.")
+		if b.log != nil {
+			content = b.log.View()
+		}
+	case refsTab:
+		content = b.styles.TreeNote.Render("No branches or tags yet.")
+		if b.refs != nil {
+			content = b.refs.View()
+		}
+	case activityTab:
+		content = b.activity.View()
+	case searchTab:
+		content = b.search.View()
+	}
 	body := bs.Width(b.width - b.widthMargin - b.styles.RepoBody.GetVerticalFrameSize()).
 		Height(b.height - b.heightMargin - lipgloss.Height(header)).
-		Render(b.readmeViewport.View())
+		Render(b.tabsView() + "\n" + content)
 	return header + body
 }
 
@@ -177,17 +507,32 @@ func (b *Bubble) setupCmd() tea.Msg {
 	if err != nil {
 		return ErrMsg{err}
 	}
-	md := r.Readme
+	b.repo = r
+	b.ref = "HEAD"
+	if hr, err := r.Repository.Head(); err == nil {
+		b.ref = hr.Name().String()
+	}
+	err = b.setReadme(r.Readme)
+	if err != nil {
+		return ErrMsg{err}
+	}
+	return nil
+}
+
+// setReadme shows a README, filled in with the template object if there's
+// one.
+func (b *Bubble) setReadme(md string) error {
+	var err error
 	if b.templateObject != nil {
 		md, err = b.templatize(md)
 		if err != nil {
-			return ErrMsg{err}
+			return err
 		}
 	}
 	b.readme = md
 	md, err = b.glamourize(md)
 	if err != nil {
-		return ErrMsg{err}
+		return err
 	}
 	b.readmeViewport.Viewport.SetContent(md)
 	b.GotoTop()
@@ -208,12 +553,16 @@ func (b *Bubble) templatize(mdt string) (string, error) {
 }
 
 func (b *Bubble) glamourize(md string) (string, error) {
-	w := b.width - b.widthMargin - b.styles.RepoBody.GetHorizontalFrameSize()
+	return b.renderMarkdown(md, b.width-b.widthMargin-b.styles.RepoBody.GetHorizontalFrameSize())
+}
+
+// renderMarkdown renders markdown with Glamour to fit the given width.
+func (b *Bubble) renderMarkdown(md string, w int) (string, error) {
 	if w > glamourMaxWidth {
 		w = glamourMaxWidth
 	}
 	tr, err := glamour.NewTermRenderer(
-		glamour.WithStyles(glamourStyle),
+		glamour.WithStyles(b.styles.Markdown),
 		glamour.WithWordWrap(w),
 	)
 
@@ -0,0 +1,265 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/config"
+	sr "github.com/charmbracelet/soft-serve/internal/search"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	"github.com/gliderlabs/ssh"
+	"github.com/muesli/reflow/truncate"
+)
+
+// maxQueryLength is the longest query that can be typed.
+const maxQueryLength = 128
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry = tree.HelpEntry
+
+// OpenMsg is sent when a match is picked, to show the file it's in at the line
+// of the match.
+type OpenMsg struct {
+	Repo string
+	Path string
+	Line int
+}
+
+// Bubble searches the files of the default branch of the repos the user can
+// read, and lists the matching lines.
+type Bubble struct {
+	cfg    *config.Config
+	pk     ssh.PublicKey
+	styles *style.Styles
+	width  int
+	height int
+	// typing is set while the query is typed.
+	typing  bool
+	query   string
+	regex   bool
+	results *sr.Results
+	err     error
+	cursor  int
+	offset  int
+}
+
+// NewBubble returns a Bubble searching the repos the given key can read.
+func NewBubble(cfg *config.Config, pk ssh.PublicKey, styles *style.Styles) *Bubble {
+	return &Bubble{
+		cfg:    cfg,
+		pk:     pk,
+		styles: styles,
+	}
+}
+
+func (b *Bubble) Init() tea.Cmd {
+	return nil
+}
+
+// SetSize sets the size of the area the search is shown in.
+func (b *Bubble) SetSize(w, h int) {
+	b.width = w - b.styles.Tree.GetHorizontalFrameSize()
+	b.height = h - b.styles.Tree.GetVerticalFrameSize()
+	b.scroll()
+}
+
+// Typing reports whether the query is being typed, so that keys should go to
+// the search.
+func (b *Bubble) Typing() bool {
+	return b.typing
+}
+
+// Help returns the key bindings of the search.
+func (b *Bubble) Help() []HelpEntry {
+	if b.typing {
+		return []HelpEntry{{Key: "enter", Value: "search"}, {Key: "ctrl+r", Value: "regex"}, {Key: "esc", Value: "cancel"}}
+	}
+	h := []HelpEntry{{Key: "/", Value: "search"}, {Key: "r", Value: "regex"}}
+	if b.results != nil && len(b.results.Matches) > 0 {
+		h = append(h, HelpEntry{Key: "enter", Value: "open"})
+	}
+	return h
+}
+
+func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	km, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return b, nil
+	}
+	if b.typing {
+		b.updateQuery(km)
+		return b, nil
+	}
+	switch km.String() {
+	case "/":
+		b.typing = true
+	case "r":
+		b.regex = !b.regex
+		b.search()
+	case "k", "up":
+		b.move(-1)
+	case "j", "down":
+		b.move(1)
+	case "b", "pgup":
+		b.move(-b.listHeight())
+	case "f", "pgdown":
+		b.move(b.listHeight())
+	case "g", "home":
+		b.move(-b.matches())
+	case "G", "end":
+		b.move(b.matches())
+	case "enter":
+		if b.cursor < b.matches() {
+			m := b.results.Matches[b.cursor]
+			return b, func() tea.Msg {
+				return OpenMsg{Repo: m.Repo, Path: m.Path, Line: m.Line}
+			}
+		}
+	}
+	return b, nil
+}
+
+// updateQuery handles a key press while the query is typed.
+func (b *Bubble) updateQuery(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		b.typing = false
+	case tea.KeyEnter:
+		b.typing = false
+		b.search()
+	case tea.KeyCtrlR:
+		b.regex = !b.regex
+	case tea.KeyBackspace:
+		if rs := []rune(b.query); len(rs) > 0 {
+			b.query = string(rs[:len(rs)-1])
+		}
+	case tea.KeySpace:
+		b.query += " "
+	case tea.KeyRunes:
+		b.query += string(msg.Runes)
+	}
+	if len(b.query) > maxQueryLength {
+		b.query = b.query[:maxQueryLength]
+	}
+}
+
+// search runs the query.
+func (b *Bubble) search() {
+	b.results = nil
+	b.err = nil
+	b.cursor = 0
+	b.offset = 0
+	if b.query == "" {
+		return
+	}
+	b.results, b.err = b.cfg.SearchRepos(sr.Query{Pattern: b.query, Regex: b.regex}, b.pk)
+}
+
+// matches returns the number of matches listed.
+func (b *Bubble) matches() int {
+	if b.results == nil {
+		return 0
+	}
+	return len(b.results.Matches)
+}
+
+func (b *Bubble) move(n int) {
+	b.cursor += n
+	if b.cursor >= b.matches() {
+		b.cursor = b.matches() - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	b.scroll()
+}
+
+// scroll keeps the cursor in view.
+func (b *Bubble) scroll() {
+	h := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if h > 0 && b.cursor >= b.offset+h {
+		b.offset = b.cursor - h + 1
+	}
+}
+
+// listHeight is the number of lines the matches are shown in, below the
+// query and above the note on truncated results.
+func (b *Bubble) listHeight() int {
+	h := b.height - 2
+	if b.results != nil && b.results.More {
+		h--
+	}
+	return h
+}
+
+// queryView renders the query, and whether it's a regular expression.
+func (b *Bubble) queryView() string {
+	s := b.styles.Prompt.Render("/") + tree.Sanitize(b.query)
+	if b.typing {
+		s += "█"
+	}
+	mode := "text"
+	if b.regex {
+		mode = "regex"
+	}
+	mode = b.styles.TreeNote.Render(mode)
+	pad := b.width - lipgloss.Width(s) - lipgloss.Width(mode)
+	if pad < 1 {
+		pad = 1
+	}
+	return truncate.String(s+strings.Repeat(" ", pad)+mode, uint(b.width))
+}
+
+// matchView renders a match: its repo, path and line, and the line with the
+// match highlighted.
+func (b *Bubble) matchView(m sr.Match, selected bool) string {
+	cursor := b.styles.MenuCursor.String()
+	prefix := strings.Repeat(" ", lipgloss.Width(cursor))
+	ps := b.styles.TreeFile
+	if selected {
+		prefix = cursor
+		ps = b.styles.TreeSelected
+	}
+	l := prefix + " " +
+		b.styles.TreeDir.Render(m.Repo) + " " +
+		ps.Render(tree.Sanitize(m.Path)) +
+		b.styles.LineNumber.Render(":"+strconv.Itoa(m.Line)) + " " +
+		tree.Sanitize(strings.TrimLeft(m.Text[:m.Start], " \t")) +
+		b.styles.MenuMatch.Render(tree.Sanitize(m.Text[m.Start:m.End])) +
+		tree.Sanitize(m.Text[m.End:])
+	if lipgloss.Width(l) > b.width {
+		l = truncate.StringWithTail(l, uint(b.width), "…")
+	}
+	return l
+}
+
+func (b *Bubble) View() string {
+	lines := []string{b.queryView(), ""}
+	switch {
+	case b.err != nil:
+		lines = append(lines, b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", b.err)))
+	case b.results == nil:
+		lines = append(lines, b.styles.TreeNote.Render("Press / to search the files of the repos."))
+	case len(b.results.Matches) == 0:
+		lines = append(lines, b.styles.TreeNote.Render("No matches."))
+	default:
+		for i := b.offset; i < len(b.results.Matches) && i < b.offset+b.listHeight(); i++ {
+			lines = append(lines, b.matchView(b.results.Matches[i], i == b.cursor))
+		}
+		if b.results.More {
+			for len(lines) < b.height-1 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, b.styles.TreeNote.Render(
+				fmt.Sprintf("Only the first %d matches are shown.", len(b.results.Matches))))
+		}
+	}
+	return b.styles.Tree.Render(strings.Join(lines, "\n"))
+}
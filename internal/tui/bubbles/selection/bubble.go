@@ -1,100 +1,427 @@
 package selection
 
 import (
+	"sort"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/tree"
 	"github.com/charmbracelet/soft-serve/internal/tui/style"
 	"github.com/muesli/reflow/truncate"
+	"github.com/sahilm/fuzzy"
 )
 
+// maxFilterLength is the longest filter that can be typed.
+const maxFilterLength = 64
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry = tree.HelpEntry
+
+// SelectedMsg is sent when an item is picked with enter. Index is the
+// position of the item in Items.
 type SelectedMsg struct {
 	Name  string
 	Index int
 }
 
+// ActiveMsg is sent when the cursor moves to another item. Index is the
+// position of the item in Items.
 type ActiveMsg struct {
 	Name  string
 	Index int
 }
 
+// SortMode is the order the items are listed in.
+type SortMode int
+
+const (
+	// SortDefault lists the items in the order they were given.
+	SortDefault SortMode = iota
+	SortName
+	// SortUpdated lists the most recently updated items first.
+	SortUpdated
+	// SortActivity lists the most active items first.
+	SortActivity
+)
+
+var sortNames = []string{"default", "name", "updated", "activity"}
+
+func (m SortMode) String() string {
+	return sortNames[m]
+}
+
+// Item is an entry of the list.
+type Item struct {
+	Name string
+	// Note is matched by the filter along with the name.
+	Note string
+	// Updated is when the item last changed, and Activity how much it changed
+	// lately. They're used to sort the items.
+	Updated  time.Time
+	Activity int
+}
+
+// row is an item shown in the list, with the bytes of its name matched by
+// the filter.
+type row struct {
+	item    int
+	matches []int
+}
+
+// Bubble is a list of items, which can be filtered and sorted. The cursor
+// stays on the same item as the list changes.
 type Bubble struct {
-	Items        []string
-	SelectedItem int
-	styles       *style.Styles
+	Items  []Item
+	styles *style.Styles
+	height int
+	sort   SortMode
+	// filtering is set while the filter is typed.
+	filtering bool
+	filter    string
+	// rows are the items shown, and cursor the position of the selected one.
+	rows   []row
+	cursor int
+	offset int
 }
 
-func NewBubble(items []string, styles *style.Styles) *Bubble {
-	return &Bubble{
-		Items:  items,
+func NewBubble(items []Item, styles *style.Styles) *Bubble {
+	b := &Bubble{
 		styles: styles,
 	}
+	b.SetItems(items)
+	return b
 }
 
 func (b *Bubble) Init() tea.Cmd {
 	return nil
 }
 
-func (b Bubble) View() string {
-	s := strings.Builder{}
-	repoNameMaxWidth := b.styles.Menu.GetWidth() - // menu width
-		b.styles.Menu.GetHorizontalPadding() - // menu padding
-		lipgloss.Width(b.styles.MenuCursor.String()) - // cursor
-		b.styles.MenuItem.GetHorizontalFrameSize() // menu item gaps
-	for i, item := range b.Items {
-		item := truncate.StringWithTail(item, uint(repoNameMaxWidth), "…")
-		if i == b.SelectedItem {
-			s.WriteString(b.styles.MenuCursor.String())
-			s.WriteString(b.styles.SelectedMenuItem.Render(item))
-		} else {
-			s.WriteString(b.styles.MenuItem.Render(item))
-		}
-		if i < len(b.Items)-1 {
-			s.WriteRune('\n')
+// SetItems replaces the items of the list, keeping the cursor on the item of
+// the same name if there's one.
+func (b *Bubble) SetItems(items []Item) {
+	var name string
+	if i := b.Selected(); i >= 0 {
+		name = b.Items[i].Name
+	}
+	b.Items = items
+	b.rows = nil
+	b.update()
+	for i, r := range b.rows {
+		if items[r.item].Name == name {
+			b.cursor = i
 		}
 	}
-	return s.String()
+	b.scroll()
+}
+
+// SetHeight sets the number of lines the list is shown in.
+func (b *Bubble) SetHeight(h int) {
+	b.height = h
+	b.scroll()
+}
+
+// Select moves the cursor to the item at position i of Items. The filter is
+// cleared if the item is filtered out.
+func (b *Bubble) Select(i int) {
+	if b.rowOf(i) == -1 {
+		b.filter = ""
+		b.filtering = false
+		b.update()
+	}
+	if r := b.rowOf(i); r != -1 {
+		b.cursor = r
+	}
+	b.scroll()
+}
+
+// Selected returns the position in Items of the item under the cursor, or -1
+// if no item is shown.
+func (b *Bubble) Selected() int {
+	if b.cursor < 0 || b.cursor >= len(b.rows) {
+		return -1
+	}
+	return b.rows[b.cursor].item
+}
+
+// Filtering reports whether the filter is being typed, so that keys should go
+// to the list.
+func (b *Bubble) Filtering() bool {
+	return b.filtering
+}
+
+// SortMode returns the order the items are listed in.
+func (b *Bubble) SortMode() SortMode {
+	return b.sort
+}
+
+// Help returns the key bindings of the list.
+func (b *Bubble) Help() []HelpEntry {
+	if b.filtering {
+		return []HelpEntry{{Key: "enter", Value: "apply"}, {Key: "esc", Value: "clear"}}
+	}
+	h := []HelpEntry{{Key: "/", Value: "filter"}, {Key: "s", Value: "sort: " + b.sort.String()}}
+	if b.filter != "" {
+		h = append(h, HelpEntry{Key: "esc", Value: "clear filter"})
+	}
+	return h
 }
 
 func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	cmds := make([]tea.Cmd, 0)
+	sel := b.Selected()
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if b.filtering {
+			b.updateFilter(msg)
+			break
+		}
 		switch msg.String() {
 		case "k", "up":
-			if b.SelectedItem > 0 {
-				b.SelectedItem--
-				cmds = append(cmds, b.sendActiveMessage)
-			}
+			b.move(-1)
 		case "j", "down":
-			if b.SelectedItem < len(b.Items)-1 {
-				b.SelectedItem++
-				cmds = append(cmds, b.sendActiveMessage)
-			}
+			b.move(1)
+		case "b", "pgup":
+			b.move(-b.height)
+		case "f", "pgdown":
+			b.move(b.height)
+		case "g", "home":
+			b.move(-len(b.rows))
+		case "G", "end":
+			b.move(len(b.rows))
+		case "/":
+			b.filtering = true
+		case "s":
+			b.sort = (b.sort + 1) % SortMode(len(sortNames))
+			b.update()
+		case "esc":
+			b.filter = ""
+			b.update()
 		case "enter":
 			cmds = append(cmds, b.sendSelectedMessage)
 		}
 	}
+	if b.Selected() != sel && b.Selected() != -1 {
+		cmds = append(cmds, b.sendActiveMessage)
+	}
 	return b, tea.Batch(cmds...)
 }
 
+// updateFilter handles a key press while the filter is typed.
+func (b *Bubble) updateFilter(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		b.filtering = false
+		b.filter = ""
+	case tea.KeyEnter:
+		b.filtering = false
+	case tea.KeyUp:
+		b.move(-1)
+		return
+	case tea.KeyDown:
+		b.move(1)
+		return
+	case tea.KeyBackspace:
+		if rs := []rune(b.filter); len(rs) > 0 {
+			b.filter = string(rs[:len(rs)-1])
+		}
+	case tea.KeySpace:
+		b.filter += " "
+	case tea.KeyRunes:
+		b.filter += string(msg.Runes)
+	default:
+		return
+	}
+	if len(b.filter) > maxFilterLength {
+		b.filter = b.filter[:maxFilterLength]
+	}
+	b.update()
+}
+
+func (b *Bubble) move(n int) {
+	b.cursor += n
+	if b.cursor >= len(b.rows) {
+		b.cursor = len(b.rows) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	b.scroll()
+}
+
+// listHeight is the number of lines the items are shown in, leaving a line
+// for the filter if there's one.
+func (b *Bubble) listHeight() int {
+	h := b.height
+	if b.filtering || b.filter != "" {
+		h--
+	}
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// scroll keeps the cursor in view.
+func (b *Bubble) scroll() {
+	h := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.height > 0 && b.cursor >= b.offset+h {
+		b.offset = b.cursor - h + 1
+	}
+	if b.offset > len(b.rows)-h {
+		b.offset = len(b.rows) - h
+	}
+	if b.offset < 0 {
+		b.offset = 0
+	}
+}
+
+// rowOf returns the row of the item at position i of Items, or -1 if it isn't
+// shown.
+func (b *Bubble) rowOf(i int) int {
+	for r, row := range b.rows {
+		if row.item == i {
+			return r
+		}
+	}
+	return -1
+}
+
+// update filters and sorts the items again, keeping the cursor on the same
+// item if it's still shown.
+func (b *Bubble) update() {
+	sel := b.Selected()
+	rows := make([]row, 0, len(b.Items))
+	if b.filter == "" {
+		for i := range b.Items {
+			rows = append(rows, row{item: i})
+		}
+	} else {
+		matched := make(map[int]bool)
+		for _, m := range fuzzy.FindFrom(b.filter, names(b.Items)) {
+			matched[m.Index] = true
+			rows = append(rows, row{item: m.Index, matches: m.MatchedIndexes})
+		}
+		for _, m := range fuzzy.FindFrom(b.filter, notes(b.Items)) {
+			if !matched[m.Index] {
+				rows = append(rows, row{item: m.Index})
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		x, y := b.Items[rows[i].item], b.Items[rows[j].item]
+		switch b.sort {
+		case SortName:
+			return strings.ToLower(x.Name) < strings.ToLower(y.Name)
+		case SortUpdated:
+			return x.Updated.After(y.Updated)
+		case SortActivity:
+			return x.Activity > y.Activity
+		default:
+			return rows[i].item < rows[j].item
+		}
+	})
+	b.rows = rows
+	b.cursor = 0
+	for i, r := range rows {
+		if r.item == sel {
+			b.cursor = i
+		}
+	}
+	b.scroll()
+}
+
+func (b Bubble) View() string {
+	s := strings.Builder{}
+	repoNameMaxWidth := b.styles.Menu.GetWidth() - // menu width
+		b.styles.Menu.GetHorizontalPadding() - // menu padding
+		lipgloss.Width(b.styles.MenuCursor.String()) - // cursor
+		b.styles.MenuItem.GetHorizontalFrameSize() // menu item gaps
+	lines := make([]string, 0, b.height)
+	if len(b.rows) == 0 {
+		lines = append(lines, b.styles.TreeNote.Render("No matches."))
+	}
+	for i := b.offset; i < len(b.rows) && i < b.offset+b.listHeight(); i++ {
+		r := b.rows[i]
+		item := b.Items[r.item].Name
+		if lipgloss.Width(item) > repoNameMaxWidth {
+			item = truncate.StringWithTail(item, uint(repoNameMaxWidth), "…")
+		}
+		if i == b.cursor {
+			fg := lipgloss.NewStyle().Foreground(b.styles.SelectedMenuItem.GetForeground())
+			lines = append(lines, b.styles.MenuCursor.String()+
+				b.styles.SelectedMenuItem.Render(b.highlight(item, r.matches, fg)))
+		} else {
+			lines = append(lines, b.styles.MenuItem.Render(b.highlight(item, r.matches, lipgloss.NewStyle())))
+		}
+	}
+	if b.filtering || b.filter != "" {
+		for len(lines) < b.listHeight() {
+			lines = append(lines, "")
+		}
+		f := b.styles.Prompt.Render("/") + b.filter
+		if b.filtering {
+			f += "█"
+		}
+		lines = append(lines, f)
+	}
+	s.WriteString(strings.Join(lines, "\n"))
+	return s.String()
+}
+
+// highlight renders a name with the bytes matched by the filter highlighted.
+func (b Bubble) highlight(name string, matches []int, base lipgloss.Style) string {
+	if len(matches) == 0 {
+		return base.Render(name)
+	}
+	m := b.styles.MenuMatch.Copy().Inherit(base)
+	matched := make(map[int]bool, len(matches))
+	for _, i := range matches {
+		matched[i] = true
+	}
+	s := strings.Builder{}
+	for i, c := range name {
+		if matched[i] {
+			s.WriteString(m.Render(string(c)))
+		} else {
+			s.WriteString(base.Render(string(c)))
+		}
+	}
+	return s.String()
+}
+
 func (b *Bubble) sendActiveMessage() tea.Msg {
-	if b.SelectedItem >= 0 && b.SelectedItem < len(b.Items) {
+	if i := b.Selected(); i >= 0 {
 		return ActiveMsg{
-			Name:  b.Items[b.SelectedItem],
-			Index: b.SelectedItem,
+			Name:  b.Items[i].Name,
+			Index: i,
 		}
 	}
 	return nil
 }
 
 func (b *Bubble) sendSelectedMessage() tea.Msg {
-	if b.SelectedItem >= 0 && b.SelectedItem < len(b.Items) {
+	if i := b.Selected(); i >= 0 {
 		return SelectedMsg{
-			Name:  b.Items[b.SelectedItem],
-			Index: b.SelectedItem,
+			Name:  b.Items[i].Name,
+			Index: i,
 		}
 	}
 	return nil
 }
+
+// names and notes are the names and notes of the items, matched by the
+// filter.
+type names []Item
+
+func (n names) String(i int) string { return n[i].Name }
+func (n names) Len() int            { return len(n) }
+
+type notes []Item
+
+func (n notes) String(i int) string { return n[i].Note }
+func (n notes) Len() int            { return len(n) }
@@ -0,0 +1,289 @@
+package tree
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/git"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	"github.com/dustin/go-humanize"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/muesli/reflow/truncate"
+)
+
+// HelpEntry is a key binding shown in the footer.
+type HelpEntry struct {
+	Key   string
+	Value string
+}
+
+// Bubble browses the files of a repo at a ref: it lists a directory, and
+// shows a file once it's opened.
+type Bubble struct {
+	repo    *git.Repo
+	ref     string
+	styles  *style.Styles
+	width   int
+	height  int
+	dir     string
+	entries []git.TreeEntry
+	cursor  int
+	offset  int
+	// cursors are the cursor positions in the parent directories, restored
+	// when going back up.
+	cursors []int
+	// file is the path of the open file, if any.
+	file   string
+	viewer *viewer
+	err    error
+}
+
+// NewBubble returns a Bubble browsing the files of a repo at a ref, such as
+// refs/heads/main. Markdown files are rendered with md.
+func NewBubble(repo *git.Repo, ref string, styles *style.Styles, width, height int, md MarkdownFunc) *Bubble {
+	b := &Bubble{
+		repo:   repo,
+		ref:    ref,
+		styles: styles,
+		viewer: newViewer(styles),
+	}
+	b.viewer.markdown = md
+	b.SetSize(width, height)
+	return b
+}
+
+func (b *Bubble) Init() tea.Cmd {
+	b.list("")
+	return nil
+}
+
+// SetSize sets the size of the area the files are shown in.
+func (b *Bubble) SetSize(w, h int) {
+	b.width = w - b.styles.Tree.GetHorizontalFrameSize()
+	b.height = h - b.styles.Tree.GetVerticalFrameSize()
+	b.viewer.setSize(b.width, b.height-lipgloss.Height(b.breadcrumbView()))
+	b.scroll()
+}
+
+// Help returns the key bindings of the current view.
+func (b *Bubble) Help() []HelpEntry {
+	if b.file != "" {
+		return b.viewer.help()
+	}
+	return []HelpEntry{{"enter", "open"}, {"esc", "back"}}
+}
+
+func (b *Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if b.file != "" {
+			if b.viewer.update(msg) {
+				return b, nil
+			}
+			switch msg.String() {
+			case "esc", "backspace", "-":
+				b.file = ""
+			}
+			return b, nil
+		}
+		switch msg.String() {
+		case "k", "up":
+			b.move(-1)
+		case "j", "down":
+			b.move(1)
+		case "b", "pgup":
+			b.move(-b.listHeight())
+		case "f", "pgdown":
+			b.move(b.listHeight())
+		case "g", "home":
+			b.move(-len(b.entries))
+		case "G", "end":
+			b.move(len(b.entries))
+		case "enter", "l", "right":
+			b.open()
+		case "esc", "backspace", "-":
+			b.up()
+		}
+	}
+	return b, nil
+}
+
+// list shows the entries of a directory.
+func (b *Bubble) list(dir string) {
+	b.dir = dir
+	b.cursor = 0
+	b.offset = 0
+	b.entries, b.err = b.repo.Tree(b.ref, dir)
+}
+
+func (b *Bubble) move(n int) {
+	b.cursor += n
+	if b.cursor >= len(b.entries) {
+		b.cursor = len(b.entries) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	b.scroll()
+}
+
+// scroll keeps the cursor in view.
+func (b *Bubble) scroll() {
+	h := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if h > 0 && b.cursor >= b.offset+h {
+		b.offset = b.cursor - h + 1
+	}
+}
+
+// open enters the directory or opens the file under the cursor.
+func (b *Bubble) open() {
+	if b.cursor >= len(b.entries) {
+		return
+	}
+	e := b.entries[b.cursor]
+	switch {
+	case e.IsSubmodule:
+		return
+	case e.IsDir:
+		b.cursors = append(b.cursors, b.cursor)
+		b.list(e.Path)
+	default:
+		data, size, err := b.repo.ReadFile(b.ref, e.Path, maxFileSize)
+		if err != nil {
+			b.err = err
+			return
+		}
+		b.file = e.Path
+		b.viewer.setFile(e.Path, data, size)
+	}
+}
+
+// Open opens the file at a path and scrolls to a line of it, counted from 1.
+// The directories of the path are entered as if they were opened one by one,
+// so that going back up works as usual. Rendered markdown files are shown
+// from the top, since their lines don't match the source.
+func (b *Bubble) Open(p string, line int) {
+	b.file = ""
+	b.cursors = nil
+	b.list("")
+	for _, name := range strings.Split(p, "/") {
+		i := -1
+		for j, e := range b.entries {
+			if e.Name == name {
+				i = j
+			}
+		}
+		if i == -1 {
+			return
+		}
+		b.cursor = i
+		b.scroll()
+		b.open()
+	}
+	if b.file == p && b.viewer.lines != nil && line > 0 {
+		b.viewer.gotoLine(line - 1)
+	}
+}
+
+// up goes back to the parent directory.
+func (b *Bubble) up() {
+	if b.dir == "" {
+		return
+	}
+	parent := path.Dir(b.dir)
+	if parent == "." {
+		parent = ""
+	}
+	b.list(parent)
+	if n := len(b.cursors); n > 0 {
+		b.cursor = b.cursors[n-1]
+		b.cursors = b.cursors[:n-1]
+		b.move(0)
+	}
+}
+
+func (b *Bubble) listHeight() int {
+	return b.height - lipgloss.Height(b.breadcrumbView())
+}
+
+// breadcrumbView renders the ref and the path of the current directory or
+// file.
+func (b *Bubble) breadcrumbView() string {
+	p := b.dir
+	if b.file != "" {
+		p = b.file
+	}
+	parts := []string{b.styles.BreadcrumbRef.Render(plumbing.ReferenceName(b.ref).Short())}
+	if p != "" {
+		for _, d := range strings.Split(p, "/") {
+			parts = append(parts, b.styles.Breadcrumb.Render(Sanitize(d)))
+		}
+	}
+	s := strings.Join(parts, b.styles.BreadcrumbSeparator.String())
+	return b.styles.Breadcrumbs.Render(truncate.StringWithTail(s, uint(b.width), "…"))
+}
+
+func (b *Bubble) View() string {
+	s := &strings.Builder{}
+	s.WriteString(b.breadcrumbView())
+	s.WriteRune('\n')
+	switch {
+	case b.err != nil && b.err == plumbing.ErrReferenceNotFound:
+		s.WriteString(b.styles.TreeNote.Render("No files yet."))
+	case b.err != nil:
+		s.WriteString(b.styles.TreeNote.Render(fmt.Sprintf("Error: %s", b.err)))
+	case b.file != "":
+		s.WriteString(b.viewer.view())
+	case len(b.entries) == 0:
+		s.WriteString(b.styles.TreeNote.Render("This directory is empty."))
+	default:
+		s.WriteString(b.listView())
+	}
+	return b.styles.Tree.Render(s.String())
+}
+
+func (b *Bubble) listView() string {
+	cursor := b.styles.MenuCursor.String()
+	cw := lipgloss.Width(cursor)
+	lines := make([]string, 0, b.listHeight())
+	for i := b.offset; i < len(b.entries) && i < b.offset+b.listHeight(); i++ {
+		e := b.entries[i]
+		var size string
+		if !e.IsDir && !e.IsSubmodule {
+			size = humanize.Bytes(uint64(e.Size))
+		}
+		nw := b.width - cw - 1 - len(size) - 1
+		if nw < 1 {
+			nw = 1
+		}
+		name := Sanitize(e.Name)
+		ns := b.styles.TreeFile
+		switch {
+		case e.IsDir:
+			name += "/"
+			ns = b.styles.TreeDir
+		case e.IsSubmodule:
+			name += " @"
+			ns = b.styles.TreeDir
+		}
+		name = truncate.StringWithTail(name, uint(nw), "…")
+		prefix := strings.Repeat(" ", cw)
+		if i == b.cursor {
+			prefix = cursor
+			ns = b.styles.TreeSelected
+		}
+		l := prefix + " " + ns.Render(name)
+		pad := b.width - lipgloss.Width(l) - len(size)
+		if pad < 1 {
+			pad = 1
+		}
+		lines = append(lines, l+strings.Repeat(" ", pad)+b.styles.TreeSize.Render(size))
+	}
+	return strings.Join(lines, "\n")
+}
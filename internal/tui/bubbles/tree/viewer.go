@@ -0,0 +1,458 @@
+package tree
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+	"github.com/dustin/go-humanize"
+	"github.com/mattn/go-runewidth"
+)
+
+// maxFileSize is the size of the largest file that's shown.
+const maxFileSize = 1 << 20
+
+// maxHighlightSize is the size of the largest file that's highlighted, as
+// highlighting takes a while.
+const maxHighlightSize = 256 << 10
+
+// binarySniffSize is how much of a file is checked for NUL bytes to tell
+// whether it's binary, like git does.
+const binarySniffSize = 8000
+
+// tabWidth is the number of spaces tabs are expanded to.
+const tabWidth = 4
+
+// scrollWidth is the number of columns scrolled horizontally at once.
+const scrollWidth = 8
+
+// interpreterLexers maps interpreters found in shebangs to the lexers of their
+// language, where their names differ.
+var interpreterLexers = map[string]string{
+	"node": "javascript",
+	"sh":   "bash",
+	"dash": "bash",
+	"ash":  "bash",
+	"zsh":  "bash",
+}
+
+// MarkdownFunc renders markdown to fit the given width.
+type MarkdownFunc func(md string, width int) (string, error)
+
+// row is a row of the viewer: a line of the file, or a part of it when lines
+// are wrapped.
+type row struct {
+	line int
+	col  int
+}
+
+// viewer shows a file with syntax highlighting and line numbers. Markdown
+// files are rendered instead, and binary and large files are replaced by a
+// placeholder.
+type viewer struct {
+	styles   *style.Styles
+	markdown MarkdownFunc
+	width    int
+	height   int
+	// lines are the tokens of the lines of a source file.
+	lines [][]chroma.Token
+	// md is the source of a markdown file, and rendered its lines.
+	md          string
+	rendered    []string
+	placeholder string
+	wrap        bool
+	rows        []row
+	// x is the first column shown when lines aren't wrapped, and y the first
+	// row shown.
+	x int
+	y int
+	// prompting is set while the line to go to is typed into prompt.
+	prompting bool
+	prompt    string
+}
+
+func newViewer(styles *style.Styles) *viewer {
+	return &viewer{styles: styles}
+}
+
+// setFile shows a file. data is up to maxFileSize bytes of the file and size
+// its full size.
+func (v *viewer) setFile(name string, data []byte, size int64) {
+	*v = viewer{
+		styles:   v.styles,
+		markdown: v.markdown,
+		width:    v.width,
+		height:   v.height,
+		wrap:     v.wrap,
+	}
+	sniff := data
+	if len(sniff) > binarySniffSize {
+		sniff = sniff[:binarySniffSize]
+	}
+	switch {
+	case bytes.IndexByte(sniff, 0) >= 0:
+		v.placeholder = fmt.Sprintf("This is a binary file of %s.", humanize.Bytes(uint64(size)))
+	case size > maxFileSize:
+		v.placeholder = fmt.Sprintf("This file is too large to show (%s).", humanize.Bytes(uint64(size)))
+	case isMarkdown(name) && v.markdown != nil:
+		v.md = string(data)
+	default:
+		v.lines = highlight(name, Sanitize(string(data)), size <= maxHighlightSize)
+	}
+	v.layout()
+}
+
+func isMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return true
+	}
+	return false
+}
+
+// Sanitize makes text safe to print on a terminal: tabs are expanded, and
+// control characters and invalid UTF-8 replaced.
+func Sanitize(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\t", strings.Repeat(" ", tabWidth))
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return '�'
+		}
+		return r
+	}, s)
+}
+
+// highlight splits text into lines of tokens, highlighted by the lexer of its
+// file name or shebang if hl is set.
+func highlight(name string, text string, hl bool) [][]chroma.Token {
+	var l chroma.Lexer
+	if hl {
+		l = lexerFor(name, text)
+	}
+	if l == nil {
+		l = lexers.Fallback
+	}
+	it, err := chroma.Coalesce(l).Tokenise(nil, text)
+	if err != nil {
+		it, _ = lexers.Fallback.Tokenise(nil, text)
+	}
+	lines := chroma.SplitTokensIntoLines(it.Tokens())
+	if len(lines) == 0 {
+		lines = [][]chroma.Token{nil}
+	}
+	return lines
+}
+
+// lexerFor returns the lexer of a file, found by its name or its shebang, or
+// nil if there's none.
+func lexerFor(name string, text string) chroma.Lexer {
+	if l := lexers.Match(path.Base(name)); l != nil {
+		return l
+	}
+	if !strings.HasPrefix(text, "#!") {
+		return nil
+	}
+	first := strings.SplitN(text, "\n", 2)[0]
+	fs := strings.Fields(strings.TrimPrefix(first, "#!"))
+	if len(fs) == 0 {
+		return nil
+	}
+	interp := path.Base(fs[0])
+	if interp == "env" {
+		interp = ""
+		for _, f := range fs[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interp = f
+				break
+			}
+		}
+	}
+	// Versioned interpreters, such as python3 or ruby2.7, go by the name of
+	// their language.
+	for _, n := range []string{interp, strings.TrimRight(interp, "0123456789.")} {
+		if ln, ok := interpreterLexers[n]; ok {
+			n = ln
+		}
+		if n == "" {
+			continue
+		}
+		if l := lexers.Get(n); l != nil {
+			return l
+		}
+	}
+	return nil
+}
+
+func (v *viewer) setSize(w, h int) {
+	v.width = w
+	v.height = h
+	v.layout()
+}
+
+// gutterWidth is the width of the line numbers.
+func (v *viewer) gutterWidth() int {
+	if v.lines == nil {
+		return 0
+	}
+	return len(strconv.Itoa(len(v.lines))) + 2
+}
+
+// textWidth is the width the lines are shown in.
+func (v *viewer) textWidth() int {
+	w := v.width - v.gutterWidth()
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// viewHeight is the number of rows shown.
+func (v *viewer) viewHeight() int {
+	h := v.height
+	if v.prompting {
+		h--
+	}
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// layout splits the lines into rows, wrapping them if wrap is set.
+func (v *viewer) layout() {
+	top := v.topLine()
+	v.rows = v.rows[:0]
+	if v.md != "" {
+		v.rendered = nil
+		md, err := v.markdown(v.md, v.width)
+		if err != nil {
+			md = v.md
+		}
+		v.rendered = strings.Split(strings.TrimRight(md, "\n"), "\n")
+		for i := range v.rendered {
+			v.rows = append(v.rows, row{line: i})
+		}
+	}
+	tw := v.textWidth()
+	for i, l := range v.lines {
+		v.rows = append(v.rows, row{line: i})
+		if !v.wrap {
+			continue
+		}
+		w := lineWidth(l)
+		for c := tw; c < w; c += tw {
+			v.rows = append(v.rows, row{line: i, col: c})
+		}
+	}
+	v.gotoLine(top)
+}
+
+// topLine returns the line shown at the top.
+func (v *viewer) topLine() int {
+	if v.y < len(v.rows) {
+		return v.rows[v.y].line
+	}
+	return 0
+}
+
+// gotoLine scrolls to the first row of a line, counted from 0.
+func (v *viewer) gotoLine(line int) {
+	v.y = 0
+	for i, r := range v.rows {
+		if r.line >= line {
+			v.y = i
+			break
+		}
+	}
+	v.scroll(0)
+}
+
+func (v *viewer) scroll(n int) {
+	v.y += n
+	if max := len(v.rows) - v.viewHeight(); v.y > max {
+		v.y = max
+	}
+	if v.y < 0 {
+		v.y = 0
+	}
+}
+
+// help returns the key bindings of the viewer.
+func (v *viewer) help() []HelpEntry {
+	if v.prompting {
+		return []HelpEntry{{"enter", "go"}, {"esc", "cancel"}}
+	}
+	if v.lines == nil {
+		return []HelpEntry{{"f/b", "pgdown/pgup"}, {"esc", "back"}}
+	}
+	h := []HelpEntry{{"f/b", "pgdown/pgup"}, {":", "go to line"}, {"w", "wrap"}}
+	if !v.wrap {
+		h = append(h, HelpEntry{"</>", "scroll"})
+	}
+	return append(h, HelpEntry{"esc", "back"})
+}
+
+// update handles a key press, and reports whether it was used.
+func (v *viewer) update(msg tea.KeyMsg) bool {
+	k := msg.String()
+	if v.prompting {
+		switch {
+		case k == "esc":
+			v.prompting = false
+		case k == "enter":
+			v.prompting = false
+			if n, err := strconv.Atoi(v.prompt); err == nil && n > 0 {
+				v.gotoLine(n - 1)
+			}
+		case k == "backspace":
+			if v.prompt != "" {
+				v.prompt = v.prompt[:len(v.prompt)-1]
+			}
+		case len(k) == 1 && k[0] >= '0' && k[0] <= '9':
+			if len(v.prompt) < 9 {
+				v.prompt += k
+			}
+		}
+		return true
+	}
+	switch k {
+	case "k", "up":
+		v.scroll(-1)
+	case "j", "down":
+		v.scroll(1)
+	case "b", "pgup":
+		v.scroll(-v.viewHeight())
+	case "f", "pgdown", " ":
+		v.scroll(v.viewHeight())
+	case "u", "ctrl+u":
+		v.scroll(-v.viewHeight() / 2)
+	case "d", "ctrl+d":
+		v.scroll(v.viewHeight() / 2)
+	case "g", "home":
+		v.scroll(-len(v.rows))
+	case "G", "end":
+		v.scroll(len(v.rows))
+	case "<":
+		if !v.wrap && v.x > 0 {
+			v.x -= scrollWidth
+		}
+	case ">":
+		if !v.wrap && v.x+v.textWidth() < v.maxLineWidth() {
+			v.x += scrollWidth
+		}
+	case "w":
+		if v.lines != nil {
+			v.wrap = !v.wrap
+			v.x = 0
+			v.layout()
+		}
+	case ":":
+		if v.lines != nil {
+			v.prompting = true
+			v.prompt = ""
+			v.scroll(0)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// maxLineWidth is the width of the longest line.
+func (v *viewer) maxLineWidth() int {
+	max := 0
+	for _, l := range v.lines {
+		if w := lineWidth(l); w > max {
+			max = w
+		}
+	}
+	return max
+}
+
+func (v *viewer) view() string {
+	if v.placeholder != "" {
+		return v.styles.TreeNote.Render(v.placeholder)
+	}
+	s := &strings.Builder{}
+	for i := v.y; i < len(v.rows) && i < v.y+v.viewHeight(); i++ {
+		if i > v.y {
+			s.WriteRune('\n')
+		}
+		r := v.rows[i]
+		if v.rendered != nil {
+			s.WriteString(v.rendered[r.line])
+			continue
+		}
+		num := ""
+		if r.col == 0 {
+			num = strconv.Itoa(r.line + 1)
+		}
+		s.WriteString(v.styles.LineNumber.Render(fmt.Sprintf("%*s", v.gutterWidth()-2, num)))
+		s.WriteString("  ")
+		from := r.col
+		if !v.wrap {
+			from = v.x
+		}
+		s.WriteString(format(cut(v.lines[r.line], from, v.textWidth()), v.styles.Syntax))
+	}
+	if v.prompting {
+		s.WriteRune('\n')
+		s.WriteString(v.styles.Prompt.Render("Go to line: "))
+		s.WriteString(v.prompt + "█")
+	}
+	return s.String()
+}
+
+// lineWidth returns the width of a line of tokens.
+func lineWidth(line []chroma.Token) int {
+	w := 0
+	for _, t := range line {
+		w += runewidth.StringWidth(strings.TrimSuffix(t.Value, "\n"))
+	}
+	return w
+}
+
+// cut returns the part of a line of tokens between the columns from and
+// from+width.
+func cut(line []chroma.Token, from, width int) []chroma.Token {
+	out := make([]chroma.Token, 0, len(line))
+	col := 0
+	for _, t := range line {
+		sb := &strings.Builder{}
+		for _, r := range strings.TrimSuffix(t.Value, "\n") {
+			w := runewidth.RuneWidth(r)
+			if col >= from && col+w <= from+width {
+				sb.WriteRune(r)
+			}
+			col += w
+		}
+		if sb.Len() > 0 {
+			out = append(out, chroma.Token{Type: t.Type, Value: sb.String()})
+		}
+		if col >= from+width {
+			break
+		}
+	}
+	return out
+}
+
+// format highlights tokens for the terminal with a Chroma style.
+func format(tokens []chroma.Token, style string) string {
+	s := &strings.Builder{}
+	err := formatters.TTY256.Format(s, styles.Get(style), chroma.Literator(tokens...))
+	if err != nil {
+		return ""
+	}
+	return s.String()
+}
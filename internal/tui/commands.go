@@ -2,21 +2,40 @@ package tui
 
 import (
 	"fmt"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/events"
 	br "github.com/charmbracelet/soft-serve/internal/tui/bubbles/repo"
 	"github.com/charmbracelet/soft-serve/internal/tui/bubbles/selection"
 	gm "github.com/charmbracelet/wish/git"
 )
 
+// activityPeriod is how far back commits count towards how active a repo is.
+const activityPeriod = 30 * 24 * time.Hour
+
 type errMsg struct{ err error }
 
 func (e errMsg) Error() string {
 	return e.err.Error()
 }
 
+// eventMsg is sent when repos or the configuration change.
+type eventMsg []events.Event
+
+// waitEvent waits for the next events, until the session ends.
+func (b *Bubble) waitEvent() tea.Msg {
+	select {
+	case <-b.events.C:
+		return eventMsg(b.events.Events())
+	case <-b.session.Context().Done():
+		b.events.Close()
+		return nil
+	}
+}
+
 func (b *Bubble) setupCmd() tea.Msg {
 	if b.config == nil || b.config.Source == nil {
 		return errMsg{err: fmt.Errorf("config not set")}
@@ -29,11 +48,8 @@ func (b *Bubble) setupCmd() tea.Msg {
 		return errMsg{fmt.Errorf("no repos found")}
 	}
 	b.repoMenu = mes
-	rs := make([]string, 0)
-	for _, m := range mes {
-		rs = append(rs, m.Name)
-	}
-	b.repoSelect = selection.NewBubble(rs, b.styles)
+	b.repoSelect = selection.NewBubble(b.menuItems(mes), b.styles)
+	b.repoSelect.SetHeight(b.menuHeight())
 	b.boxes[0] = b.repoSelect
 
 	// Jump to an initial repo
@@ -50,7 +66,7 @@ func (b *Bubble) setupCmd() tea.Msg {
 		b.activeBox = 0
 	} else {
 		b.boxes[1] = b.repoMenu[ir].bubble
-		b.repoSelect.SelectedItem = ir
+		b.repoSelect.Select(ir)
 		b.activeBox = 1
 	}
 
@@ -58,6 +74,86 @@ func (b *Bubble) setupCmd() tea.Msg {
 	return nil
 }
 
+// refresh updates the menu and the repos after an event. A reload takes a new
+// snapshot of the config, which can change the repos in the menu, and reads
+// every repo again. Otherwise only the repo of the event is read again. The
+// selected repo stays selected, unless it's gone from the menu.
+func (b *Bubble) refresh(e events.Event) error {
+	if e.Type == events.Reload {
+		b.config = b.live.Snapshot()
+		// The bubbles share the styles, so the new theme applies to all of
+		// them.
+		*b.styles = *themeStyles(b.config.Theme, b.session.Environ(), b.background)
+	}
+	var cur string
+	if i := b.repoSelect.Selected(); i >= 0 && i < len(b.repoMenu) {
+		cur = b.repoMenu[i].Repo
+	}
+	kept := make(map[string]struct{})
+	for _, me := range b.repoMenu {
+		kept[me.Repo] = struct{}{}
+	}
+	mes, err := b.menuEntriesFromSource()
+	if err != nil {
+		return err
+	}
+	if len(mes) == 0 {
+		return fmt.Errorf("no repos found")
+	}
+	for _, me := range mes {
+		if _, ok := kept[me.Repo]; !ok || (e.Type != events.Reload && me.Repo != e.Repo) {
+			continue
+		}
+		rb := me.bubble
+		rb.Host = b.config.Host
+		rb.Port = b.config.Port
+		rb.SetBrowsable(b.readable(me.Repo))
+		if me.Repo == "config" {
+			rb.SetTemplate(b.config)
+		}
+		err = rb.Refresh()
+		if err != nil {
+			return err
+		}
+	}
+	b.repoMenu = mes
+	b.repoSelect.SetItems(b.menuItems(mes))
+	sel := -1
+	for i, me := range mes {
+		if me.Repo == cur {
+			sel = i
+		}
+	}
+	if sel == -1 {
+		sel = b.repoSelect.Selected()
+		b.activeBox = 0
+	}
+	if sel == -1 {
+		sel = 0
+	}
+	b.repoSelect.Select(sel)
+	b.boxes[1] = mes[sel].bubble
+	return nil
+}
+
+// menuItems returns the items of the menu, with what they're sorted by.
+func (b *Bubble) menuItems(mes []MenuEntry) []selection.Item {
+	since := time.Now().Add(-activityPeriod)
+	items := make([]selection.Item, 0, len(mes))
+	for _, me := range mes {
+		it := selection.Item{
+			Name:     me.Name,
+			Note:     me.Note,
+			Activity: b.config.Source.CommitsSince(me.Repo, since),
+		}
+		if r, err := b.config.Source.GetRepo(me.Repo); err == nil && r.LastUpdated != nil {
+			it.Updated = *r.LastUpdated
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
 func (b *Bubble) menuEntriesFromSource() ([]MenuEntry, error) {
 	mes := make([]MenuEntry, 0)
 	for _, cr := range b.config.Repos {
@@ -69,6 +165,7 @@ func (b *Bubble) menuEntriesFromSource() ([]MenuEntry, error) {
 		if err != nil {
 			return nil, err
 		}
+		me.Note = cr.Note
 		mes = append(mes, me)
 	}
 	for _, r := range b.config.Source.AllRepos() {
@@ -93,12 +190,26 @@ func (b *Bubble) menuEntriesFromSource() ([]MenuEntry, error) {
 	return mes, nil
 }
 
+// readable reports whether the user of the session can read a repo. Every
+// repo in the menu is readable but the config repo, which is always there.
+func (b *Bubble) readable(repo string) bool {
+	return b.config.AuthRepo(repo, b.session.PublicKey()) >= gm.ReadOnlyAccess
+}
+
 func (b *Bubble) newMenuEntry(name string, repo string) (MenuEntry, error) {
 	var tmplConfig *config.Config
 	if repo == "config" {
 		tmplConfig = b.config
 	}
 	me := MenuEntry{Name: name, Repo: repo}
+	// Repos already in the menu keep their bubble, and with it the tab and
+	// ref they're shown at.
+	for _, o := range b.repoMenu {
+		if o.Repo == repo {
+			me.bubble = o.bubble
+			return me, nil
+		}
+	}
 	width := b.width
 	boxLeftWidth := b.styles.Menu.GetWidth() + b.styles.Menu.GetHorizontalFrameSize()
 	// TODO: also send this along with a tea.WindowSizeMsg
@@ -118,6 +229,10 @@ func (b *Bubble) newMenuEntry(name string, repo string) (MenuEntry, error) {
 	)
 	rb.Host = b.config.Host
 	rb.Port = b.config.Port
+	rb.SetBrowsable(b.readable(repo))
+	if repo == "config" {
+		rb.SetHome(b.activity, b.search)
+	}
 	initCmd := rb.Init()
 	msg := initCmd()
 	switch msg := msg.(type) {
@@ -2,12 +2,50 @@ package tui
 
 import (
 	"fmt"
+	"log"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/wish"
 	"github.com/gliderlabs/ssh"
+	"github.com/muesli/termenv"
 )
 
+// Middleware runs the TUI in the sessions that have a pty and no command
+// other than a repo name, like the wish bubbletea middleware with the 256
+// color profile. Before the TUI starts, the terminal of the client is asked
+// for its background, which the input of the session has to be read for, so
+// the TUI reads the input through what's left of it.
+func Middleware(cfg *config.Config) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		lipgloss.SetColorProfile(termenv.ANSI256)
+		return func(s ssh.Session) {
+			m, opts := SessionHandler(cfg)(s)
+			if m != nil {
+				p := tea.NewProgram(m, opts...)
+				_, windowChanges, _ := s.Pty()
+				go func() {
+					for {
+						select {
+						case <-s.Context().Done():
+							p.Quit()
+							return
+						case w := <-windowChanges:
+							p.Send(tea.WindowSizeMsg{Width: w.Width, Height: w.Height})
+						}
+					}
+				}()
+				err := p.Start()
+				if err != nil {
+					log.Print(err)
+				}
+			}
+			sh(s)
+		}
+	}
+}
+
 func SessionHandler(cfg *config.Config) func(ssh.Session) (tea.Model, []tea.ProgramOption) {
 	return func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 		cmd := s.Command()
@@ -27,9 +65,17 @@ func SessionHandler(cfg *config.Config) func(ssh.Session) (tea.Model, []tea.Prog
 		}
 		scfg.Width = pty.Window.Width
 		scfg.Height = pty.Window.Height
+		in := newSessionInput(s.Context(), s)
+		if needsBackground(s.Environ()) {
+			scfg.Background = queryBackground(s, in)
+		}
 		if cfg.Cfg.Callbacks != nil {
 			cfg.Cfg.Callbacks.Tui("view")
 		}
-		return NewBubble(cfg, scfg), []tea.ProgramOption{tea.WithAltScreen()}
+		return NewBubble(cfg, scfg), []tea.ProgramOption{
+			tea.WithAltScreen(),
+			tea.WithInput(in),
+			tea.WithOutput(s),
+		}
 	}
 }
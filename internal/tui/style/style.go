@@ -1,6 +1,8 @@
 package style
 
 import (
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/ansi"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -19,17 +21,51 @@ type Styles struct {
 	MenuCursor       lipgloss.Style
 	MenuItem         lipgloss.Style
 	SelectedMenuItem lipgloss.Style
+	MenuMatch        lipgloss.Style
 
 	RepoTitleBorder lipgloss.Border
 	RepoNoteBorder  lipgloss.Border
 	RepoBodyBorder  lipgloss.Border
 
 	RepoTitle    lipgloss.Style
+	RepoSize     lipgloss.Style
 	RepoTitleBox lipgloss.Style
 	RepoNote     lipgloss.Style
 	RepoNoteBox  lipgloss.Style
 	RepoBody     lipgloss.Style
 
+	RepoTabs       lipgloss.Style
+	RepoTab        lipgloss.Style
+	ActiveRepoTab  lipgloss.Style
+	RepoTabDivider lipgloss.Style
+
+	Breadcrumbs         lipgloss.Style
+	Breadcrumb          lipgloss.Style
+	BreadcrumbRef       lipgloss.Style
+	BreadcrumbSeparator lipgloss.Style
+
+	Tree         lipgloss.Style
+	TreeDir      lipgloss.Style
+	TreeFile     lipgloss.Style
+	TreeSelected lipgloss.Style
+	TreeSize     lipgloss.Style
+	TreeNote     lipgloss.Style
+	LineNumber   lipgloss.Style
+	Prompt       lipgloss.Style
+
+	LogHash   lipgloss.Style
+	LogAuthor lipgloss.Style
+	LogDate   lipgloss.Style
+
+	DiffFile   lipgloss.Style
+	DiffHunk   lipgloss.Style
+	DiffAdd    lipgloss.Style
+	DiffDelete lipgloss.Style
+
+	RefHeading lipgloss.Style
+	RefDefault lipgloss.Style
+	RefCurrent lipgloss.Style
+
 	Footer      lipgloss.Style
 	HelpKey     lipgloss.Style
 	HelpValue   lipgloss.Style
@@ -38,84 +74,209 @@ type Styles struct {
 	Error      lipgloss.Style
 	ErrorTitle lipgloss.Style
 	ErrorBody  lipgloss.Style
+
+	// Markdown is the Glamour style READMEs are rendered with, and Syntax the
+	// name of the Chroma style files are highlighted with.
+	Markdown ansi.StyleConfig
+	Syntax   string
+}
+
+// Palette is the colors of the TUI. Colors are ANSI 256 color numbers, such as
+// 62, or hex colors, such as #5f5fd7.
+type Palette struct {
+	// Accent is the color of the header and of the border of the active box,
+	// and Border the one of the other boxes.
+	Accent lipgloss.Color
+	Border lipgloss.Color
+	// Cursor is the color of the cursor, and Selected the one of the item
+	// under it, the active tab and the prompts.
+	Cursor   lipgloss.Color
+	Selected lipgloss.Color
+	// Text is the color of text that stands out, Muted the one of secondary
+	// text such as notes and sizes, and Faint the one of line numbers and help.
+	Text    lipgloss.Color
+	Muted   lipgloss.Color
+	Faint   lipgloss.Color
+	Divider lipgloss.Color
+	// Note is the color of the clone command and refs.
+	Note      lipgloss.Color
+	Directory lipgloss.Color
+	Hash      lipgloss.Color
+	Author    lipgloss.Color
+	Hunk      lipgloss.Color
+	Added     lipgloss.Color
+	Deleted   lipgloss.Color
+	Error     lipgloss.Color
+	// Markdown is the Glamour style READMEs are rendered with: dark, light,
+	// notty or ascii. Syntax is the Chroma style files are highlighted with,
+	// such as monokai or github.
+	Markdown string
+	Syntax   string
+}
+
+// DarkPalette is the palette for terminals with a dark background.
+var DarkPalette = Palette{
+	Accent:    lipgloss.Color("62"),
+	Border:    lipgloss.Color("236"),
+	Cursor:    lipgloss.Color("213"),
+	Selected:  lipgloss.Color("207"),
+	Text:      lipgloss.Color("252"),
+	Muted:     lipgloss.Color("241"),
+	Faint:     lipgloss.Color("239"),
+	Divider:   lipgloss.Color("237"),
+	Note:      lipgloss.Color("168"),
+	Directory: lipgloss.Color("39"),
+	Hash:      lipgloss.Color("179"),
+	Author:    lipgloss.Color("246"),
+	Hunk:      lipgloss.Color("75"),
+	Added:     lipgloss.Color("42"),
+	Deleted:   lipgloss.Color("203"),
+	Error:     lipgloss.Color("204"),
+	Markdown:  "dark",
+	Syntax:    "monokai",
+}
+
+// LightPalette is the palette for terminals with a light background.
+var LightPalette = Palette{
+	Accent:    lipgloss.Color("62"),
+	Border:    lipgloss.Color("250"),
+	Cursor:    lipgloss.Color("199"),
+	Selected:  lipgloss.Color("163"),
+	Text:      lipgloss.Color("235"),
+	Muted:     lipgloss.Color("243"),
+	Faint:     lipgloss.Color("246"),
+	Divider:   lipgloss.Color("251"),
+	Note:      lipgloss.Color("161"),
+	Directory: lipgloss.Color("25"),
+	Hash:      lipgloss.Color("130"),
+	Author:    lipgloss.Color("240"),
+	Hunk:      lipgloss.Color("31"),
+	Added:     lipgloss.Color("28"),
+	Deleted:   lipgloss.Color("160"),
+	Error:     lipgloss.Color("204"),
+	Markdown:  "light",
+	Syntax:    "github",
+}
+
+// borderSet is the box-drawing characters of a border style. Junctions join
+// the boxes of the repo: top is ┬, bottom ┴, left ├ and right ┤.
+type borderSet struct {
+	horizontal, vertical                                     string
+	topLeft, topRight, bottomLeft, bottomRight               string
+	junctionTop, junctionBottom, junctionLeft, junctionRight string
+}
+
+// borderSets are the border styles, by name.
+var borderSets = map[string]borderSet{
+	"rounded": {"─", "│", "╭", "╮", "╰", "╯", "┬", "┴", "├", "┤"},
+	"normal":  {"─", "│", "┌", "┐", "└", "┘", "┬", "┴", "├", "┤"},
+	"thick":   {"━", "┃", "┏", "┓", "┗", "┛", "┳", "┻", "┣", "┫"},
+	"double":  {"═", "║", "╔", "╗", "╚", "╝", "╦", "╩", "╠", "╣"},
 }
 
 // DefaultStyles returns default styles for the TUI.
 func DefaultStyles() *Styles {
+	return NewStyles(DarkPalette, "rounded")
+}
+
+// NewStyles returns the styles of the TUI with the colors of p and a border
+// style: rounded, normal, thick or double. Unknown borders are rounded.
+func NewStyles(p Palette, border string) *Styles {
 	s := new(Styles)
+	bs, ok := borderSets[border]
+	if !ok {
+		bs = borderSets["rounded"]
+	}
 
-	s.ActiveBorderColor = lipgloss.Color("62")
-	s.InactiveBorderColor = lipgloss.Color("236")
+	s.ActiveBorderColor = p.Accent
+	s.InactiveBorderColor = p.Border
 
 	s.App = lipgloss.NewStyle().
 		Margin(1, 2)
 
 	s.Header = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("62")).
+		Foreground(p.Accent).
 		Align(lipgloss.Right).
 		Bold(true)
 
 	s.Menu = lipgloss.NewStyle().
-		BorderStyle(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.Border{
+			Top:         bs.horizontal,
+			Bottom:      bs.horizontal,
+			Left:        bs.vertical,
+			Right:       bs.vertical,
+			TopLeft:     bs.topLeft,
+			TopRight:    bs.topRight,
+			BottomLeft:  bs.bottomLeft,
+			BottomRight: bs.bottomRight,
+		}).
 		BorderForeground(s.InactiveBorderColor).
 		Padding(1, 2).
 		MarginRight(1).
 		Width(24)
 
 	s.MenuCursor = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("213")).
+		Foreground(p.Cursor).
 		SetString(">")
 
 	s.MenuItem = lipgloss.NewStyle().
 		PaddingLeft(2)
 
 	s.SelectedMenuItem = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("207")).
+		Foreground(p.Selected).
 		PaddingLeft(1)
 
+	s.MenuMatch = lipgloss.NewStyle().
+		Bold(true).
+		Underline(true)
+
 	s.RepoTitleBorder = lipgloss.Border{
-		Top:         "─",
-		Bottom:      "─",
-		Left:        "│",
-		Right:       "│",
-		TopLeft:     "╭",
-		TopRight:    "┬",
-		BottomLeft:  "├",
-		BottomRight: "┴",
+		Top:         bs.horizontal,
+		Bottom:      bs.horizontal,
+		Left:        bs.vertical,
+		Right:       bs.vertical,
+		TopLeft:     bs.topLeft,
+		TopRight:    bs.junctionTop,
+		BottomLeft:  bs.junctionLeft,
+		BottomRight: bs.junctionBottom,
 	}
 
 	s.RepoNoteBorder = lipgloss.Border{
-		Top:         "─",
-		Bottom:      "─",
-		Left:        "│",
-		Right:       "│",
-		TopLeft:     "┬",
-		TopRight:    "╮",
-		BottomLeft:  "┴",
-		BottomRight: "┤",
+		Top:         bs.horizontal,
+		Bottom:      bs.horizontal,
+		Left:        bs.vertical,
+		Right:       bs.vertical,
+		TopLeft:     bs.junctionTop,
+		TopRight:    bs.topRight,
+		BottomLeft:  bs.junctionBottom,
+		BottomRight: bs.junctionRight,
 	}
 
 	s.RepoBodyBorder = lipgloss.Border{
 		Top:         "",
-		Bottom:      "─",
-		Left:        "│",
-		Right:       "│",
+		Bottom:      bs.horizontal,
+		Left:        bs.vertical,
+		Right:       bs.vertical,
 		TopLeft:     "",
 		TopRight:    "",
-		BottomLeft:  "╰",
-		BottomRight: "╯",
+		BottomLeft:  bs.bottomLeft,
+		BottomRight: bs.bottomRight,
 	}
 
 	s.RepoTitle = lipgloss.NewStyle().
 		Padding(0, 2)
 
+	s.RepoSize = lipgloss.NewStyle().
+		Foreground(p.Muted).
+		PaddingRight(2)
+
 	s.RepoTitleBox = lipgloss.NewStyle().
 		BorderStyle(s.RepoTitleBorder).
 		BorderForeground(s.InactiveBorderColor)
 
 	s.RepoNote = lipgloss.NewStyle().
 		Padding(0, 2).
-		Foreground(lipgloss.Color("168"))
+		Foreground(p.Note)
 
 	s.RepoNoteBox = lipgloss.NewStyle().
 		BorderStyle(s.RepoNoteBorder).
@@ -130,17 +291,100 @@ func DefaultStyles() *Styles {
 		BorderForeground(s.InactiveBorderColor).
 		PaddingRight(1)
 
+	s.RepoTabs = lipgloss.NewStyle().
+		Padding(0, 2).
+		MarginBottom(1)
+
+	s.RepoTab = lipgloss.NewStyle().
+		Foreground(p.Muted)
+
+	s.ActiveRepoTab = lipgloss.NewStyle().
+		Foreground(p.Selected).
+		Bold(true)
+
+	s.RepoTabDivider = lipgloss.NewStyle().
+		Foreground(p.Divider).
+		SetString(" │ ")
+
+	s.Breadcrumbs = lipgloss.NewStyle().
+		MarginBottom(1)
+
+	s.Breadcrumb = lipgloss.NewStyle().
+		Foreground(p.Text)
+
+	s.BreadcrumbRef = lipgloss.NewStyle().
+		Foreground(p.Note)
+
+	s.BreadcrumbSeparator = lipgloss.NewStyle().
+		Foreground(p.Muted).
+		SetString(" / ")
+
+	s.Tree = lipgloss.NewStyle().
+		Padding(0, 2)
+
+	s.TreeDir = lipgloss.NewStyle().
+		Foreground(p.Directory)
+
+	s.TreeFile = lipgloss.NewStyle()
+
+	s.TreeSelected = lipgloss.NewStyle().
+		Foreground(p.Selected)
+
+	s.TreeSize = lipgloss.NewStyle().
+		Foreground(p.Muted)
+
+	s.TreeNote = lipgloss.NewStyle().
+		Foreground(p.Muted)
+
+	s.LineNumber = lipgloss.NewStyle().
+		Foreground(p.Faint)
+
+	s.Prompt = lipgloss.NewStyle().
+		Foreground(p.Selected)
+
+	s.LogHash = lipgloss.NewStyle().
+		Foreground(p.Hash)
+
+	s.LogAuthor = lipgloss.NewStyle().
+		Foreground(p.Author)
+
+	s.LogDate = lipgloss.NewStyle().
+		Foreground(p.Muted)
+
+	s.DiffFile = lipgloss.NewStyle().
+		Foreground(p.Text).
+		Bold(true)
+
+	s.DiffHunk = lipgloss.NewStyle().
+		Foreground(p.Hunk)
+
+	s.DiffAdd = lipgloss.NewStyle().
+		Foreground(p.Added)
+
+	s.DiffDelete = lipgloss.NewStyle().
+		Foreground(p.Deleted)
+
+	s.RefHeading = lipgloss.NewStyle().
+		Foreground(p.Muted).
+		Bold(true)
+
+	s.RefDefault = lipgloss.NewStyle().
+		Foreground(p.Added)
+
+	s.RefCurrent = lipgloss.NewStyle().
+		Foreground(p.Selected)
+
 	s.Footer = lipgloss.NewStyle().
 		MarginTop(1)
 
 	s.HelpKey = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("241"))
+		Foreground(p.Muted)
 
 	s.HelpValue = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("239"))
+		Foreground(p.Faint)
 
 	s.HelpDivider = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("237")).
+		Foreground(p.Divider).
 		SetString(" • ")
 
 	s.Error = lipgloss.NewStyle().
@@ -148,14 +392,36 @@ func DefaultStyles() *Styles {
 
 	s.ErrorTitle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("230")).
-		Background(lipgloss.Color("204")).
+		Background(p.Error).
 		Bold(true).
 		Padding(0, 1)
 
 	s.ErrorBody = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("252")).
+		Foreground(p.Text).
 		MarginLeft(2).
 		Width(52) // for now
 
+	s.Markdown = markdownStyle(p.Markdown)
+	s.Syntax = p.Syntax
+
+	return s
+}
+
+// markdownStyle returns a Glamour style by name, the dark one if it's unknown.
+// Text is left in the color of the terminal.
+func markdownStyle(name string) ansi.StyleConfig {
+	md, ok := glamour.DefaultStyles[name]
+	if !ok {
+		md = &glamour.DarkStyleConfig
+	}
+	s := *md
+	noColor := ""
+	s.Document.StylePrimitive.Color = &noColor
+	if s.CodeBlock.Chroma != nil {
+		c := *s.CodeBlock.Chroma
+		c.Text.Color = &noColor
+		c.Name.Color = &noColor
+		s.CodeBlock.Chroma = &c
+	}
 	return s
 }
@@ -0,0 +1,99 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/tui/style"
+)
+
+// themeEnv is the environment variable clients can set to dark or light to
+// override the theme mode, for example with
+// `ssh -o SetEnv=SOFT_SERVE_THEME=light`.
+const themeEnv = "SOFT_SERVE_THEME"
+
+// themeStyles returns the styles of a theme for a client with the given
+// environment and terminal background mode, see themeMode.
+func themeStyles(t config.Theme, env []string, bg string) *style.Styles {
+	p := style.DarkPalette
+	cs := t.Dark
+	if themeMode(t.Mode, env, bg) == config.ThemeLight {
+		p = style.LightPalette
+		cs = t.Light
+	}
+	for _, c := range []struct {
+		dst *lipgloss.Color
+		src string
+	}{
+		{&p.Accent, cs.Accent},
+		{&p.Border, cs.Border},
+		{&p.Cursor, cs.Cursor},
+		{&p.Selected, cs.Selected},
+		{&p.Text, cs.Text},
+		{&p.Muted, cs.Muted},
+		{&p.Faint, cs.Faint},
+		{&p.Divider, cs.Divider},
+		{&p.Note, cs.Note},
+		{&p.Directory, cs.Directory},
+		{&p.Hash, cs.Hash},
+		{&p.Author, cs.Author},
+		{&p.Hunk, cs.Hunk},
+		{&p.Added, cs.Added},
+		{&p.Deleted, cs.Deleted},
+		{&p.Error, cs.Error},
+	} {
+		if c.src != "" {
+			*c.dst = lipgloss.Color(c.src)
+		}
+	}
+	if cs.Markdown != "" {
+		p.Markdown = cs.Markdown
+	}
+	if cs.Syntax != "" {
+		p.Syntax = cs.Syntax
+	}
+	return style.NewStyles(p, t.Border)
+}
+
+// themeMode returns the theme mode of a client, dark or light. The mode set by
+// the client wins over the one of the config. In auto mode, the mode follows
+// bg, the background the terminal answered with, see queryBackground. If the
+// terminal didn't answer, the background is guessed from COLORFGBG, which
+// some terminals set and which clients have to send, for example with
+// `ssh -o SendEnv=COLORFGBG`. Without it, the mode is dark.
+func themeMode(mode string, env []string, bg string) string {
+	if m := getenv(env, themeEnv); m == config.ThemeDark || m == config.ThemeLight {
+		return m
+	}
+	if mode == config.ThemeDark || mode == config.ThemeLight {
+		return mode
+	}
+	if bg != "" {
+		return bg
+	}
+	if m := colorFgBgMode(env); m != "" {
+		return m
+	}
+	return config.ThemeDark
+}
+
+// needsBackground reports whether the theme mode of a client with the given
+// environment could follow the background of its terminal. The config can
+// change to auto mode while the session runs, so only the mode set by the
+// client rules the background out.
+func needsBackground(env []string) bool {
+	m := getenv(env, themeEnv)
+	return m != config.ThemeDark && m != config.ThemeLight
+}
+
+// getenv returns the value of a variable of an environment, empty if it's not
+// set. Later values win, as in a process environment.
+func getenv(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], key+"=") {
+			return strings.TrimPrefix(env[i], key+"=")
+		}
+	}
+	return ""
+}
@@ -4,13 +4,22 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/charmbracelet/soft-serve/config"
+	"github.com/charmbracelet/soft-serve/internal/cmd"
 	appCfg "github.com/charmbracelet/soft-serve/internal/config"
+	"github.com/charmbracelet/soft-serve/internal/lfs"
+	"github.com/charmbracelet/soft-serve/internal/limit"
+	"github.com/charmbracelet/soft-serve/internal/maintenance"
+	"github.com/charmbracelet/soft-serve/internal/push"
 	"github.com/charmbracelet/soft-serve/internal/tui"
 
+	"github.com/charmbracelet/keygen"
 	"github.com/charmbracelet/wish"
-	bm "github.com/charmbracelet/wish/bubbletea"
 	gm "github.com/charmbracelet/wish/git"
 	lm "github.com/charmbracelet/wish/logging"
 	"github.com/gliderlabs/ssh"
@@ -19,8 +28,12 @@ import (
 // Server is the Soft Serve server.
 type Server struct {
 	SSHServer *ssh.Server
-	Config    *config.Config
-	config    *appCfg.Config
+	// HTTPServer serves the Git LFS API and the metrics of the server.
+	HTTPServer *http.Server
+	// Maintenance maintains the repos in the background.
+	Maintenance *maintenance.Scheduler
+	Config      *config.Config
+	config      *appCfg.Config
 }
 
 // NewServer returns a new *ssh.Server configured to serve Soft Serve. The SSH
@@ -33,9 +46,15 @@ func NewServer(cfg *config.Config) *Server {
 	if err != nil {
 		log.Fatal(err)
 	}
+	ms := maintenance.NewScheduler(ac)
+	lim := limit.NewLimiter(ac)
 	mw := []wish.Middleware{
-		bm.Middleware(tui.SessionHandler(ac)),
+		tui.Middleware(ac),
 		gm.Middleware(cfg.RepoPath, ac),
+		push.Middleware(ac, ms),
+		lfs.Middleware(ac),
+		cmd.Middleware(ac, ms, lim),
+		lim.Middleware(),
 		lm.Middleware(),
 	}
 	s, err := wish.NewServer(
@@ -44,28 +63,72 @@ func NewServer(cfg *config.Config) *Server {
 		wish.WithAddress(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)),
 		wish.WithHostKeyPath(cfg.KeyPath),
 		wish.WithMiddleware(mw...),
+		lim.Option(),
 	)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	hs := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Host, cfg.HTTPPort),
+		Handler: lfs.NewHandler(ac),
+	}
 	return &Server{
-		SSHServer: s,
-		Config:    cfg,
-		config:    ac,
+		SSHServer:   s,
+		HTTPServer:  hs,
+		Maintenance: ms,
+		Config:      cfg,
+		config:      ac,
 	}
 }
 
+// Init creates the SSH server key-pair, the database and the config repo
+// without starting the server. Existing ones are left as they are.
+func Init(cfg *config.Config) error {
+	_, err := os.Stat(cfg.KeyPath)
+	if os.IsNotExist(err) {
+		// Same naming as wish.WithHostKeyPath, so the server picks up the key.
+		dir, n := filepath.Split(cfg.KeyPath)
+		_, err = keygen.NewWithWrite(filepath.Clean(dir), strings.TrimSuffix(n, "_ed25519"), nil, keygen.Ed25519)
+	}
+	if err != nil {
+		return err
+	}
+	ac, err := appCfg.NewConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return ac.DB.Close()
+}
+
 // Reload reloads the server configuration.
 func (srv *Server) Reload() error {
 	return srv.config.Reload()
 }
 
-// Start starts the SSH server.
+// Start starts the SSH and HTTP servers and the maintenance of the repos. The
+// search index is brought up to date in the background.
 func (srv *Server) Start() error {
+	srv.Maintenance.Start()
+	go srv.config.Search.UpdateAll()
+	go func() {
+		err := srv.HTTPServer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalln(err)
+		}
+	}()
 	return srv.SSHServer.ListenAndServe()
 }
 
 // Shutdown lets the server gracefully shutdown.
 func (srv *Server) Shutdown(ctx context.Context) error {
-	return srv.SSHServer.Shutdown(ctx)
+	err := srv.HTTPServer.Shutdown(ctx)
+	if err != nil {
+		return err
+	}
+	err = srv.SSHServer.Shutdown(ctx)
+	if err != nil {
+		return err
+	}
+	srv.Maintenance.Stop()
+	return srv.config.DB.Close()
 }